@@ -1,4 +1,26 @@
 Distribyted.logs = {
+    // Slowest recent reads of the read path, slowest first
+    loadSlowReads: function () {
+        function esc(s) { return $('<div>').text(String(s == null ? '' : s)).html(); }
+        Distribyted.http.getJSON('/api/reads/slow')
+            .then(function (data) {
+                var reads = (data && data.reads) || [];
+                $('#slow_reads_info').text(reads.length
+                    ? 'Reads slower than ' + data.thresholdMs + ' ms.'
+                    : 'No reads slower than ' + ((data && data.thresholdMs) || 0) + ' ms yet.');
+                var rows = reads.map(function (r) {
+                    var pieces = '';
+                    if (r.complete === true) { pieces = 'complete'; }
+                    else if (r.blockingPieces && r.blockingPieces.length) { pieces = 'waiting on ' + r.blockingPieces.join(', '); }
+                    var cls = r.error ? 'table-danger' : (r.complete === false ? 'table-warning' : '');
+                    return '<tr class="' + cls + '"><td>' + new Date(r.time * 1000).toLocaleString() + '</td><td>' + esc(r.layer) +
+                        '</td><td>' + esc(r.path) + '</td><td>' + r.offset + '</td><td>' + r.bytes + ' / ' + r.size +
+                        '</td><td>' + r.durationMs + ' ms</td><td>' + esc(pieces) + '</td><td>' + esc(r.error) + '</td></tr>';
+                });
+                $('#slow_reads_table').html(rows.join(''));
+            })
+            .fail(function (xhr) { Distribyted.message.error('Error loading slow reads: ' + xhr.statusText); });
+    },
     // Keep streaming via fetch; add jQuery-based polling fallback for older browsers if needed
     loadView: function () {
         if (window.ReadableStream && window.fetch) {
@@ -287,8 +287,12 @@ Distribyted.routes = {
         if(!confirm('Blacklist and re-request this item from Arr?')) { return Promise.resolve(); }
         var url = '/api/routes/' + encodeURIComponent(route) + '/torrent/' + torrentHash + '/blacklist'
         return $.ajax({ url: url, method: 'POST' })
-            .then(function(){
-                Distribyted.message.info('Blacklisted and removed.');
+            .then(function(res){
+                if(res && res.arrError){
+                    Distribyted.message.error('Removed, but Arr failed: ' + res.arrError);
+                } else {
+                    Distribyted.message.info('Blacklisted and removed.');
+                }
                 Distribyted.routes.loadView();
             })
             .catch(function (xhr) {
@@ -329,6 +333,7 @@ Distribyted.routes = {
                     '              <div class="row"><div class="col-3 font-weight-bold">Size</div><div class="col-9">' + (ts.sizeBytes?Humanize.bytes(ts.sizeBytes,1024):'') + '</div></div>' +
                     '              <div class="row"><div class="col-3 font-weight-bold">Added at</div><div class="col-9">' + (ts.addedAt?new Date(ts.addedAt*1000).toLocaleString():'') + '</div></div>' +
                     '              <div class="row"><div class="col-3 font-weight-bold">Seeders/Peers</div><div class="col-9">' + (ts.seeders||0) + '/' + (ts.peers||0) + '</div></div>' +
+                    '              <div class="row"><div class="col-3 font-weight-bold">Availability</div><div class="col-9">' + (ts.availability||0).toFixed(3) + '</div></div>' +
                     '              <div class="row"><div class="col-3 font-weight-bold">Downloaded/Uploaded</div><div class="col-9">' + Humanize.bytes(ts.downloadedBytes||0,1024) + ' / ' + Humanize.bytes(ts.uploadedBytes||0,1024) + '</div></div>' +
                     '              <div class="row"><div class="col-3 font-weight-bold">Piece size</div><div class="col-9">' + Humanize.bytes(ts.pieceSize||0, 1024) + '</div></div>' +
                     '              <div class="row"><div class="col-3 font-weight-bold">Route folder</div><div class="col-9"><code>' + (data.folder || '') + '</code></div></div>' +
@@ -622,7 +627,7 @@ Distribyted.routes = {
         if(!form) form = event.currentTarget || event.target;
         var input = form && form.querySelector ? form.querySelector('input[type="file"]') : null;
         if(!input || !input.files || input.files.length === 0){
-            Distribyted.message.error('Select a .torrent file');
+            Distribyted.message.error('Select a .torrent, .magnet or .url file');
             return false;
         }
         var fd = new FormData();
@@ -3,6 +3,8 @@
 
 (function(){
   var gCfg = null;
+  // per-route health policies are edited in the config file and round-tripped here
+  var gHealthPolicies = null;
 
   function loadConfig(){
     return Distribyted.http.getJSON('/api/settings/config')
@@ -24,8 +26,16 @@
       $('#health-interval').val(j.intervalMinutes || 60);
       $('#health-grace').val(j.graceMinutes || 30);
       $('#health-min-seeders').val(j.minSeeders || 2);
+      $('#health-min-availability').val(j.minAvailability || 0);
       $('#health-good-seeders').val(j.goodSeeders || 5);
       $('#health-excellent-seeders').val(j.excellentSeeders || 10);
+      $('#health-threshold').val(j.failureThreshold || 1);
+      $('#health-dry-run').prop('checked', !!j.dryRun);
+      $('#health-window').val(j.windowMinutes || 60);
+      $('#health-retention').val(j.historyRetentionHours || 168);
+      var actions = j.actions || ['blacklist', 'delete'];
+      $('.health-action').each(function(){ $(this).prop('checked', actions.indexOf($(this).val()) >= 0); });
+      gHealthPolicies = j.policies || null;
       (j.arr || []).forEach(addArrRow);
     });
 
@@ -92,7 +102,15 @@
   }
 
   function postConfig(body){
-    return Distribyted.http.postJSON('/api/settings/config', body);
+    return Distribyted.http.postJSON('/api/settings/config', body).then(function(j){
+      if(j && j.restartRequired && j.restartRequired.length){
+        Distribyted.message.info('Restart required to apply: ' + j.restartRequired.join(', '));
+      }
+      if(j && j.warnings && j.warnings.length){
+        Distribyted.message.info('Not found: ' + j.warnings.map(function(w){ return w.path; }).join(', '));
+      }
+      return j;
+    });
   }
 
   // Arr management
@@ -102,11 +120,18 @@
       <select class="form-select arr-type">\
         <option value="radarr">Radarr</option>\
         <option value="sonarr">Sonarr</option>\
-        <option value="lidarr">Lidarr</option></select></div>\
+        <option value="lidarr">Lidarr</option>\
+        <option value="readarr">Readarr</option>\
+        <option value="whisparr">Whisparr</option>\
+        <option value="prowlarr">Prowlarr</option></select></div>\
       <div class="col-auto"><input type="text" class="form-control arr-name" placeholder="Name" style="min-width:140px"></div>\
       <div class="col-auto"><input type="text" class="form-control arr-url" placeholder="Base URL (e.g. http://127.0.0.1:7878)" style="min-width:320px"></div>\
       <div class="col-auto"><input type="password" class="form-control arr-key" placeholder="API Key" style="min-width:280px"></div>\
       <div class="col-auto form-check"><input type="checkbox" class="form-check-input arr-insecure" id="arr-insec"> <label class="form-check-label" for="arr-insec">Insecure</label></div>\
+      <div class="col-auto"><input type="text" class="form-control arr-ca" placeholder="CA bundle file" style="min-width:200px"></div>\
+      <div class="col-auto"><input type="text" class="form-control arr-cert" placeholder="Client cert file" style="min-width:200px"></div>\
+      <div class="col-auto"><input type="text" class="form-control arr-cert-key" placeholder="Client key file" style="min-width:200px"></div>\
+      <div class="col-auto"><input type="number" min="0" class="form-control arr-timeout" placeholder="Timeout (s)" style="width:120px"></div>\
       <div class="col-auto"><button type="button" class="btn btn-info me-2 arr-test">Test</button></div>\
       <div class="col-auto"><button type="button" class="btn btn-danger arr-del">Delete</button></div></div>');
     if(item){
@@ -115,33 +140,24 @@
       $row.find('.arr-url').val(item.base_url || item.baseUrl || '');
       $row.find('.arr-key').val(item.api_key || item.apiKey || '');
       $row.find('.arr-insecure').prop('checked', !!item.insecure);
+      $row.find('.arr-ca').val(item.ca_file || '');
+      $row.find('.arr-cert').val(item.client_cert || '');
+      $row.find('.arr-cert-key').val(item.client_key || '');
+      $row.find('.arr-timeout').val(item.timeout_seconds || '');
     }
     $row.on('click', '.arr-del', function(){ $row.remove(); });
     $row.on('click', '.arr-test', function(){
-      var type = $row.find('.arr-type').val();
-      var name = ($row.find('.arr-name').val() || '').trim();
-      var baseUrl = ($row.find('.arr-url').val() || '').trim();
-      var apiKey = ($row.find('.arr-key').val() || '').trim();
-      var insecure = !!$row.find('.arr-insecure').prop('checked');
-      if(!baseUrl || !apiKey){ Distribyted.message.error('Base URL and API Key required'); return; }
-      Distribyted.http.postJSON('/api/settings/health/arr/test', { type: type, name: name, base_url: baseUrl, api_key: apiKey, insecure: insecure })
+      var inst = arrRowValue($row);
+      if(!inst.base_url || !inst.api_key){ Distribyted.message.error('Base URL and API Key required'); return; }
+      Distribyted.http.postJSON('/api/settings/health/arr/test', inst)
         .then(function(){
           Distribyted.message.info('Connection OK');
           if(confirm('Save this Arr instance now?')){
             try{
               var arr = collectArrRows();
-              var found = arr.find(function(it){ return it.base_url===baseUrl && it.type===type; });
-              var inst = { type: type, name: name, base_url: baseUrl, api_key: apiKey, insecure: insecure };
+              var found = arr.find(function(it){ return it.base_url===inst.base_url && it.type===inst.type; });
               if(!found){ arr.push(inst); }
-              var body = {
-                enabled: !!$('#health-enabled').prop('checked'),
-                intervalMinutes: parseInt($('#health-interval').val(), 10) || 60,
-                graceMinutes: parseInt($('#health-grace').val(), 10) || 30,
-                minSeeders: parseInt($('#health-min-seeders').val(), 10) || 0,
-                goodSeeders: parseInt($('#health-good-seeders').val(), 10) || 0,
-                excellentSeeders: parseInt($('#health-excellent-seeders').val(), 10) || 0,
-                arr: arr
-              };
+              var body = healthBody(arr);
               postConfig({}); // no-op to ensure handler exists
               $.ajax({ url: '/api/settings/health', method: 'POST', contentType: 'application/json', data: JSON.stringify(body) })
                 .then(function(){ Distribyted.message.info('Arr saved.'); })
@@ -154,16 +170,46 @@
     $('#arr-list').append($row);
   }
 
+  function healthBody(arr){
+    var actions = [];
+    $('.health-action:checked').each(function(){ actions.push($(this).val()); });
+    return {
+      enabled: !!$('#health-enabled').prop('checked'),
+      intervalMinutes: parseInt($('#health-interval').val(), 10) || 60,
+      graceMinutes: parseInt($('#health-grace').val(), 10) || 30,
+      minSeeders: parseInt($('#health-min-seeders').val(), 10) || 0,
+      minAvailability: parseFloat($('#health-min-availability').val()) || 0,
+      goodSeeders: parseInt($('#health-good-seeders').val(), 10) || 0,
+      excellentSeeders: parseInt($('#health-excellent-seeders').val(), 10) || 0,
+      actions: actions,
+      failureThreshold: parseInt($('#health-threshold').val(), 10) || 1,
+      dryRun: !!$('#health-dry-run').prop('checked'),
+      windowMinutes: parseInt($('#health-window').val(), 10) || 0,
+      historyRetentionHours: parseInt($('#health-retention').val(), 10) || 0,
+      policies: gHealthPolicies,
+      arr: arr
+    };
+  }
+
+  function arrRowValue($r){
+    return {
+      type: $r.find('.arr-type').val(),
+      name: ($r.find('.arr-name').val()||'').trim(),
+      base_url: ($r.find('.arr-url').val()||'').trim(),
+      api_key: ($r.find('.arr-key').val()||'').trim(),
+      insecure: !!$r.find('.arr-insecure').prop('checked'),
+      ca_file: ($r.find('.arr-ca').val()||'').trim(),
+      client_cert: ($r.find('.arr-cert').val()||'').trim(),
+      client_key: ($r.find('.arr-cert-key').val()||'').trim(),
+      timeout_seconds: parseInt($r.find('.arr-timeout').val(), 10) || 0
+    };
+  }
+
   function collectArrRows(){
     var out = [];
     $('#arr-list > .row').each(function(){
-      var $r = $(this);
-      var type = $r.find('.arr-type').val();
-      var name = ($r.find('.arr-name').val()||'').trim();
-      var baseUrl = ($r.find('.arr-url').val()||'').trim();
-      var apiKey = ($r.find('.arr-key').val()||'').trim();
-      var insecure = !!$r.find('.arr-insecure').prop('checked');
-      if(baseUrl && apiKey){ out.push({ type: type, name: name, base_url: baseUrl, api_key: apiKey, insecure: insecure }); }
+      var inst = arrRowValue($(this));
+      if(inst.base_url && inst.api_key){ out.push(inst); }
     });
     return out;
   }
@@ -199,16 +245,7 @@
 
   $(document).on('submit', '#health-form', function(e){
     e.preventDefault();
-    var arr = collectArrRows();
-    var body = {
-      enabled: !!$('#health-enabled').prop('checked'),
-      intervalMinutes: parseInt($('#health-interval').val(), 10) || 60,
-      graceMinutes: parseInt($('#health-grace').val(), 10) || 30,
-      minSeeders: parseInt($('#health-min-seeders').val(), 10) || 0,
-      goodSeeders: parseInt($('#health-good-seeders').val(), 10) || 0,
-      excellentSeeders: parseInt($('#health-excellent-seeders').val(), 10) || 0,
-      arr: arr
-    };
+    var body = healthBody(collectArrRows());
     if (body.intervalMinutes < 60) { Distribyted.message.error('Minimum interval is 60 minutes'); return; }
     $.ajax({ url: '/api/settings/health', method: 'POST', contentType: 'application/json', data: JSON.stringify(body) })
       .then(function(){ Distribyted.message.info('Health settings saved.'); })
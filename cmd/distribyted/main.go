@@ -2,15 +2,19 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/anacrolix/missinggo/v2/filecache"
+	atorrent "github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/storage"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
@@ -18,13 +22,12 @@ import (
 	"github.com/jkaberg/distribyted/config"
 	"github.com/jkaberg/distribyted/fs"
 	"github.com/jkaberg/distribyted/fuse"
-
-	// http server is started via server.StartServers
+	apphttp "github.com/jkaberg/distribyted/http"
 	dlog "github.com/jkaberg/distribyted/log"
+	"github.com/jkaberg/distribyted/metrics"
 	"github.com/jkaberg/distribyted/server"
 	"github.com/jkaberg/distribyted/torrent"
 	"github.com/jkaberg/distribyted/torrent/loader"
-	"github.com/jkaberg/distribyted/torrent/watchers"
 )
 
 const (
@@ -32,6 +35,10 @@ const (
 	fuseAllowOther = "fuse-allow-other"
 	portFlag       = "http-port"
 	webDAVPortFlag = "webdav-port"
+
+	// shutdownTimeout bounds how long in-flight transfers and reads are
+	// allowed to finish on shutdown or server restart.
+	shutdownTimeout = 30 * time.Second
 )
 
 func main() {
@@ -78,6 +85,62 @@ func main() {
 			return err
 		},
 
+		Commands: []*cli.Command{
+			{
+				Name:  "config",
+				Usage: "Configuration file utilities.",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "check",
+						Usage: "Validate the configuration file and report every invalid setting.",
+						Action: func(c *cli.Context) error {
+							return checkConfig(c.String(configFlag))
+						},
+					},
+				},
+			},
+			{
+				Name:      "export",
+				Usage:     "Export routes, magnets, torrent files and metadata to a bundle. Distribyted must be stopped.",
+				ArgsUsage: "[file]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Bundle format, json or zip. Taken from the file extension by default, json on standard output.",
+					},
+					&cli.BoolFlag{
+						Name:  "with-config",
+						Usage: "Include the configuration file in the bundle. It holds credentials such as API keys and passwords, keep the bundle private.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return exportIndex(c.String(configFlag), c.Args().First(), c.String("format"), c.Bool("with-config"))
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "Import a bundle written by export. Distribyted must be stopped.",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "mode",
+						Value: string(torrent.ImportMerge),
+						Usage: "merge keeps the current index, replace removes it first.",
+					},
+					&cli.BoolFlag{
+						Name:  "with-config",
+						Usage: "Also restore the configuration file of the bundle.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return cli.Exit("expected the bundle file to import", 1)
+					}
+					return importIndex(c.String(configFlag), c.Args().First(), c.String("mode"), c.Bool("with-config"))
+				},
+			},
+		},
+
 		HideHelpCommand: true,
 	}
 
@@ -86,6 +149,131 @@ func main() {
 	}
 }
 
+// checkConfig validates the configuration file, printing one line per
+// invalid setting and a warning per missing file or folder.
+func checkConfig(configPath string) error {
+	conf, err := config.NewHandler(configPath).Get()
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	for _, fe := range config.CheckPaths(conf) {
+		fmt.Println("warning: " + fe.Error())
+	}
+
+	var ve *config.ValidationError
+	if err := config.Validate(conf); errors.As(err, &ve) {
+		for _, fe := range ve.Errors {
+			fmt.Println(fe.Error())
+		}
+		return cli.Exit(fmt.Sprintf("%s: %d invalid settings", configPath, len(ve.Errors)), 1)
+	}
+
+	fmt.Printf("%s: configuration is valid\n", configPath)
+	return nil
+}
+
+// openIndex opens the index database and returns it with the UI-managed
+// routes root, for commands run while distribyted is stopped.
+func openIndex(conf *config.Root) (loader.Index, string, error) {
+	dbl, err := loader.OpenIndex(conf.Torrent.IndexBackend, conf.Torrent.MetadataFolder)
+	if err != nil {
+		return nil, "", fmt.Errorf("error opening index database, is distribyted running? %w", err)
+	}
+	return dbl, filepath.Join(conf.Torrent.MetadataFolder, "routes"), nil
+}
+
+// exportIndex writes a bundle of the torrent index to out, or to the
+// standard output when out is empty or "-".
+func exportIndex(configPath, out, format string, withConfig bool) error {
+	ch := config.NewHandler(configPath)
+	conf, err := ch.Get()
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	if format == "" {
+		format = torrent.BundleJSON
+		if strings.EqualFold(filepath.Ext(out), ".zip") {
+			format = torrent.BundleZIP
+		}
+	}
+
+	var raw []byte
+	if withConfig {
+		if raw, err = ch.GetRaw(); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+	}
+	dbl, routesRoot, err := openIndex(conf)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	defer dbl.Close()
+	b, err := torrent.ExportIndex(torrent.NewIndexFromLoader(dbl), routesRoot, raw)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	if out == "" || out == "-" {
+		return torrent.WriteBundle(os.Stdout, b, format)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	if err := torrent.WriteBundle(f, b, format); err != nil {
+		f.Close()
+		return cli.Exit(err.Error(), 1)
+	}
+	if err := f.Close(); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d routes, %d torrent files, %d metadata entries exported\n", out, len(b.Routes), len(b.Files), len(b.Meta))
+	return nil
+}
+
+// importIndex imports the bundle in file into the torrent index.
+func importIndex(configPath, file, mode string, withConfig bool) error {
+	m, err := torrent.ParseImportMode(mode)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	b, err := torrent.ReadBundle(data)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	ch := config.NewHandler(configPath)
+	if withConfig {
+		if b.Config == "" {
+			return cli.Exit(file+": bundle has no configuration", 1)
+		}
+		if err := ch.SaveRaw([]byte(b.Config)); err != nil {
+			return cli.Exit(fmt.Sprintf("error saving configuration: %v", err), 1)
+		}
+	}
+	conf, err := ch.Get()
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	dbl, routesRoot, err := openIndex(conf)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	defer dbl.Close()
+	res, err := torrent.ImportIndex(torrent.NewIndexFromLoader(dbl), routesRoot, b, m)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	fmt.Printf("%s: %d routes, %d magnets, %d torrent files, %d metadata entries imported (%s)\n",
+		file, res.Routes, res.Magnets, res.Files, res.Meta, m)
+	return nil
+}
+
 func load(configPath string, port, webDAVPort int, fuseAllowOther bool) error {
 	ch := config.NewHandler(configPath)
 
@@ -93,8 +281,14 @@ func load(configPath string, port, webDAVPort int, fuseAllowOther bool) error {
 	if err != nil {
 		return fmt.Errorf("error loading configuration: %w", err)
 	}
+	if err := config.Validate(conf); err != nil {
+		return err
+	}
 
 	dlog.Load(conf.Log)
+	for _, fe := range config.CheckPaths(conf) {
+		log.Warn().Str("setting", fe.Path).Msg(fe.Message)
+	}
 
 	if err := os.MkdirAll(conf.Torrent.MetadataFolder, 0744); err != nil {
 		return fmt.Errorf("error creating metadata folder: %w", err)
@@ -131,10 +325,16 @@ func load(configPath string, port, webDAVPort int, fuseAllowOther bool) error {
 	cl := loader.NewConfig(conf.Routes)
 	fl := loader.NewFolder(conf.Routes)
 	ss := torrent.NewStats()
+	if err := metrics.Registry.Register(torrent.NewStatsCollector(ss)); err != nil {
+		return fmt.Errorf("error registering torrent metrics: %w", err)
+	}
+	if err := metrics.RegisterCache(fc); err != nil {
+		return fmt.Errorf("error registering cache metrics: %w", err)
+	}
 
-	dbl, err := loader.NewDB(filepath.Join(conf.Torrent.MetadataFolder, "magnetdb"))
+	dbl, err := loader.OpenIndex(conf.Torrent.IndexBackend, conf.Torrent.MetadataFolder)
 	if err != nil {
-		return fmt.Errorf("error starting magnet database: %w", err)
+		return fmt.Errorf("error starting index database: %w", err)
 	}
 
 	// UI-managed routesRoot: <metadata>/routes
@@ -143,7 +343,9 @@ func load(configPath string, port, webDAVPort int, fuseAllowOther bool) error {
 		return fmt.Errorf("error creating routes root: %w", err)
 	}
 
-	ts := torrent.NewService([]loader.Loader{cl, fl}, torrent.NewIndexFromLoader(dbl), ss, c,
+	feedl := loader.NewFeed(conf.Routes, dbl)
+
+	ts := torrent.NewService([]loader.Loader{cl, fl, feedl}, torrent.NewIndexFromLoader(dbl), ss, c,
 		conf.Torrent.AddTimeout,
 		conf.Torrent.ReadTimeout,
 		conf.Torrent.ContinueWhenAddTimeout,
@@ -158,8 +360,8 @@ func load(configPath string, port, webDAVPort int, fuseAllowOther bool) error {
 		mh = fuse.NewHandler(fuseAllowOther || conf.Fuse.AllowOther, conf.Fuse.Path)
 	}
 
-	sigChan := make(chan os.Signal)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	log.Info().Msg(fmt.Sprintf("setting cache size to %d MB", conf.Torrent.GlobalCacheSize))
 	fc.SetCapacity(conf.Torrent.GlobalCacheSize * 1024 * 1024)
@@ -178,24 +380,25 @@ func load(configPath string, port, webDAVPort int, fuseAllowOther bool) error {
 	ts.LoadMetaFromDB()
 	ts.StartMetaPersistence()
 
+	ts.SetNestedFolders(conf.Routes)
+
 	// Pre-mount routes so FUSE/WebDAV/HTTPFS expose paths immediately
 	ts.PreAddRoutes()
+	ts.SetSmartFolders(conf.SmartFolders)
+	ts.SetMediaViews(conf.Routes)
 	// Load torrents and start watchers asynchronously to avoid delaying startup
-	var routeWatchers, uiWatchers []*watchers.RouteWatcher
 	go func() {
 		log.Info().Msg("loading torrents in background...")
 		if _, e := ts.Load(); e != nil {
 			log.Error().Err(e).Msg("error when loading torrents")
 		}
+		ts.StartFeeds()
 		// Start route watchers for dynamic loading from configured torrent folders
-		var wErr error
-		routeWatchers, wErr = watchers.StartRouteWatchers(ts, conf.Routes)
-		if wErr != nil {
+		if wErr := ts.StartFolderWatchers(conf.Routes); wErr != nil {
 			log.Error().Err(wErr).Msg("error starting route watchers")
 		}
 		// Also start watchers for UI-managed routes under routesRoot
-		uiWatchers, wErr = watchers.StartRouteWatchersFromRoot(ts, routesRoot)
-		if wErr != nil {
+		if wErr := ts.StartRouteWatchers(); wErr != nil {
 			log.Error().Err(wErr).Msg("error starting UI route watchers")
 		}
 	}()
@@ -203,36 +406,6 @@ func load(configPath string, port, webDAVPort int, fuseAllowOther bool) error {
 	httpfs := torrent.NewHTTPFS(cfs)
 	logFilename := filepath.Join(conf.Log.Path, dlog.FileName)
 
-	go func() {
-		<-sigChan
-		log.Info().Msg("closing route watchers...")
-		for _, w := range routeWatchers {
-			if err := w.Close(); err != nil {
-				log.Warn().Err(err).Msg("problem closing route watcher")
-			}
-		}
-		for _, w := range uiWatchers {
-			if err := w.Close(); err != nil {
-				log.Warn().Err(err).Msg("problem closing route watcher")
-			}
-		}
-		// stop periodic DB persistence and flush
-		ts.StopMetaPersistence()
-		log.Info().Msg("closing items database...")
-		fis.Close()
-		log.Info().Msg("closing magnet database...")
-		dbl.Close()
-		log.Info().Msg("closing torrent client...")
-		c.Close()
-		if mh != nil {
-			log.Info().Msg("unmounting fuse filesystem...")
-			mh.Unmount()
-		}
-
-		log.Info().Msg("exiting")
-		os.Exit(1)
-	}()
-
 	go func() {
 		if mh == nil {
 			return
@@ -250,9 +423,144 @@ func load(configPath string, port, webDAVPort int, fuseAllowOther bool) error {
 	if conf.WebDAV != nil && webDAVPort != 0 {
 		conf.WebDAV.Port = webDAVPort
 	}
-	err = server.StartServers(fc, cfs, conf.HTTPGlobal, conf.WebDAV, ss, ts, ch, httpfs, logFilename)
+	srv := server.NewServers(fc, cfs, ss, ts, ch, httpfs, logFilename)
+	if err := srv.Start(conf.HTTPGlobal, conf.WebDAV); err != nil {
+		return fmt.Errorf("error initializing HTTP server: %w", err)
+	}
 	// Attach overlays after servers started to avoid delaying mount/startup
 	go ts.AttachOverlays()
-	log.Error().Err(err).Msg("error initializing HTTP server")
-	return err
+
+	// Apply configuration changes live, from the API or edits on disk
+	if err := ch.OnReload(ts.ApplyConfig, runtimeReloader(fc, srv)); err != nil {
+		return fmt.Errorf("error registering configuration reload: %w", err)
+	}
+	cw, err := ch.Watch()
+	if err != nil {
+		log.Warn().Err(err).Msg("error watching configuration file, live reload disabled")
+	}
+
+	for {
+		var exitErr error
+		select {
+		case exitErr = <-srv.Errors():
+			log.Error().Err(exitErr).Msg("server stopped unexpectedly, shutting down")
+		case sig := <-sigChan:
+			if sig == syscall.SIGHUP {
+				reload(ch, srv, webDAVPort)
+				continue
+			}
+			log.Info().Str("signal", sig.String()).Msg("shutting down")
+		}
+
+		if cw != nil {
+			_ = cw.Close()
+		}
+		shutdown(srv, mh, ts, fis, dbl, c)
+		log.Info().Msg("exiting")
+		return exitErr
+	}
+}
+
+// reload re-reads the configuration file and applies it without touching
+// the FUSE mount: runtime settings are updated in place and the HTTP and
+// WebDAV servers are restarted when their settings changed.
+func reload(ch *config.Handler, srv *server.Servers, webDAVPort int) {
+	log.Info().Msg("reloading configuration...")
+	res, err := ch.Reload()
+	if res == nil {
+		log.Error().Err(err).Msg("error reloading configuration, keeping current settings")
+		return
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("some configuration changes could not be applied")
+	}
+	for _, e := range res.Events {
+		log.Info().Msg(e)
+	}
+	if !config.Changed(res.Changes, "http") && !config.Changed(res.Changes, "webdav") {
+		log.Info().Msg("configuration reloaded")
+		return
+	}
+
+	conf, err := ch.Get()
+	if err != nil {
+		log.Error().Err(err).Msg("error reading configuration")
+		return
+	}
+	if conf.WebDAV != nil && webDAVPort != 0 {
+		conf.WebDAV.Port = webDAVPort
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Restart(ctx, conf.HTTPGlobal, conf.WebDAV); err != nil {
+		log.Error().Err(err).Msg("error restarting servers")
+		return
+	}
+	log.Info().Msg("configuration reloaded")
+}
+
+// runtimeReloader applies the settings owned by main: cache capacity, log
+// level, WebDAV credentials and the qBittorrent API toggle.
+func runtimeReloader(fc *filecache.Cache, srv *server.Servers) config.ReloadFunc {
+	return func(old, cur *config.Root, changes []*config.Change, ev config.EventFunc) error {
+		if config.Changed(changes, "torrent.global_cache_size") {
+			fc.SetCapacity(cur.Torrent.GlobalCacheSize * 1024 * 1024)
+			ev(fmt.Sprintf("cache size set to %d MB", cur.Torrent.GlobalCacheSize))
+		}
+		if config.Changed(changes, "log.debug") {
+			dlog.SetDebug(cur.Log.Debug)
+			ev(fmt.Sprintf("debug logging set to %t", cur.Log.Debug))
+		}
+		if config.Changed(changes, "webdav.user") || config.Changed(changes, "webdav.pass") {
+			srv.SetWebDAVCredentials(cur.WebDAV.User, cur.WebDAV.Pass)
+			ev("webDAV credentials updated")
+		}
+		if config.Changed(changes, "http.qbittorrent_api") {
+			apphttp.SetQbtEnabled(cur.HTTPGlobal.QbittorrentAPI)
+			ev(fmt.Sprintf("qBittorrent API enabled: %t", cur.HTTPGlobal.QbittorrentAPI))
+		}
+		return nil
+	}
+}
+
+// shutdown stops every component in dependency order: listeners first, then
+// in-flight readers, background writers, databases, the torrent client and
+// finally the FUSE mount.
+func shutdown(srv *server.Servers, mh *fuse.Handler, ts *torrent.Service, fis *torrent.FileItemStore, dbl loader.Index, c *atorrent.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	log.Info().Msg("stopping HTTP and WebDAV servers...")
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Warn().Err(err).Msg("problem stopping servers")
+	}
+
+	if mh != nil {
+		log.Info().Msg("draining active FUSE readers...")
+		if err := mh.Drain(ctx); err != nil {
+			log.Warn().Err(err).Msg("timeout draining FUSE readers")
+		}
+	}
+
+	log.Info().Msg("closing route watchers...")
+	ts.CloseWatchers()
+	ts.StopFeeds()
+	ts.StopHealthMonitor()
+
+	// stop periodic DB persistence and flush
+	ts.StopMetaPersistence()
+	log.Info().Msg("closing items database...")
+	if err := fis.Close(); err != nil {
+		log.Warn().Err(err).Msg("problem closing items database")
+	}
+	log.Info().Msg("closing magnet database...")
+	if err := dbl.Close(); err != nil {
+		log.Warn().Err(err).Msg("problem closing magnet database")
+	}
+	log.Info().Msg("closing torrent client...")
+	c.Close()
+	if mh != nil {
+		log.Info().Msg("unmounting fuse filesystem...")
+		mh.Unmount()
+	}
 }
@@ -51,3 +51,32 @@ func TestDefaults(t *testing.T) {
 	require.Equal(mountFolder, dr.Fuse.Path)
 
 }
+
+func TestHealthPolicyFor(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	h := &Health{
+		FailureThreshold: 3,
+		Policies: []*HealthPolicy{
+			{Route: "kids", Actions: []HealthAction{HealthNotify}},
+			{Route: "movies", FailureThreshold: 5},
+		},
+	}
+
+	actions, threshold := h.PolicyFor("tv")
+	require.Equal([]HealthAction{HealthBlacklist, HealthDelete}, actions)
+	require.Equal(3, threshold)
+
+	actions, threshold = h.PolicyFor("kids")
+	require.Equal([]HealthAction{HealthNotify}, actions)
+	require.Equal(3, threshold)
+
+	actions, threshold = h.PolicyFor("movies")
+	require.Equal([]HealthAction{HealthBlacklist, HealthDelete}, actions)
+	require.Equal(5, threshold)
+
+	_, threshold = (&Health{}).PolicyFor("tv")
+	require.Equal(1, threshold)
+}
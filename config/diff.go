@@ -0,0 +1,102 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change describes a single setting that differs between two configurations.
+type Change struct {
+	// Path is the yaml path of the setting, e.g. "torrent.global_cache_size"
+	Path            string `json:"path"`
+	RequiresRestart bool   `json:"requiresRestart"`
+}
+
+// restartRequired lists settings that are only read on startup. A section
+// path (e.g. "fuse") covers the section being added or removed.
+var restartRequired = map[string]bool{
+	"http":                    true,
+	"http.port":               true,
+	"http.ip":                 true,
+	"http.httpfs":             true,
+	"webdav":                  true,
+	"webdav.port":             true,
+	"torrent.metadata_folder": true,
+	"torrent.index_backend":   true,
+	"torrent.disable_ipv6":    true,
+	"torrent.disable_tcp":     true,
+	"torrent.disable_utp":     true,
+	"torrent.ip":              true,
+	"torrent.listen_port":     true,
+	"fuse":                    true,
+	"fuse.path":               true,
+	"fuse.allow_other":        true,
+	"log.path":                true,
+	"log.max_backups":         true,
+	"log.max_size":            true,
+	"log.max_age":             true,
+}
+
+// RequiresRestart reports whether a change to the setting at path only takes
+// effect after restarting distribyted.
+func RequiresRestart(path string) bool {
+	return restartRequired[path]
+}
+
+// Diff returns the settings that differ between old and cur, sorted by path.
+// Lists such as routes or extra trackers are reported as a whole.
+func Diff(old, cur *Root) []*Change {
+	var paths []string
+	diffValue("", reflect.ValueOf(old), reflect.ValueOf(cur), &paths)
+	sort.Strings(paths)
+
+	out := make([]*Change, 0, len(paths))
+	for _, p := range paths {
+		out = append(out, &Change{Path: p, RequiresRestart: RequiresRestart(p)})
+	}
+	return out
+}
+
+// Changed reports whether any change in the list is at path or below it.
+func Changed(changes []*Change, path string) bool {
+	for _, c := range changes {
+		if c.Path == path || strings.HasPrefix(c.Path, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func diffValue(p string, a, b reflect.Value, out *[]string) {
+	if a.Kind() == reflect.Ptr {
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*out = append(*out, p)
+			}
+			return
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*out = append(*out, p)
+		}
+		return
+	}
+
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := yamlName(f)
+		if name == "" {
+			continue
+		}
+		fp := name
+		if p != "" {
+			fp = p + "." + name
+		}
+		diffValue(fp, a.Field(i), b.Field(i), out)
+	}
+}
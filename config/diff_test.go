@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	old := AddDefaults(&Root{})
+	cur := AddDefaults(&Root{})
+	require.Empty(Diff(old, cur))
+
+	cur.Torrent.GlobalCacheSize = 4096
+	cur.HTTPGlobal.Port = 8080
+	cur.WebDAV = &WebDAVGlobal{Port: 36911}
+	cur.Routes = []*Route{{Name: "movies"}}
+
+	changes := Diff(old, cur)
+	require.Equal([]*Change{
+		{Path: "http.port", RequiresRestart: true},
+		{Path: "routes"},
+		{Path: "torrent.global_cache_size"},
+		{Path: "webdav", RequiresRestart: true},
+	}, changes)
+
+	require.True(Changed(changes, "torrent"))
+	require.True(Changed(changes, "routes"))
+	require.False(Changed(changes, "torrent.read_timeout"))
+	require.False(Changed(changes, "tor"))
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(os.WriteFile(p, []byte("torrent:\n  global_cache_size: 1024\n"), 0644))
+
+	ch := NewHandler(p)
+	var got []*Change
+	require.NoError(ch.OnReload(func(old, cur *Root, changes []*Change, ev EventFunc) error {
+		got = changes
+		ev("applied")
+		return nil
+	}))
+
+	res, err := ch.Reload()
+	require.NoError(err)
+	require.Empty(res.Changes)
+	require.Nil(got)
+
+	require.NoError(os.WriteFile(p, []byte("torrent:\n  global_cache_size: 2048\nhttp:\n  port: 9000\n"), 0644))
+
+	res, err = ch.Reload()
+	require.NoError(err)
+	require.Equal(res.Changes, got)
+	require.Equal([]string{"applied"}, res.Events)
+	require.Equal([]string{"http.port"}, res.RestartRequired())
+
+	// a failed reload still advances the baseline, the applied changes are
+	// not run again
+	fail := errors.New("busy")
+	require.NoError(ch.OnReload(func(old, cur *Root, changes []*Change, ev EventFunc) error {
+		return fail
+	}))
+	require.NoError(os.WriteFile(p, []byte("torrent:\n  global_cache_size: 4096\nhttp:\n  port: 9000\n"), 0644))
+	res, err = ch.Reload()
+	require.ErrorIs(err, fail)
+	require.Equal([]*Change{{Path: "torrent.global_cache_size"}}, res.Changes)
+	require.Equal([]string{"applied"}, res.Events)
+	fail = nil
+	got = nil
+	res, err = ch.Reload()
+	require.NoError(err)
+	require.Empty(res.Changes)
+	require.Nil(got)
+
+	require.NoError(os.WriteFile(p, []byte("torrent:\n  global_cache_size: 8192\nhttp:\n  port: 9000\n"), 0644))
+	res, err = ch.Reload()
+	require.NoError(err)
+	require.Equal([]*Change{{Path: "torrent.global_cache_size"}}, res.Changes)
+}
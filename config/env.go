@@ -0,0 +1,285 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to every environment variable overriding a setting.
+// The variable name is the upper-cased yaml path joined with underscores,
+// e.g. DISTRIBYTED_TORRENT_GLOBAL_CACHE_SIZE or DISTRIBYTED_HEALTH_ARR_0_API_KEY.
+// Appending _FILE reads the value from a file instead, for Docker secrets.
+const EnvPrefix = "DISTRIBYTED_"
+
+const envFileSuffix = "_FILE"
+
+// LookupFunc returns the value of an environment variable, like os.LookupEnv.
+type LookupFunc func(key string) (string, bool)
+
+// ApplyEnv overrides settings in r from environment variables and returns
+// the yaml paths of the overridden settings. Only sections and list entries
+// (routes, Arr instances) present in r can be overridden, so the environment
+// never enables a disabled section such as fuse or webdav.
+func ApplyEnv(r *Root, lookup LookupFunc) ([]string, error) {
+	var paths, errs []string
+	walkSettings(reflect.ValueOf(r).Elem(), nil, func(v reflect.Value, path []string) {
+		key := envKey(path)
+		val, ok, err := envValue(lookup, key)
+		if err != nil {
+			errs = append(errs, err.Error())
+			return
+		}
+		if !ok {
+			return
+		}
+		if err := setValue(v, val); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+			return
+		}
+		paths = append(paths, pathString(path))
+	})
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("error applying environment overrides: %s", strings.Join(errs, "; "))
+	}
+	return paths, nil
+}
+
+// restoreEnv resets every setting of r overridden by the environment to its
+// value in file, so resolved secrets are never written back to disk. List
+// entries are overridden by their index in file, so the entries of r are
+// matched to the ones of file by name or URL, as they may have been moved.
+func restoreEnv(r, file *Root, lookup LookupFunc) {
+	src := reflect.ValueOf(file)
+	// identities are compared after the overrides, which may change them
+	loaded := reflect.ValueOf(copyWithEnv(file, lookup))
+	dst := reflect.ValueOf(r)
+	walkSettings(dst.Elem(), nil, func(v reflect.Value, path []string) {
+		path, found := filePath(dst, loaded, path)
+		if !found {
+			// added since the file was read, the environment never applied
+			return
+		}
+		_, ok := lookup(envKey(path))
+		_, fok := lookup(envKey(path) + envFileSuffix)
+		if !ok && !fok {
+			return
+		}
+		if fv, found := settingAt(src, path); found {
+			v.Set(fv)
+		} else {
+			v.Set(reflect.Zero(v.Type()))
+		}
+	})
+}
+
+// copyWithEnv returns a copy of r with the environment overrides applied.
+func copyWithEnv(r *Root, lookup LookupFunc) *Root {
+	out := &Root{}
+	b, err := yaml.Marshal(r)
+	if err != nil || yaml.Unmarshal(b, out) != nil {
+		return r
+	}
+	_, _ = ApplyEnv(out, lookup)
+	return out
+}
+
+// entryKeys are the settings identifying a list entry, by preference.
+var entryKeys = []string{"name", "route", "base_url", "url", "magnet_uri", "torrent_path"}
+
+// filePath translates the list indexes of path, a setting of r, to the ones
+// of the same entries in file. It returns false when an entry of path is not
+// in file.
+func filePath(r, file reflect.Value, path []string) ([]string, bool) {
+	out := append([]string(nil), path...)
+	for i, p := range path {
+		if _, err := strconv.Atoi(p); err != nil {
+			continue
+		}
+		entry, ok := settingAt(r, path[:i+1])
+		if !ok {
+			return nil, false
+		}
+		list, ok := settingAt(file, out[:i])
+		if !ok || list.Kind() != reflect.Slice {
+			return nil, false
+		}
+		j := entryIndex(list, entry)
+		if j < 0 {
+			return nil, false
+		}
+		out[i] = strconv.Itoa(j)
+	}
+	return out, true
+}
+
+// entryIndex returns the index in list of the entry sharing an identifying
+// setting with entry, tried in the order of entryKeys, or -1.
+func entryIndex(list, entry reflect.Value) int {
+	for _, k := range entryKeys {
+		want, ok := settingAt(entry, []string{k})
+		if !ok || want.Kind() != reflect.String || want.String() == "" {
+			continue
+		}
+		for j := 0; j < list.Len(); j++ {
+			if got, ok := settingAt(list.Index(j), []string{k}); ok && got.String() == want.String() {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// walkSettings calls fn for every setting below v; path holds the yaml names
+// and list indexes leading to v. Missing sections, like fuse or webdav, are
+// skipped as they mean disabled.
+func walkSettings(v reflect.Value, path []string, fn func(v reflect.Value, path []string)) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			if !v.IsNil() {
+				walkSettings(v.Elem(), path, fn)
+			}
+			return
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if name := yamlName(t.Field(i)); name != "" {
+				walkSettings(v.Field(i), append(path, name), fn)
+			}
+		}
+		return
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Ptr {
+			for i := 0; i < v.Len(); i++ {
+				walkSettings(v.Index(i), append(path, strconv.Itoa(i)), fn)
+			}
+			return
+		}
+	}
+
+	fn(v, append([]string(nil), path...))
+}
+
+// settingAt returns the setting at path below v, if present.
+func settingAt(v reflect.Value, path []string) (reflect.Value, bool) {
+	for _, p := range path {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			found := false
+			t := v.Type()
+			for i := 0; i < t.NumField(); i++ {
+				if yamlName(t.Field(i)) == p {
+					v, found = v.Field(i), true
+					break
+				}
+			}
+			if !found {
+				return reflect.Value{}, false
+			}
+		case reflect.Slice:
+			i, err := strconv.Atoi(p)
+			if err != nil || i >= v.Len() {
+				return reflect.Value{}, false
+			}
+			v = v.Index(i)
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	return v, true
+}
+
+func yamlName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func envValue(lookup LookupFunc, key string) (string, bool, error) {
+	val, ok := lookup(key)
+	file, fok := lookup(key + envFileSuffix)
+	switch {
+	case ok && fok:
+		return "", false, fmt.Errorf("%s and %s%s are mutually exclusive", key, key, envFileSuffix)
+	case fok:
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("%s%s: %w", key, envFileSuffix, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), true, nil
+	}
+	return val, ok, nil
+}
+
+func setValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		out := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out = reflect.Append(out, reflect.ValueOf(p).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(out)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func envKey(path []string) string {
+	return EnvPrefix + strings.ToUpper(strings.Join(path, "_"))
+}
+
+// pathString formats path segments like "health.arr[0].api_key".
+func pathString(path []string) string {
+	var sb strings.Builder
+	for i, p := range path {
+		if _, err := strconv.Atoi(p); err == nil {
+			sb.WriteString("[" + p + "]")
+			continue
+		}
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(p)
+	}
+	return sb.String()
+}
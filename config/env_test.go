@@ -0,0 +1,162 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func lookupMap(m map[string]string) LookupFunc {
+	return func(k string) (string, bool) {
+		v, ok := m[k]
+		return v, ok
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	secret := filepath.Join(t.TempDir(), "arr_key")
+	require.NoError(os.WriteFile(secret, []byte("s3cret\n"), 0600))
+
+	r := AddDefaults(&Root{})
+	r.Health.Arr = []*ArrInstance{{Name: "radarr", Type: ArrRadarr}}
+
+	paths, err := ApplyEnv(r, lookupMap(map[string]string{
+		"DISTRIBYTED_TORRENT_GLOBAL_CACHE_SIZE": "4096",
+		"DISTRIBYTED_TORRENT_EXTRA_TRACKERS":    "udp://a:1, udp://b:2",
+		"DISTRIBYTED_LOG_DEBUG":                 "true",
+		"DISTRIBYTED_HEALTH_ARR_0_API_KEY_FILE": secret,
+		"DISTRIBYTED_WEBDAV_PASS":               "ignored, webdav is disabled",
+	}))
+	require.NoError(err)
+	require.ElementsMatch([]string{
+		"torrent.global_cache_size",
+		"torrent.extra_trackers",
+		"log.debug",
+		"health.arr[0].api_key",
+	}, paths)
+
+	require.EqualValues(4096, r.Torrent.GlobalCacheSize)
+	require.Equal([]string{"udp://a:1", "udp://b:2"}, r.Torrent.ExtraTrackers)
+	require.True(r.Log.Debug)
+	require.Equal("s3cret", r.Health.Arr[0].APIKey)
+	require.Nil(r.WebDAV)
+
+	_, err = ApplyEnv(r, lookupMap(map[string]string{"DISTRIBYTED_HTTP_PORT": "nope"}))
+	require.Error(err)
+}
+
+func TestSaveKeepsEnvSecrets(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(os.WriteFile(p, []byte("webdav:\n  port: 36911\n  user: admin\n  pass: fromfile\n"), 0644))
+
+	ch := NewHandler(p)
+	ch.lookup = lookupMap(map[string]string{"DISTRIBYTED_WEBDAV_PASS": "fromenv"})
+
+	conf, err := ch.Get()
+	require.NoError(err)
+	require.Equal("fromenv", conf.WebDAV.Pass)
+
+	conf.WebDAV.User = "other"
+	require.NoError(ch.Save(conf))
+	require.Equal("fromenv", conf.WebDAV.Pass)
+
+	ch.lookup = lookupMap(nil)
+	conf, err = ch.Get()
+	require.NoError(err)
+	require.Equal("other", conf.WebDAV.User)
+	require.Equal("fromfile", conf.WebDAV.Pass)
+}
+
+func TestSaveKeepsEnvSecretsOfMovedEntries(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(os.WriteFile(p, []byte(`health:
+  arr:
+    - name: sonarr
+      type: sonarr
+      base_url: http://sonarr:8989
+      api_key: sonarr-file
+    - name: radarr
+      type: radarr
+      base_url: http://radarr:7878
+      api_key: radarr-file
+`), 0644))
+
+	ch := NewHandler(p)
+	ch.lookup = lookupMap(map[string]string{"DISTRIBYTED_HEALTH_ARR_0_API_KEY": "sonarr-env"})
+
+	conf, err := ch.Get()
+	require.NoError(err)
+	require.Equal("sonarr-env", conf.Health.Arr[0].APIKey)
+
+	// reordered: sonarr keeps its file key and radarr is left alone
+	conf.Health.Arr[0], conf.Health.Arr[1] = conf.Health.Arr[1], conf.Health.Arr[0]
+	conf.Health.Arr[1].Name = "sonarr-hd"
+	require.NoError(ch.Save(conf))
+
+	ch.lookup = lookupMap(nil)
+	saved, err := ch.Get()
+	require.NoError(err)
+	require.Equal("radarr", saved.Health.Arr[0].Name)
+	require.Equal("radarr-file", saved.Health.Arr[0].APIKey)
+	require.Equal("sonarr-hd", saved.Health.Arr[1].Name)
+	require.Equal("sonarr-file", saved.Health.Arr[1].APIKey)
+
+	// removed: radarr, now first, keeps its own key
+	saved.Health.Arr = saved.Health.Arr[:1]
+	ch.lookup = lookupMap(map[string]string{"DISTRIBYTED_HEALTH_ARR_1_API_KEY": "sonarr-env"})
+	require.NoError(ch.Save(saved))
+
+	ch.lookup = lookupMap(nil)
+	saved, err = ch.Get()
+	require.NoError(err)
+	require.Len(saved.Health.Arr, 1)
+	require.Equal("radarr-file", saved.Health.Arr[0].APIKey)
+}
+
+func TestSaveKeepsEnvSecretsOfInsertedEntries(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(os.WriteFile(p, []byte(`health:
+  arr:
+    - name: sonarr
+      type: sonarr
+      base_url: http://sonarr:8989
+      api_key: sonarr-file
+`), 0644))
+
+	ch := NewHandler(p)
+	ch.lookup = lookupMap(map[string]string{"DISTRIBYTED_HEALTH_ARR_0_API_KEY": "sonarr-env"})
+
+	conf, err := ch.Get()
+	require.NoError(err)
+	require.Equal("sonarr-env", conf.Health.Arr[0].APIKey)
+
+	// the new entry takes the index of the overridden one
+	radarr := &ArrInstance{Name: "radarr", Type: ArrRadarr, BaseURL: "http://radarr:7878", APIKey: "radarr-new"}
+	conf.Health.Arr = append([]*ArrInstance{radarr}, conf.Health.Arr...)
+	require.NoError(ch.Save(conf))
+
+	ch.lookup = lookupMap(nil)
+	saved, err := ch.Get()
+	require.NoError(err)
+	require.Len(saved.Health.Arr, 2)
+	require.Equal("radarr-new", saved.Health.Arr[0].APIKey)
+	require.Equal("sonarr-file", saved.Health.Arr[1].APIKey)
+}
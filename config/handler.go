@@ -1,24 +1,56 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/jkaberg/distribyted"
 	"gopkg.in/yaml.v3"
 )
 
+// EventFunc reports a human readable event while a configuration is applied.
 type EventFunc func(event string)
-type ReloadFunc func(*Root, EventFunc) error
+
+// ReloadFunc applies the changes between the previously applied
+// configuration and the new one.
+type ReloadFunc func(old, cur *Root, changes []*Change, ev EventFunc) error
 
 type Handler struct {
 	p string
+
+	// lookup reads environment overrides, see ApplyEnv
+	lookup LookupFunc
+
+	// reloadMu serializes reloads; applied is the last configuration handed
+	// to the reload functions.
+	reloadMu  sync.Mutex
+	applied   *Root
+	reloaders []ReloadFunc
+}
+
+// ReloadResult summarizes a configuration reload.
+type ReloadResult struct {
+	Changes []*Change `json:"changes"`
+	Events  []string  `json:"events"`
+}
+
+// RestartRequired returns the changed settings that need a restart to apply.
+func (r *ReloadResult) RestartRequired() []string {
+	out := []string{}
+	for _, c := range r.Changes {
+		if c.RequiresRestart {
+			out = append(out, c.Path)
+		}
+	}
+	return out
 }
 
 func NewHandler(path string) *Handler {
-	return &Handler{p: path}
+	return &Handler{p: path, lookup: os.LookupEnv}
 }
 
 func (c *Handler) createFromTemplateFile() ([]byte, error) {
@@ -66,15 +98,121 @@ func (c *Handler) Get() (*Root, error) {
 
 	conf = AddDefaults(conf)
 
+	if _, err := ApplyEnv(conf, c.lookup); err != nil {
+		return nil, err
+	}
+
 	return conf, nil
 }
 
-// Save writes the provided config back to disk
+// OnReload registers functions called by Reload when the configuration
+// changes. The configuration currently on disk becomes the applied baseline
+// on first registration.
+func (c *Handler) OnReload(fs ...ReloadFunc) error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	if c.applied == nil {
+		conf, err := c.Get()
+		if err != nil {
+			return err
+		}
+		c.applied = conf
+	}
+	c.reloaders = append(c.reloaders, fs...)
+	return nil
+}
+
+// Reload reads the configuration file, diffs it against the applied one and
+// calls every registered ReloadFunc. Settings that need a restart are
+// reported but still handed over so reloaders may store them. The applied
+// baseline advances even when a reloader fails: the other reloaders applied
+// their part, and re-running them against an older baseline would add
+// torrents twice or miss their removal. The errors are returned for the
+// user to fix the file and reload again.
+func (c *Handler) Reload() (*ReloadResult, error) {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	conf, err := c.Get()
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(conf); err != nil {
+		return nil, err
+	}
+
+	res := &ReloadResult{Changes: []*Change{}, Events: []string{}}
+	if c.applied == nil {
+		c.applied = conf
+		return res, nil
+	}
+
+	res.Changes = Diff(c.applied, conf)
+	if len(res.Changes) == 0 {
+		return res, nil
+	}
+
+	ev := func(e string) { res.Events = append(res.Events, e) }
+	var errs []error
+	for _, f := range c.reloaders {
+		if err := f(c.applied, conf, res.Changes, ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	c.applied = conf
+	if len(errs) != 0 {
+		return res, fmt.Errorf("error applying configuration: %w", errors.Join(errs...))
+	}
+	return res, nil
+}
+
+// Save validates the provided config and writes it back to disk. Settings
+// overridden by the environment keep their value from the file, so secrets
+// resolved from the environment are never persisted.
 func (c *Handler) Save(r *Root) error {
+	if err := Validate(r); err != nil {
+		return err
+	}
 	b, err := yaml.Marshal(r)
 	if err != nil {
 		return fmt.Errorf("error marshaling configuration file: %w", err)
 	}
+
+	out := &Root{}
+	if err := yaml.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("error copying configuration: %w", err)
+	}
+	file := &Root{}
+	if raw, err := ioutil.ReadFile(c.p); err == nil {
+		_ = yaml.Unmarshal(raw, file)
+	}
+	restoreEnv(out, file, c.lookup)
+
+	b, err = yaml.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("error marshaling configuration file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.p), 0744); err != nil {
+		return fmt.Errorf("error creating path for configuration file: %s, %w", c.p, err)
+	}
+	return ioutil.WriteFile(c.p, b, 0644)
+}
+
+// SaveRaw validates the YAML configuration b and writes it to disk as is,
+// keeping its comments and layout.
+func (c *Handler) SaveRaw(b []byte) error {
+	conf := &Root{}
+	if err := yaml.Unmarshal(b, conf); err != nil {
+		return fmt.Errorf("error parsing configuration file: %w", err)
+	}
+	conf = AddDefaults(conf)
+	if _, err := ApplyEnv(conf, c.lookup); err != nil {
+		return err
+	}
+	if err := Validate(conf); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(filepath.Dir(c.p), 0744); err != nil {
 		return fmt.Errorf("error creating path for configuration file: %s, %w", c.p, err)
 	}
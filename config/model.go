@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // Root is the main yaml config object
 type Root struct {
 	HTTPGlobal *HTTPGlobal    `yaml:"http"`
@@ -11,6 +13,8 @@ type Root struct {
 	Health *Health `yaml:"health"`
 
 	Routes []*Route `yaml:"routes"`
+	// SmartFolders are virtual directories mounted next to the routes
+	SmartFolders []*SmartFolder `yaml:"smart_folders,omitempty"`
 }
 
 type Log struct {
@@ -36,11 +40,20 @@ type TorrentGlobal struct {
 	UploadLimitMbit        float64 `yaml:"upload_limit_mbit,omitempty"`
 	ReadaheadMB            int     `yaml:"readahead_mb,omitempty"`
 	ReaderPoolSize         int     `yaml:"reader_pool_size,omitempty"`
+	// IndexBackend selects the database storing the torrent index, badger
+	// (default) or sqlite
+	IndexBackend string `yaml:"index_backend,omitempty"`
 	// Seed gathering: optional list of extra trackers and/or URL to fetch a list
 	ExtraTrackers    []string `yaml:"extra_trackers,omitempty" json:"extra_trackers,omitempty"`
 	ExtraTrackersURL string   `yaml:"extra_trackers_url,omitempty" json:"extra_trackers_url,omitempty"`
 }
 
+// Torrent index backends.
+const (
+	IndexBadger = "badger"
+	IndexSQLite = "sqlite"
+)
+
 type WebDAVGlobal struct {
 	Port int    `yaml:"port"`
 	User string `yaml:"user"`
@@ -67,19 +80,109 @@ type Health struct {
 	GraceMinutes    int  `yaml:"grace_minutes"`
 
 	MinSeeders int `yaml:"min_seeders"`
+	// MinAvailability keeps torrents below min_seeders healthy while the
+	// swarm holds at least this many distributed copies. 0 disables it.
+	MinAvailability float64 `yaml:"min_availability,omitempty" json:"minAvailability,omitempty"`
 
 	GoodSeeders      int `yaml:"good_seeders"`
 	ExcellentSeeders int `yaml:"excellent_seeders"`
 
+	// Actions applied to unhealthy torrents of routes without a policy.
+	// Defaults to blacklist followed by delete.
+	Actions []HealthAction `yaml:"actions,omitempty" json:"actions,omitempty"`
+	// FailureThreshold is the number of consecutive unhealthy checks before
+	// acting. Defaults to 1.
+	FailureThreshold int `yaml:"failure_threshold,omitempty" json:"failureThreshold,omitempty"`
+	// DryRun only logs the actions that would be taken
+	DryRun bool `yaml:"dry_run,omitempty" json:"dryRun,omitempty"`
+	// Policies override actions and threshold per route
+	Policies []*HealthPolicy `yaml:"policies,omitempty" json:"policies,omitempty"`
+	// WindowMinutes is the history looked at by each check. A torrent is
+	// unhealthy when no sample in the window met the minimum and seeders are
+	// not rising. Defaults to 60.
+	WindowMinutes int `yaml:"window_minutes,omitempty" json:"windowMinutes,omitempty"`
+	// HistoryRetentionHours is how long health samples are kept. Defaults
+	// to 168 (one week).
+	HistoryRetentionHours int `yaml:"history_retention_hours,omitempty" json:"historyRetentionHours,omitempty"`
+
 	Arr []*ArrInstance `yaml:"arr"`
 }
 
+type HealthAction string
+
+const (
+	// HealthNotify logs the unhealthy torrent and records a health event
+	HealthNotify HealthAction = "notify"
+	// HealthReannounce adds the extra trackers to the torrent
+	HealthReannounce HealthAction = "reannounce"
+	// HealthTag marks the torrent as unhealthy until it recovers
+	HealthTag HealthAction = "tag"
+	// HealthBlacklist blocklists the release in Arr and searches for another
+	HealthBlacklist HealthAction = "blacklist"
+	// HealthDelete removes the torrent from its route
+	HealthDelete HealthAction = "delete"
+)
+
+var defaultHealthActions = []HealthAction{HealthBlacklist, HealthDelete}
+
+type HealthPolicy struct {
+	Route            string         `yaml:"route" json:"route"`
+	Actions          []HealthAction `yaml:"actions" json:"actions"`
+	FailureThreshold int            `yaml:"failure_threshold,omitempty" json:"failureThreshold,omitempty"`
+}
+
+// Window returns the history period health decisions are based on.
+func (h *Health) Window() time.Duration {
+	if h.WindowMinutes <= 0 {
+		return 60 * time.Minute
+	}
+	return time.Duration(h.WindowMinutes) * time.Minute
+}
+
+// HistoryRetention returns how long health samples are kept.
+func (h *Health) HistoryRetention() time.Duration {
+	if h.HistoryRetentionHours <= 0 {
+		return 168 * time.Hour
+	}
+	return time.Duration(h.HistoryRetentionHours) * time.Hour
+}
+
+// PolicyFor returns the actions and the consecutive failure threshold that
+// apply to unhealthy torrents of route.
+func (h *Health) PolicyFor(route string) ([]HealthAction, int) {
+	actions, threshold := h.Actions, h.FailureThreshold
+	for _, p := range h.Policies {
+		if p.Route != route {
+			continue
+		}
+		if p.Actions != nil {
+			actions = p.Actions
+		}
+		if p.FailureThreshold > 0 {
+			threshold = p.FailureThreshold
+		}
+		break
+	}
+	if actions == nil {
+		actions = defaultHealthActions
+	}
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return actions, threshold
+}
+
 type ArrType string
 
 const (
-	ArrRadarr ArrType = "radarr"
-	ArrSonarr ArrType = "sonarr"
-	ArrLidarr ArrType = "lidarr"
+	ArrRadarr  ArrType = "radarr"
+	ArrSonarr  ArrType = "sonarr"
+	ArrLidarr  ArrType = "lidarr"
+	ArrReadarr ArrType = "readarr"
+	// ArrWhisparr is Whisparr v2, which follows the Sonarr API
+	ArrWhisparr ArrType = "whisparr"
+	// ArrProwlarr searches its indexers for replacement releases
+	ArrProwlarr ArrType = "prowlarr"
 )
 
 type ArrInstance struct {
@@ -89,12 +192,67 @@ type ArrInstance struct {
 	APIKey  string  `yaml:"api_key" json:"api_key"`
 	// Optional: trust invalid TLS certs
 	Insecure bool `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+	// Optional: PEM CA bundle trusted in addition to the system roots
+	CAFile string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`
+	// Optional: PEM client certificate and key for mutual TLS
+	ClientCert string `yaml:"client_cert,omitempty" json:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty" json:"client_key,omitempty"`
+	// Optional: request timeout in seconds, 15 when unset
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty"`
 }
 
 type Route struct {
 	Name          string     `yaml:"name"`
 	Torrents      []*Torrent `yaml:"torrents"`
 	TorrentFolder string     `yaml:"torrent_folder"`
+	// NestedFolders mirrors the subfolders of TorrentFolder as directories of
+	// the route instead of adding every torrent at its root
+	NestedFolders bool    `yaml:"nested_folders,omitempty"`
+	Feeds         []*Feed `yaml:"feeds,omitempty"`
+	// MediaView is the name of a folder mounted next to the routes showing
+	// the files of the route renamed for Plex and Jellyfin
+	MediaView string `yaml:"media_view,omitempty"`
+}
+
+// SmartFolder is a virtual directory holding the files of the routes that
+// match a query. Empty criteria match everything.
+type SmartFolder struct {
+	Name string `yaml:"name"`
+	// Routes restricts the query to some routes, all routes by default
+	Routes []string `yaml:"routes,omitempty"`
+	// Tags selects the torrents having every tag
+	Tags []string `yaml:"tags,omitempty"`
+	// Patterns are globs matched against file names, e.g. "*.mkv"; a file
+	// matching any of them is selected
+	Patterns  []string `yaml:"patterns,omitempty"`
+	MinSizeMB int64    `yaml:"min_size_mb,omitempty"`
+	// AddedWithinDays selects the torrents added in the last days
+	AddedWithinDays int `yaml:"added_within_days,omitempty"`
+	// Video selects video files only
+	Video bool `yaml:"video,omitempty"`
+	// Flatten lists every file at the root of the folder instead of keeping
+	// the directories of the torrents
+	Flatten bool `yaml:"flatten,omitempty"`
+}
+
+// Feed is an RSS, Atom or Torznab feed polled for torrents to add to a route.
+type Feed struct {
+	URL string `yaml:"url" json:"url"`
+	// Include and Exclude are regular expressions matched against item titles
+	Include string `yaml:"include,omitempty" json:"include,omitempty"`
+	Exclude string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+	// MinSizeMB and MaxSizeMB bound the item size, zero means no bound
+	MinSizeMB       int64 `yaml:"min_size_mb,omitempty" json:"min_size_mb,omitempty"`
+	MaxSizeMB       int64 `yaml:"max_size_mb,omitempty" json:"max_size_mb,omitempty"`
+	IntervalMinutes int   `yaml:"interval_minutes,omitempty" json:"interval_minutes,omitempty"`
+}
+
+// Interval returns the polling interval, 15 minutes by default.
+func (f *Feed) Interval() time.Duration {
+	if f.IntervalMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(f.IntervalMinutes) * time.Minute
 }
 
 type Torrent struct {
@@ -0,0 +1,375 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// FieldError is a problem found in a single setting.
+type FieldError struct {
+	// Path is the yaml path of the setting, e.g. "routes[0].torrents[2].magnet_uri"
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError collects every problem found in a configuration.
+type ValidationError struct {
+	Errors []*FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+type validator struct {
+	errs []*FieldError
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) port(path string, p int) {
+	if p < 0 || p > 65535 {
+		v.add(path, "port %d out of range 0-65535", p)
+	}
+}
+
+func (v *validator) nonNegative(path string, n int64) {
+	if n < 0 {
+		v.add(path, "must be >= 0, got %d", n)
+	}
+}
+
+func (v *validator) ip(path, ip string) {
+	if ip != "" && net.ParseIP(ip) == nil {
+		v.add(path, "invalid IP address %q", ip)
+	}
+}
+
+func (v *validator) url(path, raw string, schemes ...string) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		v.add(path, "invalid URL: %v", err)
+		return
+	}
+	for _, s := range schemes {
+		if u.Scheme == s && u.Host != "" {
+			return
+		}
+	}
+	v.add(path, "URL %q must use one of %s", raw, strings.Join(schemes, ", "))
+}
+
+// Validate checks the configuration and returns a *ValidationError listing
+// every invalid setting, or nil. It does not look at the filesystem, see
+// CheckPaths.
+func Validate(r *Root) error {
+	v := &validator{}
+
+	ports := map[int]string{}
+	usePort := func(path string, p int) {
+		v.port(path, p)
+		if p == 0 {
+			return
+		}
+		if other, ok := ports[p]; ok {
+			v.add(path, "port %d already used by %s", p, other)
+			return
+		}
+		ports[p] = path
+	}
+
+	if h := r.HTTPGlobal; h != nil {
+		usePort("http.port", h.Port)
+		v.ip("http.ip", h.IP)
+	}
+
+	if w := r.WebDAV; w != nil {
+		usePort("webdav.port", w.Port)
+	}
+
+	if t := r.Torrent; t != nil {
+		usePort("torrent.listen_port", t.ListenPort)
+		v.ip("torrent.ip", t.IP)
+		v.nonNegative("torrent.add_timeout", int64(t.AddTimeout))
+		v.nonNegative("torrent.read_timeout", int64(t.ReadTimeout))
+		v.nonNegative("torrent.global_cache_size", t.GlobalCacheSize)
+		v.nonNegative("torrent.readahead_mb", int64(t.ReadaheadMB))
+		// 0 selects the default pool size
+		if t.ReaderPoolSize < 0 {
+			v.add("torrent.reader_pool_size", "must be >= 1, or 0 for the default, got %d", t.ReaderPoolSize)
+		}
+		switch t.IndexBackend {
+		case "", IndexBadger, IndexSQLite:
+		default:
+			v.add("torrent.index_backend", "unknown backend %q, expected %s or %s", t.IndexBackend, IndexBadger, IndexSQLite)
+		}
+		if t.DownloadLimitMbit < 0 {
+			v.add("torrent.download_limit_mbit", "must be >= 0")
+		}
+		if t.UploadLimitMbit < 0 {
+			v.add("torrent.upload_limit_mbit", "must be >= 0")
+		}
+		for i, tr := range t.ExtraTrackers {
+			v.url(fmt.Sprintf("torrent.extra_trackers[%d]", i), tr, "udp", "http", "https", "ws", "wss")
+		}
+		if t.ExtraTrackersURL != "" {
+			v.url("torrent.extra_trackers_url", t.ExtraTrackersURL, "http", "https")
+		}
+	}
+
+	if f := r.Fuse; f != nil && strings.TrimSpace(f.Path) == "" {
+		v.add("fuse.path", "required when fuse is enabled")
+	}
+
+	if l := r.Log; l != nil {
+		v.nonNegative("log.max_backups", int64(l.MaxBackups))
+		v.nonNegative("log.max_size", int64(l.MaxSize))
+		v.nonNegative("log.max_age", int64(l.MaxAge))
+	}
+
+	if h := r.Health; h != nil {
+		validateHealth(v, h)
+	}
+
+	validateRoutes(v, r.Routes)
+	validateSmartFolders(v, r.SmartFolders, r.Routes)
+	validateMediaViews(v, r.Routes, r.SmartFolders)
+
+	if len(v.errs) != 0 {
+		return &ValidationError{Errors: v.errs}
+	}
+	return nil
+}
+
+// CheckPaths returns the configured files and folders that cannot be found.
+// A missing path may be a share that is not mounted yet, so they are
+// reported as warnings instead of failing Validate.
+func CheckPaths(r *Root) []*FieldError {
+	v := &validator{}
+	if h := r.Health; h != nil {
+		for i, a := range h.Arr {
+			if a.CAFile != "" {
+				if _, err := os.Stat(a.CAFile); err != nil {
+					v.add(fmt.Sprintf("health.arr[%d].ca_file", i), "%v", err)
+				}
+			}
+		}
+	}
+	for i, rt := range r.Routes {
+		p := fmt.Sprintf("routes[%d]", i)
+		if rt.TorrentFolder != "" {
+			if fi, err := os.Stat(rt.TorrentFolder); err != nil {
+				v.add(p+".torrent_folder", "%v", err)
+			} else if !fi.IsDir() {
+				v.add(p+".torrent_folder", "%s is not a directory", rt.TorrentFolder)
+			}
+		}
+		for j, t := range rt.Torrents {
+			if t.TorrentPath != "" && t.MagnetURI == "" {
+				if _, err := os.Stat(t.TorrentPath); err != nil {
+					v.add(fmt.Sprintf("%s.torrents[%d].torrent_path", p, j), "%v", err)
+				}
+			}
+		}
+	}
+	return v.errs
+}
+
+func validateHealth(v *validator, h *Health) {
+	v.nonNegative("health.interval_minutes", int64(h.IntervalMinutes))
+	v.nonNegative("health.grace_minutes", int64(h.GraceMinutes))
+	v.nonNegative("health.min_seeders", int64(h.MinSeeders))
+	if h.MinAvailability < 0 {
+		v.add("health.min_availability", "must be >= 0")
+	}
+	if h.GoodSeeders != 0 && h.ExcellentSeeders != 0 && h.GoodSeeders > h.ExcellentSeeders {
+		v.add("health.good_seeders", "must not be greater than excellent_seeders")
+	}
+
+	v.nonNegative("health.failure_threshold", int64(h.FailureThreshold))
+	v.nonNegative("health.window_minutes", int64(h.WindowMinutes))
+	v.nonNegative("health.history_retention_hours", int64(h.HistoryRetentionHours))
+	if h.WindowMinutes > 0 && h.HistoryRetentionHours > 0 && h.WindowMinutes > h.HistoryRetentionHours*60 {
+		v.add("health.window_minutes", "must not exceed history_retention_hours")
+	}
+	validateHealthActions(v, "health.actions", h.Actions)
+	routes := map[string]bool{}
+	for i, p := range h.Policies {
+		pp := fmt.Sprintf("health.policies[%d]", i)
+		switch {
+		case p.Route == "":
+			v.add(pp+".route", "required")
+		case routes[p.Route]:
+			v.add(pp+".route", "duplicate policy for route %q", p.Route)
+		}
+		routes[p.Route] = true
+		v.nonNegative(pp+".failure_threshold", int64(p.FailureThreshold))
+		validateHealthActions(v, pp+".actions", p.Actions)
+	}
+
+	names := map[string]bool{}
+	for i, a := range h.Arr {
+		p := fmt.Sprintf("health.arr[%d]", i)
+		if a.Name != "" {
+			if names[a.Name] {
+				v.add(p+".name", "duplicate Arr instance name %q", a.Name)
+			}
+			names[a.Name] = true
+		}
+		switch a.Type {
+		case ArrRadarr, ArrSonarr, ArrLidarr, ArrReadarr, ArrWhisparr, ArrProwlarr:
+		default:
+			v.add(p+".type", "unknown Arr type %q", a.Type)
+		}
+		if a.BaseURL == "" {
+			v.add(p+".base_url", "required")
+		} else {
+			v.url(p+".base_url", a.BaseURL, "http", "https")
+		}
+		if a.APIKey == "" {
+			v.add(p+".api_key", "required")
+		}
+		if (a.ClientCert == "") != (a.ClientKey == "") {
+			v.add(p+".client_cert", "client_cert and client_key must be set together")
+		}
+		v.nonNegative(p+".timeout_seconds", int64(a.TimeoutSeconds))
+	}
+}
+
+func validateHealthActions(v *validator, path string, actions []HealthAction) {
+	for i, a := range actions {
+		switch a {
+		case HealthNotify, HealthReannounce, HealthTag, HealthBlacklist, HealthDelete:
+		default:
+			v.add(fmt.Sprintf("%s[%d]", path, i), "unknown health action %q", a)
+		}
+	}
+}
+
+func validateRoutes(v *validator, routes []*Route) {
+	names := map[string]int{}
+	for i, r := range routes {
+		p := fmt.Sprintf("routes[%d]", i)
+		switch {
+		case strings.TrimSpace(r.Name) == "":
+			v.add(p+".name", "required")
+		case strings.ContainsAny(r.Name, `/\`):
+			v.add(p+".name", "must not contain path separators")
+		default:
+			if j, ok := names[r.Name]; ok {
+				v.add(p+".name", "duplicate route name %q, already used by routes[%d]", r.Name, j)
+			} else {
+				names[r.Name] = i
+			}
+		}
+
+		if r.TorrentFolder == "" && r.NestedFolders {
+			v.add(p+".nested_folders", "requires torrent_folder")
+		}
+
+		for j, f := range r.Feeds {
+			fp := fmt.Sprintf("%s.feeds[%d]", p, j)
+			v.url(fp+".url", f.URL, "http", "https")
+			if _, err := regexp.Compile(f.Include); err != nil {
+				v.add(fp+".include", "invalid regular expression: %v", err)
+			}
+			if _, err := regexp.Compile(f.Exclude); err != nil {
+				v.add(fp+".exclude", "invalid regular expression: %v", err)
+			}
+			v.nonNegative(fp+".min_size_mb", f.MinSizeMB)
+			v.nonNegative(fp+".max_size_mb", f.MaxSizeMB)
+			if f.MaxSizeMB > 0 && f.MinSizeMB > f.MaxSizeMB {
+				v.add(fp+".min_size_mb", "must not be greater than max_size_mb")
+			}
+			v.nonNegative(fp+".interval_minutes", int64(f.IntervalMinutes))
+		}
+
+		for j, t := range r.Torrents {
+			tp := fmt.Sprintf("%s.torrents[%d]", p, j)
+			switch {
+			case t.MagnetURI == "" && t.TorrentPath == "":
+				v.add(tp, "one of magnet_uri or torrent_path is required")
+			case t.MagnetURI != "" && t.TorrentPath != "":
+				v.add(tp, "magnet_uri and torrent_path are mutually exclusive")
+			case t.MagnetURI != "":
+				if _, err := metainfo.ParseMagnetUri(t.MagnetURI); err != nil {
+					v.add(tp+".magnet_uri", "invalid magnet: %v", err)
+				}
+			}
+		}
+	}
+}
+
+func validateSmartFolders(v *validator, folders []*SmartFolder, routes []*Route) {
+	routeNames := map[string]bool{}
+	for _, r := range routes {
+		routeNames[r.Name] = true
+	}
+	names := map[string]int{}
+	for i, f := range folders {
+		p := fmt.Sprintf("smart_folders[%d]", i)
+		switch {
+		case strings.TrimSpace(f.Name) == "":
+			v.add(p+".name", "required")
+		case strings.ContainsAny(f.Name, `/\`):
+			v.add(p+".name", "must not contain path separators")
+		case routeNames[f.Name]:
+			v.add(p+".name", "%q is already used by a route", f.Name)
+		default:
+			if j, ok := names[f.Name]; ok {
+				v.add(p+".name", "duplicate smart folder name %q, already used by smart_folders[%d]", f.Name, j)
+			} else {
+				names[f.Name] = i
+			}
+		}
+		for j, pat := range f.Patterns {
+			if _, err := path.Match(pat, ""); err != nil {
+				v.add(fmt.Sprintf("%s.patterns[%d]", p, j), "invalid pattern: %v", err)
+			}
+		}
+		v.nonNegative(p+".min_size_mb", f.MinSizeMB)
+		v.nonNegative(p+".added_within_days", int64(f.AddedWithinDays))
+	}
+}
+
+func validateMediaViews(v *validator, routes []*Route, folders []*SmartFolder) {
+	taken := map[string]string{}
+	for i, r := range routes {
+		taken[r.Name] = fmt.Sprintf("routes[%d]", i)
+	}
+	for i, f := range folders {
+		taken[f.Name] = fmt.Sprintf("smart_folders[%d]", i)
+	}
+	for i, r := range routes {
+		if r.MediaView == "" {
+			continue
+		}
+		p := fmt.Sprintf("routes[%d].media_view", i)
+		if strings.ContainsAny(r.MediaView, `/\`) {
+			v.add(p, "must not contain path separators")
+			continue
+		}
+		if other, ok := taken[r.MediaView]; ok {
+			v.add(p, "name %q already used by %s", r.MediaView, other)
+			continue
+		}
+		taken[r.MediaView] = p
+	}
+}
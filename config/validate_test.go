@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDefaults(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	require.NoError(Validate(DefaultConfig()))
+	require.NoError(Validate(AddDefaults(&Root{})))
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	r := AddDefaults(&Root{})
+	r.HTTPGlobal.Port = 4444
+	r.WebDAV = &WebDAVGlobal{Port: 4444}
+	r.Torrent.ReadaheadMB = -1
+	r.Torrent.IndexBackend = "postgres"
+	r.Torrent.ReaderPoolSize = -1
+	r.Health.Arr = []*ArrInstance{
+		{Name: "books", Type: ArrReadarr, BaseURL: "https://readarr.lan", APIKey: "key", ClientCert: "client.pem"},
+		{Name: "index", Type: ArrProwlarr, BaseURL: "http://prowlarr:9696", APIKey: "key", TimeoutSeconds: -1},
+	}
+	r.Routes = []*Route{
+		{Name: "movies", Torrents: []*Torrent{{MagnetURI: "magnet:?dn=nohash"}}},
+		{Name: "movies", TorrentFolder: filepath.Join(t.TempDir(), "missing"), MediaView: "recent"},
+		{Name: "tv", Torrents: []*Torrent{{}}, NestedFolders: true, Feeds: []*Feed{{URL: "https://indexer.lan/rss", Include: "(1080p", MinSizeMB: 500, MaxSizeMB: 100}}},
+	}
+	r.SmartFolders = []*SmartFolder{
+		{Name: "tv", Patterns: []string{"*.mkv"}},
+		{Name: "recent", Patterns: []string{"[.mkv"}, AddedWithinDays: -7},
+	}
+
+	err := Validate(r)
+	var ve *ValidationError
+	require.True(errors.As(err, &ve))
+
+	var paths []string
+	for _, fe := range ve.Errors {
+		paths = append(paths, fe.Path)
+	}
+	require.Equal([]string{
+		"webdav.port",
+		"torrent.readahead_mb",
+		"torrent.reader_pool_size",
+		"torrent.index_backend",
+		"health.arr[0].client_cert",
+		"health.arr[1].timeout_seconds",
+		"routes[0].torrents[0].magnet_uri",
+		"routes[1].name",
+		"routes[2].nested_folders",
+		"routes[2].feeds[0].include",
+		"routes[2].feeds[0].min_size_mb",
+		"routes[2].torrents[0]",
+		"smart_folders[0].name",
+		"smart_folders[1].patterns[0]",
+		"smart_folders[1].added_within_days",
+		"routes[1].media_view",
+	}, paths)
+}
+
+func TestCheckPaths(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.torrent")
+	require.NoError(os.WriteFile(file, nil, 0644))
+
+	r := AddDefaults(&Root{})
+	r.Health.Arr = []*ArrInstance{{Name: "tv", Type: ArrSonarr, BaseURL: "http://sonarr:8989", APIKey: "key", CAFile: filepath.Join(dir, "ca.pem")}}
+	r.Routes = []*Route{
+		{Name: "movies", TorrentFolder: filepath.Join(dir, "missing"), Torrents: []*Torrent{{TorrentPath: file}}},
+		{Name: "tv", TorrentFolder: file, Torrents: []*Torrent{{TorrentPath: filepath.Join(dir, "b.torrent")}}},
+	}
+	// missing paths are not validation errors
+	require.NoError(Validate(r))
+
+	var paths []string
+	for _, fe := range CheckPaths(r) {
+		paths = append(paths, fe.Path)
+	}
+	require.Equal([]string{
+		"health.arr[0].ca_file",
+		"routes[0].torrent_folder",
+		"routes[1].torrent_folder",
+		"routes[1].torrents[0].torrent_path",
+	}, paths)
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// reloadDebounce groups bursts of write events (editors usually write a
+// temporary file and rename it) into a single reload.
+const reloadDebounce = 500 * time.Millisecond
+
+// Watcher reloads the configuration whenever the file changes on disk.
+type Watcher struct {
+	ch   *Handler
+	w    *fsnotify.Watcher
+	done chan struct{}
+}
+
+// Watch starts watching the handler configuration file. The parent directory
+// is watched so atomic replaces by editors are also detected.
+func (c *Handler) Watch() (*Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(filepath.Dir(c.p)); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+
+	cw := &Watcher{ch: c, w: w, done: make(chan struct{})}
+	go cw.run()
+
+	log.Info().Str("path", c.p).Msg("configuration watcher started")
+	return cw, nil
+}
+
+func (cw *Watcher) run() {
+	l := log.Logger.With().Str("component", "config").Logger()
+	name := filepath.Clean(cw.ch.p)
+
+	var timer *time.Timer
+	fire := make(chan struct{}, 1)
+	for {
+		select {
+		case event, ok := <-cw.w.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != name || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(reloadDebounce, func() {
+				select {
+				case fire <- struct{}{}:
+				default:
+				}
+			})
+		case <-fire:
+			res, err := cw.ch.Reload()
+			if err != nil {
+				l.Error().Err(err).Msg("error reloading configuration")
+			}
+			if res == nil {
+				continue
+			}
+			for _, e := range res.Events {
+				l.Info().Msg(e)
+			}
+			if rr := res.RestartRequired(); len(rr) != 0 {
+				l.Warn().Strs("settings", rr).Msg("some configuration changes require a restart")
+			}
+		case err, ok := <-cw.w.Errors:
+			if !ok {
+				return
+			}
+			l.Error().Err(err).Msg("configuration watcher error")
+		case <-cw.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+	}
+}
+
+func (cw *Watcher) Close() error {
+	select {
+	case <-cw.done:
+		return nil
+	default:
+		close(cw.done)
+	}
+	return cw.w.Close()
+}
@@ -6,9 +6,11 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/bodgit/sevenzip"
 	"github.com/jkaberg/distribyted/iio"
+	"github.com/jkaberg/distribyted/metrics"
 	"github.com/nwaples/rardecode/v2"
 )
 
@@ -41,6 +43,7 @@ func (fs *Zip) getFiles(reader iio.Reader, size int64) (map[string]*ArchiveFile,
 
 		n := filepath.Join(string(os.PathSeparator), f.Name)
 		af := NewArchiveFile(rf, f.FileInfo().Size())
+		af.name = n
 
 		out[n] = af
 	}
@@ -77,6 +80,7 @@ func (fs *SevenZip) getFiles(reader iio.Reader, size int64) (map[string]*Archive
 
 		af := NewArchiveFile(rf, f.FileInfo().Size())
 		n := filepath.Join(string(os.PathSeparator), f.Name)
+		af.name = n
 
 		out[n] = af
 	}
@@ -112,6 +116,7 @@ func (fs *Rar) getFiles(reader iio.Reader, size int64) (map[string]*ArchiveFile,
 		n := filepath.Join(string(os.PathSeparator), header.Name)
 
 		af := NewArchiveFile(rf, header.UnPackedSize)
+		af.name = n
 
 		out[n] = af
 	}
@@ -196,6 +201,8 @@ type ArchiveFile struct {
 	readerFunc func() (iio.Reader, error)
 	reader     iio.Reader
 	len        int64
+	// name is the path inside the archive, used to trace reads
+	name string
 }
 
 func (d *ArchiveFile) load() error {
@@ -238,6 +245,12 @@ func (d *ArchiveFile) Read(p []byte) (n int, err error) {
 }
 
 func (d *ArchiveFile) ReadAt(p []byte, off int64) (n int, err error) {
+	// loading spools the file out of the archive, so it is part of the trace
+	start := time.Now()
+	defer func() {
+		metrics.TraceRead(&metrics.ReadTrace{Layer: metrics.LayerArchive, Path: d.name, Offset: off, Size: len(p)}, start, n, err)
+	}()
+
 	if err := d.load(); err != nil {
 		return 0, err
 	}
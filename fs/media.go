@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var _ Filesystem = &MediaFs{}
+
+// MediaFs is a read-only view of a route filesystem with the files renamed
+// after their release names, in the layout expected by Plex and Jellyfin.
+// Extras are kept in their folder under the movie or show they belong to.
+// Samples, release notes and files that cannot be parsed are hidden.
+type MediaFs struct {
+	t *Torrent
+
+	mu        sync.Mutex
+	s         *storage
+	built     time.Time
+	originals map[string]string
+}
+
+func NewMediaFs(t *Torrent) *MediaFs {
+	return &MediaFs{t: t}
+}
+
+func (fs *MediaFs) Open(filename string) (File, error) {
+	s, _ := fs.storage()
+	f, err := s.Get(filename)
+	if err != nil {
+		return nil, err
+	}
+	if tf, ok := f.(*torrentFile); ok {
+		return tf.open(), nil
+	}
+	return f, nil
+}
+
+func (fs *MediaFs) ReadDir(path string) (map[string]File, error) {
+	s, _ := fs.storage()
+	return s.Children(path)
+}
+
+// Mapping returns the path in the route filesystem of every file of the
+// view, by path in the view.
+func (fs *MediaFs) Mapping() map[string]string {
+	_, originals := fs.storage()
+	out := make(map[string]string, len(originals))
+	for k, v := range originals {
+		out[k] = v
+	}
+	return out
+}
+
+// storage returns the tree of the view, rebuilt when older than
+// smartRefresh.
+func (fs *MediaFs) storage() (*storage, map[string]string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.s == nil || time.Since(fs.built) > smartRefresh {
+		fs.s, fs.originals = fs.build()
+		fs.built = time.Now()
+	}
+	return fs.s, fs.originals
+}
+
+func (fs *MediaFs) build() (*storage, map[string]string) {
+	s := newStorage(SupportedFactories)
+	s.Clear()
+	originals := make(map[string]string)
+
+	byHash := fs.t.torrentFiles()
+	hashes := make([]string, 0, len(byHash))
+	for h := range byHash {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+	for _, h := range hashes {
+		for _, tf := range byHash[h] {
+			if isMediaClutter(tf.name) {
+				continue
+			}
+			p, ok := mediaPath(tf.name)
+			if !ok {
+				continue
+			}
+			if p = uniquePath(s, p, true); p != "" {
+				_ = s.Add(tf, p)
+				originals[clean(p)] = clean(tf.name)
+			}
+		}
+	}
+	return s, originals
+}
@@ -0,0 +1,59 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMediaFs(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	tfs := newSmartRoute(map[string][]*torrentFile{
+		"h1": {
+			{name: "Show.Name.S01.1080p/Show.Name.S01E01.1080p.mkv", len: 100},
+			{name: "Show.Name.S01.1080p/Show.Name.S01E02.1080p.mkv", len: 100},
+			{name: "Show.Name.S01.1080p/Sample/show.name.s01e01.sample.mkv", len: 10},
+			{name: "Show.Name.S01.1080p/Show.Name.S01.1080p.nfo", len: 1},
+		},
+		"h2": {
+			{name: "Movie.Name.2019.1080p/Movie.Name.2019.1080p.mkv", len: 100},
+			{name: "Movie.Name.2019.1080p/Extras/Behind the scenes.mkv", len: 10},
+			{name: "Movie.Name.2019.1080p/cover.jpg", len: 1},
+		},
+		"h3": {{name: "Some.Documentary.WEBRip/doc.mkv", len: 100}},
+	})
+	mfs := NewMediaFs(tfs)
+
+	files, err := mfs.ReadDir("/")
+	require.NoError(err)
+	// unparsed files are hidden
+	require.Len(files, 2)
+	require.Contains(files, "Show Name")
+	require.Contains(files, "Movie Name (2019)")
+
+	files, err = mfs.ReadDir("/Movie Name (2019)")
+	require.NoError(err)
+	require.Len(files, 2)
+	require.Contains(files, "Extras")
+
+	files, err = mfs.ReadDir("/Show Name/Season 01")
+	require.NoError(err)
+	require.Len(files, 2)
+	require.Contains(files, "Show Name - S01E01.mkv")
+
+	f, err := mfs.Open("/Movie Name (2019)/Movie Name (2019) - 1080p.mkv")
+	require.NoError(err)
+	require.EqualValues(100, f.Size())
+
+	f, err = mfs.Open("/Movie Name (2019)/Extras/Behind the scenes.mkv")
+	require.NoError(err)
+	require.EqualValues(10, f.Size())
+
+	m := mfs.Mapping()
+	require.Len(m, 4)
+	require.Equal("/Movie.Name.2019.1080p/Extras/Behind the scenes.mkv", m["/Movie Name (2019)/Extras/Behind the scenes.mkv"])
+	require.Equal("/Show.Name.S01.1080p/Show.Name.S01E02.1080p.mkv", m["/Show Name/Season 01/Show Name - S01E02.mkv"])
+}
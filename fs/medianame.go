@@ -0,0 +1,230 @@
+package fs
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	episodeRe = regexp.MustCompile(`(?i)(?:^|[ ._\-\[(])s(\d{1,2})[ ._-]?e(\d{1,3})(?:[ ._-]?e(\d{1,3}))?`)
+	// crossRe matches the 1x02 episode style
+	crossRe = regexp.MustCompile(`(?i)(?:^|[ ._\-\[(])(\d{1,2})x(\d{2,3})(?:$|[ ._\-\])])`)
+	// numberRe finds year candidates, checked by years
+	numberRe  = regexp.MustCompile(`\d+`)
+	qualityRe = regexp.MustCompile(`(?i)(?:^|[ ._\-\[(])(2160p|1080p|720p|576p|480p|4k)(?:$|[ ._\-\])])`)
+	// tagRe matches release tags ending the title when there is no year
+	tagRe    = regexp.MustCompile(`(?i)(?:^|[ ._\-\[(])(bluray|blu-ray|bdrip|brrip|web-?dl|webrip|web|hdtv|dvdrip|hdrip|remux|x264|x265|h\.?264|h\.?265|hevc|proper|repack)(?:$|[ ._\-\])])`)
+	groupRe  = regexp.MustCompile(`^\[[^\]]*\][ ._-]*`)
+	sampleRe = regexp.MustCompile(`(?i)(?:^|[ ._\-\[(])sample(?:$|[ ._\-\])])`)
+	langRe   = regexp.MustCompile(`(?i)\.([a-z]{2,3}(?:[.-](?:forced|sdh|cc))?)$`)
+	// extrasRe matches the folders of bonus content
+	extrasRe = regexp.MustCompile(`(?i)^(extras?|featurettes?|behind[ ._]the[ ._]scenes|deleted[ ._]scenes|interviews|trailers|bonus)$`)
+)
+
+// mediaClutter are the extensions hidden from media views.
+var mediaClutter = map[string]bool{
+	".nfo": true, ".txt": true, ".sfv": true, ".md5": true, ".url": true,
+	".exe": true, ".lnk": true, ".db": true,
+}
+
+// subtitleExts are renamed along with the videos they belong to.
+var subtitleExts = map[string]bool{
+	".srt": true, ".ass": true, ".ssa": true, ".sub": true, ".idx": true, ".vtt": true,
+}
+
+// MediaName is what a release name tells about its content.
+type MediaName struct {
+	Title   string
+	Year    int
+	Season  int
+	Episode int
+	// LastEpisode is set for multi-episode files, e.g. S01E01E02
+	LastEpisode int
+	Quality     string
+}
+
+// IsEpisode reports whether the name is an episode of a show.
+func (m *MediaName) IsEpisode() bool {
+	return m.Episode > 0
+}
+
+// ParseMediaName parses a release name such as
+// "Show.Name.2019.S01E02.1080p.WEB-DL.x264-GRP". The title is empty when it
+// cannot be told apart from the tags.
+func ParseMediaName(name string) *MediaName {
+	name = groupRe.ReplaceAllString(name, "")
+	m := &MediaName{}
+	end := len(name)
+	cut := func(loc []int) {
+		if loc != nil && loc[0] < end {
+			end = loc[0]
+		}
+	}
+
+	if loc := episodeRe.FindStringSubmatchIndex(name); loc != nil {
+		m.Season, _ = strconv.Atoi(name[loc[2]:loc[3]])
+		m.Episode, _ = strconv.Atoi(name[loc[4]:loc[5]])
+		if loc[6] >= 0 {
+			m.LastEpisode, _ = strconv.Atoi(name[loc[6]:loc[7]])
+		}
+		cut(loc)
+	} else if loc := crossRe.FindStringSubmatchIndex(name); loc != nil {
+		m.Season, _ = strconv.Atoi(name[loc[2]:loc[3]])
+		m.Episode, _ = strconv.Atoi(name[loc[4]:loc[5]])
+		cut(loc)
+	}
+	// the last year is the release year, titles may hold years too; a year
+	// at the start is the title, e.g. "2012"
+	if locs := years(name); len(locs) > 0 && locs[len(locs)-1][0] > 0 {
+		loc := locs[len(locs)-1]
+		m.Year, _ = strconv.Atoi(name[loc[0]:loc[1]])
+		cut(loc)
+	}
+	if loc := qualityRe.FindStringSubmatchIndex(name); loc != nil {
+		m.Quality = strings.ToLower(name[loc[2]:loc[3]])
+		if m.Quality == "4k" {
+			m.Quality = "2160p"
+		}
+		cut(loc)
+	}
+	cut(tagRe.FindStringIndex(name))
+
+	m.Title = cleanTitle(name[:end])
+	return m
+}
+
+// years returns the location of the delimited numbers of name that can be
+// years.
+func years(name string) [][]int {
+	var out [][]int
+	for _, loc := range numberRe.FindAllStringIndex(name, -1) {
+		if loc[1]-loc[0] != 4 || !strings.HasPrefix(name[loc[0]:], "19") && !strings.HasPrefix(name[loc[0]:], "20") {
+			continue
+		}
+		if loc[0] > 0 && !strings.ContainsRune(" ._-[(", rune(name[loc[0]-1])) {
+			continue
+		}
+		if loc[1] < len(name) && !strings.ContainsRune(" ._-])", rune(name[loc[1]])) {
+			continue
+		}
+		out = append(out, loc)
+	}
+	return out
+}
+
+func cleanTitle(s string) string {
+	s = strings.NewReplacer(".", " ", "_", " ").Replace(s)
+	s = strings.Trim(s, " -([")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// isMediaClutter reports whether the file at the slash-separated path p is
+// hidden from media views: samples and release notes.
+func isMediaClutter(p string) bool {
+	if mediaClutter[strings.ToLower(path.Ext(p))] {
+		return true
+	}
+	for _, part := range strings.Split(p, "/") {
+		if sampleRe.MatchString(strings.TrimSuffix(part, path.Ext(part))) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaPath returns the path of the file at the slash-separated path p in a
+// media view: "Show/Season 01/Show - S01E02.mkv" for episodes and
+// "Movie (2019)/Movie (2019) - 1080p.mkv" for movies. It returns false for
+// files that cannot be placed.
+func mediaPath(p string) (string, bool) {
+	ext := path.Ext(p)
+	lext := strings.ToLower(ext)
+	if !videoExts[lext] && !subtitleExts[lext] {
+		return "", false
+	}
+	base := strings.TrimSuffix(path.Base(p), ext)
+	lang := ""
+	if subtitleExts[lext] {
+		if l := langRe.FindStringSubmatch(base); l != nil {
+			lang = "." + l[1]
+			base = strings.TrimSuffix(base, l[0])
+		}
+	}
+
+	// the outermost extras folder, which may hold others
+	extras := ""
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if extrasRe.MatchString(path.Base(dir)) {
+			extras = dir
+		}
+	}
+	if extras != "" {
+		return extrasPath(p, extras)
+	}
+
+	m := ParseMediaName(base)
+	// file names are often short, e.g. "movie.mkv", the folders tell the rest
+	parseFolders(m, path.Dir(p))
+	if m.Title == "" || !m.IsEpisode() && m.Year == 0 {
+		return "", false
+	}
+
+	if m.IsEpisode() {
+		show := m.Title
+		if m.Year > 0 {
+			show = fmt.Sprintf("%s (%d)", m.Title, m.Year)
+		}
+		ep := fmt.Sprintf("S%02dE%02d", m.Season, m.Episode)
+		if m.LastEpisode > m.Episode {
+			ep += fmt.Sprintf("-E%02d", m.LastEpisode)
+		}
+		return path.Join(show, fmt.Sprintf("Season %02d", m.Season), fmt.Sprintf("%s - %s%s%s", show, ep, lang, lext)), true
+	}
+	movie := fmt.Sprintf("%s (%d)", m.Title, m.Year)
+	name := movie
+	if m.Quality != "" {
+		name += " - " + m.Quality
+	}
+	return path.Join(movie, name+lang+lext), true
+}
+
+// parseFolders completes m, parsed from a file name, with the names of the
+// folders of dir holding the file.
+func parseFolders(m *MediaName, dir string) {
+	named := m.IsEpisode() || m.Year > 0
+	for ; (m.Title == "" || !m.IsEpisode() && m.Year == 0) && dir != "." && dir != "/"; dir = path.Dir(dir) {
+		d := ParseMediaName(path.Base(dir))
+		if d.Title != "" && (m.Title == "" || !named && (d.IsEpisode() || d.Year > 0)) {
+			m.Title = d.Title
+		}
+		if m.Year == 0 {
+			m.Year = d.Year
+		}
+		if m.Season == 0 {
+			m.Season = d.Season
+		}
+		if m.Quality == "" {
+			m.Quality = d.Quality
+		}
+		if !m.IsEpisode() && d.IsEpisode() {
+			m.Episode, m.LastEpisode = d.Episode, d.LastEpisode
+		}
+	}
+}
+
+// extrasPath returns the path of the file at p, below the extras folder dir,
+// in the folder of the movie or show named by the parents of dir, e.g.
+// "Movie (2019)/Featurettes/Making of.mkv". Extras of releases without a
+// year are not placed, as movies cannot be told from shows.
+func extrasPath(p, dir string) (string, bool) {
+	parent := path.Dir(dir)
+	m := &MediaName{}
+	parseFolders(m, parent)
+	if m.Title == "" || m.Year == 0 {
+		return "", false
+	}
+	return path.Join(fmt.Sprintf("%s (%d)", m.Title, m.Year), strings.TrimPrefix(p, parent+"/")), true
+}
@@ -0,0 +1,69 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMediaName(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	cases := []struct {
+		name string
+		want MediaName
+	}{
+		{"Show.Name.S01E02.1080p.WEB-DL.x264-GRP", MediaName{Title: "Show Name", Season: 1, Episode: 2, Quality: "1080p"}},
+		{"Show Name (2019) - S02E10E11 - 720p", MediaName{Title: "Show Name", Year: 2019, Season: 2, Episode: 10, LastEpisode: 11, Quality: "720p"}},
+		{"show_name_3x07_hdtv", MediaName{Title: "show name", Season: 3, Episode: 7}},
+		{"Movie.Name.2019.2160p.UHD.BluRay.x265-GRP", MediaName{Title: "Movie Name", Year: 2019, Quality: "2160p"}},
+		{"[GRP] Blade.Runner.2049.2017.1080p", MediaName{Title: "Blade Runner 2049", Year: 2017, Quality: "1080p"}},
+		{"2012.2009.720p.BluRay", MediaName{Title: "2012", Year: 2009, Quality: "720p"}},
+		{"Some.Documentary.WEBRip", MediaName{Title: "Some Documentary"}},
+	}
+	for _, c := range cases {
+		require.Equal(&c.want, ParseMediaName(c.name), c.name)
+	}
+}
+
+func TestMediaPath(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	cases := []struct {
+		in, want string
+	}{
+		{"Show.Name.S01E02.1080p.WEB-DL/Show.Name.S01E02.1080p.WEB-DL.mkv", "Show Name/Season 01/Show Name - S01E02.mkv"},
+		{"Show.Name.S01.1080p/Show.Name.S01E03.1080p.mkv", "Show Name/Season 01/Show Name - S01E03.mkv"},
+		{"Show.Name.S01.1080p/Subs/Show.Name.S01E03.eng.srt", "Show Name/Season 01/Show Name - S01E03.eng.srt"},
+		{"Show.Name.S01E01E02.720p.mkv/Show.Name.S01E01E02.720p.mkv", "Show Name/Season 01/Show Name - S01E01-E02.mkv"},
+		{"Movie.Name.2019.1080p.BluRay/movie.mkv", "Movie Name (2019)/Movie Name (2019) - 1080p.mkv"},
+		{"Movie.Name.2019.1080p.BluRay/Movie.Name.2019.1080p.BluRay.en.forced.srt", "Movie Name (2019)/Movie Name (2019) - 1080p.en.forced.srt"},
+		{"Movie.Name.2019.1080p.BluRay/Featurettes/Making of.mkv", "Movie Name (2019)/Featurettes/Making of.mkv"},
+		{"Movie.Name.2019.1080p.BluRay/Extras/Deleted Scenes/Scene 1.mkv", "Movie Name (2019)/Extras/Deleted Scenes/Scene 1.mkv"},
+		{"Show.Name.2019.S01.1080p/Behind the Scenes/Episode 1.mkv", "Show Name (2019)/Behind the Scenes/Episode 1.mkv"},
+	}
+	for _, c := range cases {
+		got, ok := mediaPath(c.in)
+		require.True(ok, c.in)
+		require.Equal(c.want, got, c.in)
+	}
+
+	_, ok := mediaPath("Some.Documentary.WEBRip/doc.mkv")
+	require.False(ok)
+	_, ok = mediaPath("Movie.Name.2019.1080p/cover.jpg")
+	require.False(ok)
+	// extras of releases without a year, or at the root of a torrent
+	_, ok = mediaPath("Show.Name.S01.1080p/Extras/Bloopers.mkv")
+	require.False(ok)
+	_, ok = mediaPath("Extras/Bloopers.mkv")
+	require.False(ok)
+
+	require.True(isMediaClutter("Movie.Name.2019/Sample/movie-sample.mkv"))
+	require.True(isMediaClutter("Movie.Name.2019/movie.sample.mkv"))
+	require.True(isMediaClutter("Movie.Name.2019/Movie.Name.2019.nfo"))
+	require.False(isMediaClutter("Movie.Name.2019/Movie.Name.2019.mkv"))
+}
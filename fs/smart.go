@@ -0,0 +1,204 @@
+package fs
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Filesystem = &SmartFs{}
+
+// smartRefresh bounds how often the tree of a smart folder is rebuilt.
+const smartRefresh = 10 * time.Second
+
+// videoExts are the extensions selected by SmartQuery.Video.
+var videoExts = map[string]bool{
+	".mkv": true, ".mp4": true, ".m4v": true, ".avi": true, ".mov": true,
+	".wmv": true, ".mpg": true, ".mpeg": true, ".ts": true, ".m2ts": true,
+	".webm": true, ".flv": true, ".ogv": true,
+}
+
+// SmartQuery selects the files of a smart folder. Zero fields match
+// everything.
+type SmartQuery struct {
+	// Routes restricts the query to some routes
+	Routes []string
+	// Tags selects the torrents having every tag
+	Tags []string
+	// Patterns are globs matched against file names, any must match
+	Patterns    []string
+	MinSize     int64
+	AddedWithin time.Duration
+	Video       bool
+	// Flatten lists every file at the root instead of keeping the
+	// directories of the route
+	Flatten bool
+}
+
+// TorrentInfo describes a torrent for smart folder queries.
+type TorrentInfo struct {
+	Tags    []string
+	AddedAt time.Time
+}
+
+// SmartFs is a read-only view of the files of route filesystems matching a
+// query. Files are shared with the route filesystems, so reads use the same
+// readers and cache.
+type SmartFs struct {
+	q      *SmartQuery
+	routes func() map[string]*Torrent
+	info   func() map[string]*TorrentInfo
+
+	mu    sync.Mutex
+	s     *storage
+	built time.Time
+}
+
+// NewSmartFs returns a smart folder over the route filesystems returned by
+// routes, by route name. info returns the details of the torrents, by hash.
+func NewSmartFs(q *SmartQuery, routes func() map[string]*Torrent, info func() map[string]*TorrentInfo) *SmartFs {
+	return &SmartFs{q: q, routes: routes, info: info}
+}
+
+func (fs *SmartFs) Open(filename string) (File, error) {
+	f, err := fs.storage().Get(filename)
+	if err != nil {
+		return nil, err
+	}
+	if tf, ok := f.(*torrentFile); ok {
+		return tf.open(), nil
+	}
+	return f, nil
+}
+
+func (fs *SmartFs) ReadDir(path string) (map[string]File, error) {
+	return fs.storage().Children(path)
+}
+
+// storage returns the tree of the folder, rebuilt when older than
+// smartRefresh.
+func (fs *SmartFs) storage() *storage {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.s == nil || time.Since(fs.built) > smartRefresh {
+		fs.s, fs.built = fs.build(), time.Now()
+	}
+	return fs.s
+}
+
+func (fs *SmartFs) build() *storage {
+	s := newStorage(SupportedFactories)
+	s.Clear()
+
+	routes := fs.routes()
+	names := make([]string, 0, len(routes))
+	for r := range routes {
+		if len(fs.q.Routes) == 0 || contains(fs.q.Routes, r) {
+			names = append(names, r)
+		}
+	}
+	sort.Strings(names)
+
+	var info map[string]*TorrentInfo
+	if fs.info != nil {
+		info = fs.info()
+	}
+	// seen skips the files of torrents found in several routes
+	seen := make(map[string]bool)
+	for _, r := range names {
+		byHash := routes[r].torrentFiles()
+		hashes := make([]string, 0, len(byHash))
+		for h := range byHash {
+			hashes = append(hashes, h)
+		}
+		sort.Strings(hashes)
+		for _, h := range hashes {
+			if !fs.q.matchTorrent(info[h]) {
+				continue
+			}
+			for _, tf := range byHash[h] {
+				if seen[h+"/"+tf.name] || !fs.q.matchFile(tf.name, tf.len) {
+					continue
+				}
+				seen[h+"/"+tf.name] = true
+				p := tf.name
+				if fs.q.Flatten {
+					p = path.Base(p)
+				}
+				if p = uniquePath(s, p, fs.q.Flatten); p != "" {
+					_ = s.Add(tf, p)
+				}
+			}
+		}
+	}
+	return s
+}
+
+func (q *SmartQuery) matchTorrent(ti *TorrentInfo) bool {
+	if len(q.Tags) == 0 && q.AddedWithin == 0 {
+		return true
+	}
+	if ti == nil {
+		return false
+	}
+	for _, t := range q.Tags {
+		if !contains(ti.Tags, t) {
+			return false
+		}
+	}
+	if q.AddedWithin > 0 && (ti.AddedAt.IsZero() || time.Since(ti.AddedAt) > q.AddedWithin) {
+		return false
+	}
+	return true
+}
+
+func (q *SmartQuery) matchFile(name string, size int64) bool {
+	if size < q.MinSize {
+		return false
+	}
+	base := path.Base(name)
+	if q.Video && !videoExts[strings.ToLower(path.Ext(base))] {
+		return false
+	}
+	if len(q.Patterns) == 0 {
+		return true
+	}
+	for _, p := range q.Patterns {
+		if ok, _ := path.Match(p, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// uniquePath returns p when it is free in s. Taken paths, files of the same
+// name in different torrents, are renamed with a numbered suffix when rename
+// is set and skipped otherwise.
+func uniquePath(s *storage, p string, rename bool) string {
+	if !s.Has(p) {
+		return p
+	}
+	if !rename {
+		return ""
+	}
+	ext := path.Ext(p)
+	stem := strings.TrimSuffix(p, ext)
+	for i := 2; ; i++ {
+		c := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if !s.Has(c) {
+			return c
+		}
+	}
+}
+
+func contains(l []string, v string) bool {
+	for _, e := range l {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSmartRoute(files map[string][]*torrentFile) *Torrent {
+	tfs := NewTorrent(600)
+	for h, fl := range files {
+		tfs.files[h] = fl
+	}
+	return tfs
+}
+
+func TestSmartFs(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	const gb = 1 << 30
+	movies := newSmartRoute(map[string][]*torrentFile{
+		"h1": {
+			{name: "Movie A/movie.a.mkv", len: 2 * gb},
+			{name: "Movie A/sample.mkv", len: 10 << 20},
+			{name: "Movie A/movie.a.nfo", len: 1024},
+		},
+		"h2": {{name: "Movie B/movie.b.mp4", len: 3 * gb}},
+	})
+	tv := newSmartRoute(map[string][]*torrentFile{
+		"h3": {{name: "Show/s01e01.mkv", len: gb}, {name: "Show/sample.mkv", len: 10 << 20}},
+		// same torrent in two routes
+		"h2": {{name: "Movie B/movie.b.mp4", len: 3 * gb}},
+	})
+	routes := func() map[string]*Torrent {
+		return map[string]*Torrent{"movies": movies, "tv": tv}
+	}
+	info := func() map[string]*TorrentInfo {
+		return map[string]*TorrentInfo{
+			"h1": {Tags: []string{"4k", "keep"}, AddedAt: time.Now().Add(-30 * 24 * time.Hour)},
+			"h2": {AddedAt: time.Now().Add(-time.Hour)},
+			"h3": {Tags: []string{"kids"}, AddedAt: time.Now()},
+		}
+	}
+
+	big := NewSmartFs(&SmartQuery{Patterns: []string{"*.mkv"}, MinSize: gb}, routes, info)
+	files, err := big.ReadDir("/")
+	require.NoError(err)
+	require.Len(files, 2)
+	require.Contains(files, "Movie A")
+	require.Contains(files, "Show")
+	files, err = big.ReadDir("/Movie A")
+	require.NoError(err)
+	require.Len(files, 1)
+	require.Contains(files, "movie.a.mkv")
+
+	tagged := NewSmartFs(&SmartQuery{Tags: []string{"keep"}}, routes, info)
+	files, err = tagged.ReadDir("/Movie A")
+	require.NoError(err)
+	require.Len(files, 3)
+
+	recent := NewSmartFs(&SmartQuery{AddedWithin: 7 * 24 * time.Hour, Routes: []string{"movies"}}, routes, info)
+	files, err = recent.ReadDir("/")
+	require.NoError(err)
+	require.Len(files, 1)
+	require.Contains(files, "Movie B")
+
+	videos := NewSmartFs(&SmartQuery{Video: true, Flatten: true}, routes, info)
+	files, err = videos.ReadDir("/")
+	require.NoError(err)
+	require.Len(files, 5)
+	require.Contains(files, "movie.b.mp4")
+	require.Contains(files, "sample.mkv")
+	require.Contains(files, "sample (2).mkv")
+	f, err := videos.Open("/s01e01.mkv")
+	require.NoError(err)
+	require.EqualValues(gb, f.Size())
+}
@@ -0,0 +1,215 @@
+package fs
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// maxReadahead caps the readahead of a fast sequential stream.
+	maxReadahead = 64 * 1024 * 1024
+	// streamBuffer is how much playback time the readahead should cover.
+	streamBuffer = 20 * time.Second
+	// streamRateWarmup is the time a sequential run needs before its rate is
+	// trusted.
+	streamRateWarmup = time.Second
+	// sequentialGap is how far a read may skip forward and still count as
+	// sequential, to tolerate players skipping small chunks.
+	sequentialGap = 1024 * 1024
+)
+
+// stream is a reader with its own access pattern. Sequential reads grow the
+// readahead of the reader to cover streamBuffer at the observed bitrate. The
+// pieces are not prioritised here: the torrent client gives the pieces under
+// each reader the now, next and readahead priorities and moves them when the
+// reader seeks. A seek also shrinks the readahead back to the base value, so
+// the window prefetched for the old position is not carried over.
+type stream struct {
+	// mu serializes the reads of the stream
+	mu sync.Mutex
+	r  reader
+
+	base      int64
+	readahead int64
+	runStart  time.Time
+	closed    bool
+
+	// pos guards the position of the stream, so streamSet can route reads
+	// without waiting for a read in progress
+	pos      sync.Mutex
+	next     int64
+	runBytes int64
+	lastUsed time.Time
+}
+
+func newStream(r reader, base int64) *stream {
+	s := &stream{r: r, base: base, readahead: base}
+	r.SetReadahead(base)
+	return s
+}
+
+// sequential reports whether a read at off continues the current run.
+// s.pos must be held.
+func (s *stream) sequential(off int64) bool {
+	return s.runBytes > 0 && off >= s.next && off-s.next <= sequentialGap
+}
+
+// ReadAt reads from the stream reader, adapting its readahead.
+func (s *stream) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+
+	s.begin(off)
+	n, err := s.r.ReadAt(p, off)
+	s.end(off, n)
+	return n, err
+}
+
+// state returns whether a read at off continues the current run and when
+// the stream was last used.
+func (s *stream) state(off int64) (bool, time.Time) {
+	s.pos.Lock()
+	defer s.pos.Unlock()
+	return s.sequential(off), s.lastUsed
+}
+
+// begin starts a new run when off is not sequential.
+func (s *stream) begin(off int64) {
+	now := time.Now()
+	s.pos.Lock()
+	s.lastUsed = now
+	seq := s.sequential(off)
+	if !seq {
+		s.runBytes = 0
+	}
+	s.pos.Unlock()
+	if seq {
+		return
+	}
+	s.runStart = now
+	s.setReadahead(s.base)
+}
+
+// end accounts n bytes read at off and resizes the readahead.
+func (s *stream) end(off int64, n int) {
+	if n <= 0 {
+		return
+	}
+	s.pos.Lock()
+	s.next = off + int64(n)
+	s.runBytes += int64(n)
+	run := s.runBytes
+	s.pos.Unlock()
+
+	elapsed := time.Since(s.runStart)
+	if elapsed < streamRateWarmup {
+		return
+	}
+	rate := float64(run) / elapsed.Seconds()
+	ra := int64(rate * streamBuffer.Seconds())
+	if ra < s.base {
+		ra = s.base
+	}
+	if ra > maxReadahead {
+		ra = maxReadahead
+	}
+	// skip small changes, each one reprioritises the pieces of the torrent
+	if d := ra - s.readahead; d > -s.readahead/4 && d < s.readahead/4 {
+		return
+	}
+	s.setReadahead(ra)
+}
+
+func (s *stream) setReadahead(ra int64) {
+	if ra == s.readahead {
+		return
+	}
+	s.readahead = ra
+	s.r.SetReadahead(ra)
+}
+
+func (s *stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.r.Close()
+}
+
+// streamSet routes reads to the stream whose run they continue. Other reads
+// open a new stream, or seek the least recently used one once max streams
+// are open. Routing never waits for the reads in progress, so a stalled
+// read only blocks the reads going to its stream. A closed set does not open
+// streams anymore.
+type streamSet struct {
+	mu     sync.Mutex
+	list   []*stream
+	max    int
+	open   func() *stream
+	closed bool
+}
+
+func newStreamSet(max int, open func() *stream) *streamSet {
+	if max <= 0 {
+		max = 4
+	}
+	return &streamSet{max: max, open: open}
+}
+
+func (ss *streamSet) get(off int64) (*stream, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.closed {
+		return nil, os.ErrClosed
+	}
+
+	var lru *stream
+	var lruUsed time.Time
+	for _, s := range ss.list {
+		seq, used := s.state(off)
+		if seq {
+			return s, nil
+		}
+		if lru == nil || used.Before(lruUsed) {
+			lru, lruUsed = s, used
+		}
+	}
+
+	if len(ss.list) < ss.max || lru == nil {
+		s := ss.open()
+		ss.list = append(ss.list, s)
+		return s, nil
+	}
+	return lru, nil
+}
+
+func (ss *streamSet) ReadAt(p []byte, off int64) (int, error) {
+	s, err := ss.get(off)
+	if err != nil {
+		return 0, err
+	}
+	return s.ReadAt(p, off)
+}
+
+func (ss *streamSet) Close() error {
+	ss.mu.Lock()
+	ss.closed = true
+	list := ss.list
+	ss.list = nil
+	ss.mu.Unlock()
+
+	// closing waits for the reads in progress
+	var err error
+	for _, s := range list {
+		if cerr := s.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReader struct {
+	readahead []int64
+}
+
+func (r *fakeReader) Read(p []byte) (int, error)                           { return len(p), nil }
+func (r *fakeReader) ReadContext(_ context.Context, p []byte) (int, error) { return len(p), nil }
+func (r *fakeReader) ReadAt(p []byte, off int64) (int, error)              { return len(p), nil }
+func (r *fakeReader) Close() error                                         { return nil }
+func (r *fakeReader) SetReadahead(n int64)                                 { r.readahead = append(r.readahead, n) }
+func (r *fakeReader) last() int64                                          { return r.readahead[len(r.readahead)-1] }
+
+func TestStreamReadahead(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	fr := &fakeReader{}
+	s := newStream(fr, 1024)
+	require.Equal(int64(1024), fr.last())
+
+	buf := make([]byte, 4096)
+	_, err := s.ReadAt(buf, 0)
+	require.NoError(err)
+	require.True(s.sequential(4096))
+	require.False(s.sequential(0))
+
+	// 1 MiB read over two seconds asks for 10 MiB of readahead
+	s.runStart = time.Now().Add(-2 * time.Second)
+	s.runBytes = 1024*1024 - 4096
+	_, err = s.ReadAt(buf, 4096)
+	require.NoError(err)
+	require.InDelta(float64(10*1024*1024), float64(fr.last()), 256*1024)
+
+	// a seek cancels the readahead
+	_, err = s.ReadAt(buf, 100*1024*1024)
+	require.NoError(err)
+	require.Equal(int64(1024), fr.last())
+	require.Equal(int64(100*1024*1024+4096), s.next)
+}
+
+func TestStreamSeekReadahead(t *testing.T) {
+	t.Parallel()
+
+	buf := make([]byte, 64*1024)
+	tests := []struct {
+		name   string
+		off    int64
+		shrink bool
+	}{
+		{name: "continue", off: 8 << 20},
+		{name: "small skip", off: 8<<20 + sequentialGap},
+		{name: "forward seek", off: 8<<20 + sequentialGap + 1, shrink: true},
+		{name: "backward seek", off: 4 << 20, shrink: true},
+		{name: "rewind", off: 0, shrink: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require := require.New(t)
+
+			fr := &fakeReader{}
+			s := newStream(fr, 1024*1024)
+			// a run of 8 MiB over two seconds grows the readahead
+			s.runStart = time.Now().Add(-2 * time.Second)
+			s.runBytes = 8<<20 - int64(len(buf))
+			s.next = 8<<20 - int64(len(buf))
+			_, err := s.ReadAt(buf, s.next)
+			require.NoError(err)
+			grown := fr.last()
+			require.Greater(grown, int64(1024*1024))
+
+			_, err = s.ReadAt(buf, tt.off)
+			require.NoError(err)
+			if tt.shrink {
+				require.Equal(int64(1024*1024), fr.last())
+				require.Equal(int64(len(buf)), s.runBytes)
+			} else {
+				require.GreaterOrEqual(fr.last(), grown*3/4)
+			}
+		})
+	}
+}
+
+func TestStreamSet(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	var opened []*fakeReader
+	ss := newStreamSet(2, func() *stream {
+		fr := &fakeReader{}
+		opened = append(opened, fr)
+		return newStream(fr, 1024)
+	})
+
+	get := func(off int64) *stream {
+		s, err := ss.get(off)
+		require.NoError(err)
+		return s
+	}
+
+	buf := make([]byte, 4096)
+	a := get(0)
+	_, err := a.ReadAt(buf, 0)
+	require.NoError(err)
+	require.Same(a, get(4096))
+
+	// a read elsewhere opens a second stream instead of seeking the first
+	b := get(1 << 30)
+	require.NotSame(a, b)
+	_, err = b.ReadAt(buf, 1<<30)
+	require.NoError(err)
+	require.Len(opened, 2)
+
+	// once full, the least recently used stream is reused
+	require.Same(a, get(1<<20))
+	require.Len(opened, 2)
+
+	require.NoError(ss.Close())
+	require.Empty(ss.list)
+
+	// a closed set does not open streams
+	_, err = ss.get(0)
+	require.ErrorIs(err, os.ErrClosed)
+	_, err = a.ReadAt(buf, 8192)
+	require.ErrorIs(err, os.ErrClosed)
+	require.Len(opened, 2)
+}
+
+// blockingReader is a fakeReader whose reads wait for release.
+type blockingReader struct {
+	fakeReader
+	release chan struct{}
+}
+
+func (r *blockingReader) ReadAt(p []byte, off int64) (int, error) {
+	<-r.release
+	return len(p), nil
+}
+
+func TestStreamSetStalledRead(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	stalled := &blockingReader{release: make(chan struct{})}
+	opened := 0
+	ss := newStreamSet(2, func() *stream {
+		opened++
+		if opened == 1 {
+			return newStream(stalled, 1024)
+		}
+		return newStream(&fakeReader{}, 1024)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = ss.ReadAt(make([]byte, 4096), 0)
+	}()
+	require.Eventually(func() bool {
+		ss.mu.Lock()
+		defer ss.mu.Unlock()
+		return len(ss.list) == 1
+	}, time.Second, time.Millisecond)
+
+	// a read elsewhere is served while the first one waits
+	read := make(chan error, 1)
+	go func() {
+		_, err := ss.ReadAt(make([]byte, 4096), 1<<30)
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		require.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read blocked by a stalled stream")
+	}
+
+	close(stalled.release)
+	<-done
+	require.NoError(ss.Close())
+}
@@ -2,14 +2,19 @@ package fs
 
 import (
 	"context"
+	"errors"
 	"io"
+	"os"
 	"path"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/missinggo/v2"
 	"github.com/anacrolix/torrent"
 	"github.com/jkaberg/distribyted/iio"
+	"github.com/jkaberg/distribyted/metrics"
 )
 
 var _ Filesystem = &Torrent{}
@@ -24,6 +29,10 @@ type Torrent struct {
 	readahead   int64
 	// registered tracks torrents already registered into storage by hash
 	registered map[string]bool
+	// dirs holds the directory of the torrents not added at the root, by hash
+	dirs map[string]string
+	// files holds the registered files, by hash, for smart folders
+	files map[string][]*torrentFile
 }
 
 func NewTorrent(readTimeout int) *Torrent {
@@ -34,6 +43,8 @@ func NewTorrent(readTimeout int) *Torrent {
 		poolSize:    4,
 		readahead:   2 * 1024 * 1024,
 		registered:  make(map[string]bool),
+		dirs:        make(map[string]string),
+		files:       make(map[string][]*torrentFile),
 	}
 }
 
@@ -55,11 +66,46 @@ func (fs *Torrent) SetReadaheadBytes(b int64) {
 	fs.mu.Unlock()
 }
 
+// SetReadTimeout changes the read timeout in seconds. Files are registered
+// again on next access so the new value also applies to known files; handles
+// that are already open keep the previous timeout.
+func (fs *Torrent) SetReadTimeout(seconds int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.readTimeout == seconds {
+		return
+	}
+	fs.readTimeout = seconds
+	fs.s.Clear()
+	fs.loaded = false
+	fs.registered = make(map[string]bool)
+	fs.files = make(map[string][]*torrentFile)
+}
+
 func (fs *Torrent) AddTorrent(t *torrent.Torrent) {
+	fs.AddTorrentAt(t, "")
+}
+
+// AddTorrentAt adds t with its files under the slash-separated directory dir
+// of the filesystem. A torrent already added is moved to dir.
+func (fs *Torrent) AddTorrentAt(t *torrent.Torrent, dir string) {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	h := t.InfoHash().HexString()
+
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
+	if fs.registered[h] && fs.dirs[h] != dir {
+		fs.s.Clear()
+		fs.registered = make(map[string]bool)
+		fs.files = make(map[string][]*torrentFile)
+	}
+	if dir == "" {
+		delete(fs.dirs, h)
+	} else {
+		fs.dirs[h] = dir
+	}
 	fs.loaded = false
-	fs.ts[t.InfoHash().HexString()] = t
+	fs.ts[h] = t
 }
 
 func (fs *Torrent) RemoveTorrent(h string) {
@@ -72,6 +118,8 @@ func (fs *Torrent) RemoveTorrent(h string) {
 
 	delete(fs.ts, h)
 	delete(fs.registered, h)
+	delete(fs.dirs, h)
+	delete(fs.files, h)
 }
 
 func (fs *Torrent) load() {
@@ -93,28 +141,52 @@ func (fs *Torrent) load() {
 			rootName = t.Info().Name
 		}
 
+		var tfs []*torrentFile
 		for _, file := range files {
-			_ = fs.s.Add(&torrentFile{
+			p := file.Path()
+			if wrapInRoot {
+				p = path.Join(rootName, p)
+			}
+			p = path.Join(fs.dirs[h], p)
+			tf := &torrentFile{
 				readerFunc:     file.NewReader,
+				file:           file,
+				name:           p,
 				len:            file.Length(),
 				timeout:        fs.readTimeout,
 				poolTarget:     fs.poolSize,
 				readaheadBytes: fs.readahead,
-			}, func() string {
-				p := file.Path()
-				if wrapInRoot {
-					return path.Join(rootName, p)
-				}
-				return p
-			}())
+			}
+			_ = fs.s.Add(tf, p)
+			tfs = append(tfs, tf)
 		}
+		fs.files[h] = tfs
 		fs.registered[h] = true
 	}
 }
 
+// torrentFiles returns the files of the loaded torrents, by hash.
+func (fs *Torrent) torrentFiles() map[string][]*torrentFile {
+	fs.load()
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	out := make(map[string][]*torrentFile, len(fs.files))
+	for h, tfs := range fs.files {
+		out[h] = tfs
+	}
+	return out
+}
+
 func (fs *Torrent) Open(filename string) (File, error) {
 	fs.load()
-	return fs.s.Get(filename)
+	f, err := fs.s.Get(filename)
+	if err != nil {
+		return nil, err
+	}
+	if tf, ok := f.(*torrentFile); ok {
+		return tf.open(), nil
+	}
+	return f, nil
 }
 
 func (fs *Torrent) ReadDir(path string) (map[string]File, error) {
@@ -125,6 +197,7 @@ func (fs *Torrent) ReadDir(path string) (map[string]File, error) {
 type reader interface {
 	iio.Reader
 	missinggo.ReadContexter
+	SetReadahead(int64)
 }
 
 type readAtWrapper struct {
@@ -157,11 +230,13 @@ func readAtLeast(r missinggo.ReadContexter, timeout int, buf []byte, min int) (n
 	}
 	for n < min && err == nil {
 		var nn int
+		var timedOut atomic.Bool
 
 		ctx, cancel := context.WithCancel(context.Background())
 		timer := time.AfterFunc(
 			time.Duration(timeout)*time.Second,
 			func() {
+				timedOut.Store(true)
 				cancel()
 			},
 		)
@@ -170,6 +245,9 @@ func readAtLeast(r missinggo.ReadContexter, timeout int, buf []byte, min int) (n
 		n += nn
 
 		timer.Stop()
+		if err != nil && timedOut.Load() {
+			metrics.ReadTimeout()
+		}
 	}
 	if n >= min {
 		err = nil
@@ -187,43 +265,86 @@ func (rw *readAtWrapper) Close() error {
 
 var _ File = &torrentFile{}
 
+// torrentFile is a file of a torrent as listed in the filesystem. Open hands
+// out a torrentHandle per consumer, with its own readers and readahead.
+// Reads made on the torrentFile itself, for example by archive listings, go
+// to a shared set of readers that is closed with the last handle.
 type torrentFile struct {
 	readerFunc func() torrent.Reader
-	reader     reader
-	pool       chan reader
-	poolInit   sync.Once
-	poolAll    []reader
+	// file and name are used to trace reads, file may be nil
+	file *torrent.File
+	name string
+
+	mu     sync.Mutex
+	reader reader
+	shared *streamSet
+	// handles is the number of open handles
+	handles int
+
+	// poolTarget is the maximum number of readers per handle
 	poolTarget int
 	len        int64
 	timeout    int
-	// readahead
+	// readaheadBytes is the base readahead of every reader
 	readaheadBytes int64
 }
 
-func (d *torrentFile) load() {
-	if d.reader != nil {
-		return
+// load returns the shared readers, creating them when none are open.
+func (d *torrentFile) load() (reader, *streamSet) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.setDefaults()
+	if d.reader == nil {
+		d.reader = newReadAtWrapper(d.readerFunc(), d.timeout)
+		d.reader.SetReadahead(d.readaheadBytes)
+		d.shared = d.newStreamSet()
 	}
-	d.reader = newReadAtWrapper(d.readerFunc(), d.timeout)
-	// initialize pool lazily
-	d.poolInit.Do(func() {
-		size := d.poolTarget
-		if size <= 0 {
-			size = 4
-		}
-		d.pool = make(chan reader, size)
-		for i := 0; i < size; i++ {
-			pr := newReadAtWrapper(d.readerFunc(), d.timeout)
-			d.poolAll = append(d.poolAll, pr)
-			d.pool <- pr
-		}
-		// default if not set
-		if d.readaheadBytes == 0 {
-			d.readaheadBytes = 2 * 1024 * 1024
-		}
+	return d.reader, d.shared
+}
+
+// setDefaults sets the settings left unset. d.mu must be held.
+func (d *torrentFile) setDefaults() {
+	if d.readaheadBytes == 0 {
+		d.readaheadBytes = 2 * 1024 * 1024
+	}
+}
+
+// newStreamSet returns a set of readers of the file. d.mu must be held.
+func (d *torrentFile) newStreamSet() *streamSet {
+	base := d.readaheadBytes
+	return newStreamSet(d.poolTarget, func() *stream {
+		return newStream(newReadAtWrapper(d.readerFunc(), d.timeout), base)
 	})
 }
 
+// open returns a new handle. Its readers are created on the first read, so
+// handles opened only to stat the file stay cheap.
+func (d *torrentFile) open() *torrentHandle {
+	return &torrentHandle{f: d}
+}
+
+// acquire registers a handle and returns its readers. The shared readers
+// are left closed until the file itself is read.
+func (d *torrentFile) acquire() *streamSet {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handles++
+	d.setDefaults()
+	return d.newStreamSet()
+}
+
+// release drops a handle, closing the shared readers after the last one.
+func (d *torrentFile) release() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handles--
+	if d.handles > 0 {
+		return
+	}
+	d.handles = 0
+	d.closeShared()
+}
+
 func (d *torrentFile) Size() int64 {
 	return d.len
 }
@@ -232,26 +353,32 @@ func (d *torrentFile) IsDir() bool {
 	return false
 }
 
+// Close closes the shared readers. Open handles keep their own readers.
 func (d *torrentFile) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closeShared()
+}
+
+func (d *torrentFile) closeShared() error {
 	var err error
 	if d.reader != nil {
 		err = d.reader.Close()
 	}
-
 	d.reader = nil
 
-	// close pooled readers
-	for _, r := range d.poolAll {
-		_ = r.Close()
+	if d.shared != nil {
+		if serr := d.shared.Close(); serr != nil && err == nil {
+			err = serr
+		}
 	}
-	d.poolAll = nil
-	d.pool = nil
+	d.shared = nil
 
 	return err
 }
 
 func (d *torrentFile) Read(p []byte) (n int, err error) {
-	d.load()
+	r, _ := d.load()
 	ctx, cancel := context.WithCancel(context.Background())
 	timer := time.AfterFunc(
 		time.Duration(d.timeout)*time.Second,
@@ -261,64 +388,147 @@ func (d *torrentFile) Read(p []byte) (n int, err error) {
 	)
 
 	defer timer.Stop()
-	n, err = d.reader.ReadContext(ctx, p)
-	if n > 0 && err == nil {
-		d.prefetch(int64(n))
+	return r.ReadContext(ctx, p)
+}
+
+func (d *torrentFile) ReadAt(p []byte, off int64) (n int, err error) {
+	_, ss := d.load()
+	n, err = d.readAt(ss, p, off)
+	if errors.Is(err, os.ErrClosed) {
+		// the last handle closed the shared readers meanwhile
+		_, ss = d.load()
+		n, err = d.readAt(ss, p, off)
 	}
 	return n, err
 }
 
-func (d *torrentFile) ReadAt(p []byte, off int64) (n int, err error) {
-	d.load()
-	// Use pooled readers to allow concurrent ReadAt calls
-	if d.pool != nil {
-		r := <-d.pool
-		// Ensure reader is returned to pool
-		defer func() { d.pool <- r }()
-		n, err = r.ReadAt(p, off)
-		if n > 0 && err == nil {
-			d.prefetchAt(off + int64(n))
+// readAt reads from ss, tracing the read. The pieces blocking the read are
+// only looked up once it is slower than metrics.SlowReadThreshold.
+func (d *torrentFile) readAt(ss *streamSet, p []byte, off int64) (n int, err error) {
+	tr := &metrics.ReadTrace{Layer: metrics.LayerTorrent, Path: d.name, Offset: off, Size: len(p)}
+	start := time.Now()
+	if d.file == nil {
+		defer func() { metrics.TraceRead(tr, start, n, err) }()
+		return ss.ReadAt(p, off)
+	}
+
+	var blocking []int
+	slow := make(chan struct{})
+	timer := time.AfterFunc(metrics.SlowReadThreshold, func() {
+		blocking = d.incompletePieces(off, len(p))
+		close(slow)
+	})
+	defer func() {
+		if !timer.Stop() {
+			<-slow
+			complete := len(blocking) == 0
+			tr.BlockingPieces, tr.Complete = blocking, &complete
 		}
-		return n, err
+		metrics.TraceRead(tr, start, n, err)
+	}()
+
+	return ss.ReadAt(p, off)
+}
+
+// incompletePieces returns the indices of the pieces covering size bytes at
+// off that are not complete yet.
+func (d *torrentFile) incompletePieces(off int64, size int) []int {
+	t := d.file.Torrent()
+	info := t.Info()
+	if info == nil || info.PieceLength <= 0 || size <= 0 {
+		return nil
 	}
-	n, err = d.reader.ReadAt(p, off)
-	if n > 0 && err == nil {
-		d.prefetchAt(off + int64(n))
+	end := off + int64(size)
+	if end > d.len {
+		end = d.len
 	}
-	return n, err
+	if end <= off {
+		return nil
+	}
+	begin := d.file.Offset() + off
+	first := int(begin / info.PieceLength)
+	last := int((d.file.Offset() + end - 1) / info.PieceLength)
+	var out []int
+	for i := first; i <= last && i < t.NumPieces(); i++ {
+		if !t.PieceState(i).Complete {
+			out = append(out, i)
+		}
+	}
+	return out
 }
 
-// prefetch issues an asynchronous read of the next window after current sequential read.
-func (d *torrentFile) prefetch(bytesRead int64) {
-	// Estimate the next offset as current position; we don't have explicit pos here,
-	// so only use ReadAt-based prefetch which passes explicit offsets.
+var _ File = &torrentHandle{}
+
+// torrentHandle is an open torrentFile owned by a single consumer.
+type torrentHandle struct {
+	f *torrentFile
+
+	mu      sync.Mutex
+	streams *streamSet
+	pos     int64
+	closed  bool
 }
 
-func (d *torrentFile) prefetchAt(nextOff int64) {
-	if d.readaheadBytes <= 0 || d.pool == nil {
-		return
+func (h *torrentHandle) Size() int64 {
+	return h.f.Size()
+}
+
+func (h *torrentHandle) IsDir() bool {
+	return false
+}
+
+// load creates the readers of the handle on first use.
+func (h *torrentHandle) load() (*streamSet, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, os.ErrClosed
 	}
-	// pull a reader without blocking the foreground if none available
-	select {
-	case r := <-d.pool:
-		go func(rd reader) {
-			defer func() { d.pool <- rd }()
-			bufSize := int(d.readaheadBytes)
-			if nextOff >= d.len {
-				return
-			}
-			if remain := d.len - nextOff; remain < int64(bufSize) {
-				bufSize = int(remain)
-			}
-			if bufSize <= 0 {
-				return
-			}
-			buf := make([]byte, bufSize)
-			_, _ = rd.ReadAt(buf, nextOff)
-		}(r)
-	default:
-		// no spare reader; skip prefetch
+	if h.streams == nil {
+		h.streams = h.f.acquire()
+	}
+	return h.streams, nil
+}
+
+func (h *torrentHandle) Read(p []byte) (int, error) {
+	h.mu.Lock()
+	off := h.pos
+	h.mu.Unlock()
+
+	if off >= h.f.len {
+		return 0, io.EOF
+	}
+	if remain := h.f.len - off; int64(len(p)) > remain {
+		p = p[:remain]
 	}
+	n, err := h.ReadAt(p, off)
+
+	h.mu.Lock()
+	h.pos = off + int64(n)
+	h.mu.Unlock()
+	return n, err
 }
 
-// (Removed stub/lazy materialization; original load-based behavior restored)
+func (h *torrentHandle) ReadAt(p []byte, off int64) (int, error) {
+	ss, err := h.load()
+	if err != nil {
+		return 0, err
+	}
+	return h.f.readAt(ss, p, off)
+}
+
+func (h *torrentHandle) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	if h.streams == nil {
+		return nil
+	}
+	err := h.streams.Close()
+	h.streams = nil
+	h.f.release()
+	return err
+}
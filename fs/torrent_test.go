@@ -1,10 +1,18 @@
 package fs
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
 
 	"github.com/stretchr/testify/require"
 )
@@ -138,3 +146,157 @@ func TestReadAtWrapper(t *testing.T) {
 	require.Equal(5, n)
 	require.Equal([]byte{0x49, 0x44, 0x33, 0x3, 0x0}, toRead)
 }
+
+// memReader is a torrent.Reader over a byte slice.
+type memReader struct {
+	mu     sync.Mutex
+	r      *bytes.Reader
+	closed bool
+}
+
+func (r *memReader) SetContext(context.Context)             {}
+func (r *memReader) SetReadahead(int64)                     {}
+func (r *memReader) SetReadaheadFunc(torrent.ReadaheadFunc) {}
+func (r *memReader) SetResponsive()                         {}
+
+func (r *memReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	return r.r.Read(p)
+}
+
+func (r *memReader) ReadContext(_ context.Context, p []byte) (int, error) {
+	return r.Read(p)
+}
+
+func (r *memReader) Seek(off int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Seek(off, whence)
+}
+
+func (r *memReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func TestTorrentFileHandles(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	tf := &torrentFile{
+		readerFunc: func() torrent.Reader { return &memReader{r: bytes.NewReader(data)} },
+		len:        int64(len(data)),
+		timeout:    10,
+	}
+
+	buf := make([]byte, 10)
+	a, b := tf.open(), tf.open()
+	_, err := a.ReadAt(buf, 0)
+	require.NoError(err)
+	_, err = b.ReadAt(buf, 10)
+	require.NoError(err)
+	// reading handles leaves the shared readers, and their priorities, unset
+	tf.mu.Lock()
+	require.Nil(tf.reader)
+	tf.mu.Unlock()
+	_, err = tf.Read(buf)
+	require.NoError(err)
+
+	require.NoError(a.Close())
+	n, err := b.ReadAt(buf, 20)
+	require.NoError(err)
+	require.Equal(data[20:30], buf[:n])
+	_, err = tf.Read(buf)
+	require.NoError(err)
+	_, err = tf.ReadAt(buf, 30)
+	require.NoError(err)
+
+	// the last handle closes the shared readers, the file reopens them
+	require.NoError(b.Close())
+	n, err = tf.Read(buf)
+	require.NoError(err)
+	require.Equal(data[:10], buf[:n])
+	n, err = tf.ReadAt(buf, 40)
+	require.NoError(err)
+	require.Equal(data[40:50], buf[:n])
+	_, err = b.ReadAt(buf, 0)
+	require.ErrorIs(err, os.ErrClosed)
+
+	// handles closed while the shared file is read
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h := tf.open()
+				_, _ = h.ReadAt(make([]byte, 10), int64(j*10))
+				_ = h.Close()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			p := make([]byte, 10)
+			for j := 0; j < 100; j++ {
+				if _, err := tf.ReadAt(p, int64(j*10)); err != nil && !errors.Is(err, os.ErrClosed) {
+					t.Error(err)
+				}
+				if _, err := tf.Read(p); err != nil && !errors.Is(err, os.ErrClosed) && err != io.EOF {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(tf.Close())
+}
+
+func TestTorrentAddTorrentAt(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	data := filepath.Join(t.TempDir(), "Movie (2019)")
+	require.NoError(os.MkdirAll(data, 0744))
+	require.NoError(os.WriteFile(filepath.Join(data, "movie.mkv"), []byte(t.Name()), 0644))
+	require.NoError(os.WriteFile(filepath.Join(data, "movie.srt"), nil, 0644))
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(info.BuildFromFilePath(data))
+	ib, err := bencode.Marshal(info)
+	require.NoError(err)
+	to, err := Cli.AddTorrent(&metainfo.MetaInfo{InfoBytes: ib})
+	require.NoError(err)
+	defer to.Drop()
+
+	tfs := NewTorrent(600)
+	tfs.AddTorrentAt(to, "movies/4k")
+	files, err := tfs.ReadDir("/movies/4k")
+	require.NoError(err)
+	require.Contains(files, "Movie (2019)")
+	f, err := tfs.Open("/movies/4k/Movie (2019)/movie.mkv")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	// moving the torrent drops the old directory
+	tfs.AddTorrentAt(to, "/movies/")
+	files, err = tfs.ReadDir("/movies")
+	require.NoError(err)
+	require.Contains(files, "Movie (2019)")
+	require.NotContains(files, "4k")
+	_, err = tfs.Open("/movies/4k/Movie (2019)/movie.mkv")
+	require.Equal(os.ErrNotExist, err)
+
+	tfs.AddTorrent(to)
+	files, err = tfs.ReadDir("/")
+	require.NoError(err)
+	require.Len(files, 1)
+	require.Contains(files, "Movie (2019)")
+}
@@ -1,6 +1,7 @@
 package fuse
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -15,6 +16,7 @@ type Handler struct {
 	path           string
 
 	host *fuse.FileSystemHost
+	fs   *FS
 }
 
 func NewHandler(fuseAllowOther bool, path string) *Handler {
@@ -37,7 +39,8 @@ func (s *Handler) Mount(cfs *fs.ContainerFs) error {
 		}
 	}
 
-	host := fuse.NewFileSystemHost(NewFS(cfs))
+	s.fs = newFS(cfs)
+	host := fuse.NewFileSystemHost(s.fs)
 
 	go func() {
 		var config []string
@@ -76,6 +79,15 @@ func (s *Handler) Mount(cfs *fs.ContainerFs) error {
 	return nil
 }
 
+// Drain rejects new opens on the mount and waits for in-flight reads to
+// complete or ctx to expire.
+func (s *Handler) Drain(ctx context.Context) error {
+	if s.fs == nil {
+		return nil
+	}
+	return s.fs.Drain(ctx)
+}
+
 func (s *Handler) Unmount() {
 	if s.host == nil {
 		return
@@ -1,15 +1,18 @@
 package fuse
 
 import (
+	"context"
 	"errors"
 	"io"
 	"math"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/billziss-gh/cgofuse/fuse"
 	"github.com/jkaberg/distribyted/fs"
+	"github.com/jkaberg/distribyted/metrics"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -19,9 +22,17 @@ type FS struct {
 	fh *fileHandler
 
 	log zerolog.Logger
+
+	// active counts in-flight reads; closing rejects new opens during shutdown
+	active  int64
+	closing int32
 }
 
 func NewFS(fs fs.Filesystem) fuse.FileSystemInterface {
+	return newFS(fs)
+}
+
+func newFS(fs fs.Filesystem) *FS {
 	l := log.Logger.With().Str("component", "fuse").Logger()
 	return &FS{
 		fh:  &fileHandler{fs: fs},
@@ -29,7 +40,27 @@ func NewFS(fs fs.Filesystem) fuse.FileSystemInterface {
 	}
 }
 
+// Drain stops accepting new opens and waits until in-flight reads finish or
+// ctx expires.
+func (fs *FS) Drain(ctx context.Context) error {
+	atomic.StoreInt32(&fs.closing, 1)
+	t := time.NewTicker(50 * time.Millisecond)
+	defer t.Stop()
+	for atomic.LoadInt64(&fs.active) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	return nil
+}
+
 func (fs *FS) Open(path string, flags int) (errc int, fh uint64) {
+	if atomic.LoadInt32(&fs.closing) == 1 {
+		return -int(fuse.EBUSY), fhNone
+	}
+
 	fh, err := fs.fh.OpenHolder(path)
 	if os.IsNotExist(err) {
 		fs.log.Debug().Str("path", path).Msg("file does not exists")
@@ -90,6 +121,9 @@ func (fs *FS) Getattr(path string, stat *fuse.Stat_t, fh uint64) (errc int) {
 }
 
 func (fs *FS) Read(path string, dest []byte, off int64, fh uint64) int {
+	atomic.AddInt64(&fs.active, 1)
+	defer atomic.AddInt64(&fs.active, -1)
+
 	file, err := fs.fh.GetFile(path, fh)
 	if os.IsNotExist(err) {
 		fs.log.Error().Err(err).Str("path", path).Msg("file not found on READ operation")
@@ -108,7 +142,10 @@ func (fs *FS) Read(path string, dest []byte, off int64, fh uint64) int {
 
 	buf := dest[:end]
 
+	start := time.Now()
 	n, err := file.ReadAt(buf, off)
+	metrics.ObserveRead(metrics.FrontendFuse, start, n)
+	metrics.TraceRead(&metrics.ReadTrace{Layer: metrics.LayerFuse, Path: path, Offset: off, Size: len(buf)}, start, n, err)
 	if err != nil && err != io.EOF {
 		log.Error().Err(err).Str("path", path).Msg("error reading data")
 		return -int(fuse.EIO)
@@ -2,15 +2,12 @@ package http
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
-	"net"
 	"net/http"
-	"net/url"
 	"os"
-	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -20,17 +17,23 @@ import (
 	"github.com/anacrolix/missinggo/v2/filecache"
 	"github.com/gin-gonic/gin"
 	cfgpkg "github.com/jkaberg/distribyted/config"
+	"github.com/jkaberg/distribyted/metrics"
 	"github.com/jkaberg/distribyted/torrent"
+	"github.com/jkaberg/distribyted/torrent/loader"
 )
 
-var apiStatusHandler = func(fc *filecache.Cache, ss *torrent.Stats) gin.HandlerFunc {
+var apiStatusHandler = func(fc *filecache.Cache, ss *torrent.Stats, s *torrent.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		ctx.JSON(http.StatusOK, gin.H{
+		out := gin.H{
 			"cacheItems":    fc.Info().NumItems,
 			"cacheFilled":   fc.Info().Filled / 1024 / 1024,
 			"cacheCapacity": fc.Info().Capacity / 1024 / 1024,
 			"torrentStats":  ss.GlobalStats(),
-		})
+		}
+		if st, err := s.IndexStats(); err == nil {
+			out["index"] = st
+		}
+		ctx.JSON(http.StatusOK, out)
 	}
 }
 
@@ -152,6 +155,12 @@ var apiBlacklistTorrentHandler = func(s *torrent.Service) gin.HandlerFunc {
 		route := ctx.Param("route")
 		hash := ctx.Param("torrent_hash")
 		if err := s.BlacklistAndRemove(route, hash); err != nil {
+			var arrErr *torrent.ArrError
+			if errors.As(err, &arrErr) {
+				// removed locally, but Arr could not blacklist or search
+				ctx.JSON(http.StatusOK, gin.H{"ok": true, "arrError": arrErr.Err.Error()})
+				return
+			}
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -159,7 +168,51 @@ var apiBlacklistTorrentHandler = func(s *torrent.Service) gin.HandlerFunc {
 	}
 }
 
-// apiRouteTorrentsHandler returns paginated torrents for a route
+// apiTagsHandler lists the tags in use.
+var apiTagsHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"tags": s.Tags()})
+	}
+}
+
+// apiSetTorrentTagsHandler replaces the tags of a torrent.
+var apiSetTorrentTagsHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req struct {
+			Tags []string `json:"tags"`
+		}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hash := ctx.Param("torrent_hash")
+		if err := s.SetTorrentTags(ctx.Param("route"), hash, req.Tags); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, torrent.ErrTorrentNotFound) {
+				status = http.StatusNotFound
+			}
+			ctx.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"tags": s.TorrentTags()[strings.ToLower(hash)]})
+	}
+}
+
+// apiRouteMediaHandler lists the files of the media view of a route with
+// their path in the route.
+var apiRouteMediaHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		name, files, ok := s.MediaFiles(ctx.Param("route"))
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "route has no media view"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"view": name, "files": files})
+	}
+}
+
+// apiRouteTorrentsHandler returns paginated torrents for a route, optionally
+// filtered by tag
 var apiRouteTorrentsHandler = func(ss *torrent.Stats, svc *torrent.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		route := ctx.Param("route")
@@ -175,8 +228,18 @@ var apiRouteTorrentsHandler = func(ss *torrent.Stats, svc *torrent.Service) gin.
 				size = v
 			}
 		}
+		// tag filters may be repeated or comma-separated; all must match
+		var tags []string
+		for _, t := range ctx.QueryArray("tag") {
+			tags = append(tags, strings.Split(t, ",")...)
+		}
+		tags, err := torrent.NormalizeTags(tags)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		// Always serve a merged view so cached items persist until live torrents load
-		rp := svc.MergedRoutePage(route, page, size)
+		rp := svc.MergedRoutePage(route, tags, page, size)
 		ctx.JSON(http.StatusOK, rp)
 	}
 }
@@ -281,7 +344,7 @@ var apiListRouteFiles = func(s *torrent.Service) gin.HandlerFunc {
 			if e.IsDir() {
 				continue
 			}
-			if filepath.Ext(e.Name()) == ".torrent" {
+			if loader.IsTorrentFile(e.Name()) {
 				files = append(files, e.Name())
 			}
 		}
@@ -300,8 +363,8 @@ var apiUploadTorrent = func(s *torrent.Service) gin.HandlerFunc {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("upload: %v", err)})
 			return
 		}
-		if filepath.Ext(fh.Filename) != ".torrent" {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "only .torrent files allowed"})
+		if !loader.IsTorrentFile(fh.Filename) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "only .torrent, .magnet and .url files allowed"})
 			return
 		}
 		folder, err := s.EnsureRouteFolder(route)
@@ -328,7 +391,7 @@ var apiDeleteTorrentFile = func(s *torrent.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		route := ctx.Param("route")
 		name := ctx.Param("name")
-		if filepath.Ext(name) != ".torrent" {
+		if !loader.IsTorrentFile(name) {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid file"})
 			return
 		}
@@ -412,13 +475,20 @@ var apiGetLimitsHandler = func(s *torrent.Service) gin.HandlerFunc {
 
 // Health settings
 type healthPayload struct {
-	Enabled          bool                  `json:"enabled"`
-	IntervalMinutes  int                   `json:"intervalMinutes"`
-	GraceMinutes     int                   `json:"graceMinutes"`
-	MinSeeders       int                   `json:"minSeeders"`
-	GoodSeeders      int                   `json:"goodSeeders"`
-	ExcellentSeeders int                   `json:"excellentSeeders"`
-	Arr              []*cfgpkg.ArrInstance `json:"arr"`
+	Enabled          bool                   `json:"enabled"`
+	IntervalMinutes  int                    `json:"intervalMinutes"`
+	GraceMinutes     int                    `json:"graceMinutes"`
+	MinSeeders       int                    `json:"minSeeders"`
+	MinAvailability  float64                `json:"minAvailability"`
+	GoodSeeders      int                    `json:"goodSeeders"`
+	ExcellentSeeders int                    `json:"excellentSeeders"`
+	Actions          []cfgpkg.HealthAction  `json:"actions"`
+	FailureThreshold int                    `json:"failureThreshold"`
+	DryRun           bool                   `json:"dryRun"`
+	Policies         []*cfgpkg.HealthPolicy `json:"policies"`
+	WindowMinutes    int                    `json:"windowMinutes"`
+	RetentionHours   int                    `json:"historyRetentionHours"`
+	Arr              []*cfgpkg.ArrInstance  `json:"arr"`
 }
 
 var apiGetHealthHandler = func(s *torrent.Service) gin.HandlerFunc {
@@ -441,8 +511,13 @@ var apiGetHealthHandler = func(s *torrent.Service) gin.HandlerFunc {
 				hp.IntervalMinutes = conf.Health.IntervalMinutes
 				hp.GraceMinutes = conf.Health.GraceMinutes
 				hp.MinSeeders = conf.Health.MinSeeders
+				hp.MinAvailability = conf.Health.MinAvailability
 				hp.GoodSeeders = conf.Health.GoodSeeders
 				hp.ExcellentSeeders = conf.Health.ExcellentSeeders
+				hp.Actions, hp.FailureThreshold = conf.Health.Actions, conf.Health.FailureThreshold
+				hp.DryRun = conf.Health.DryRun
+				hp.Policies = conf.Health.Policies
+				hp.WindowMinutes, hp.RetentionHours = conf.Health.WindowMinutes, conf.Health.HistoryRetentionHours
 				hp.Arr = conf.Health.Arr
 			}
 			return nil
@@ -462,76 +537,229 @@ var apiSetHealthHandler = func(s *torrent.Service) gin.HandlerFunc {
 		}
 		// persist to config
 		if err := s.SaveHealthToConfig(&cfgpkg.Health{
-			Enabled:          body.Enabled,
-			IntervalMinutes:  body.IntervalMinutes,
-			GraceMinutes:     body.GraceMinutes,
-			MinSeeders:       body.MinSeeders,
-			GoodSeeders:      body.GoodSeeders,
-			ExcellentSeeders: body.ExcellentSeeders,
-			Arr:              body.Arr,
+			Enabled:               body.Enabled,
+			IntervalMinutes:       body.IntervalMinutes,
+			GraceMinutes:          body.GraceMinutes,
+			MinSeeders:            body.MinSeeders,
+			MinAvailability:       body.MinAvailability,
+			GoodSeeders:           body.GoodSeeders,
+			ExcellentSeeders:      body.ExcellentSeeders,
+			Actions:               body.Actions,
+			FailureThreshold:      body.FailureThreshold,
+			DryRun:                body.DryRun,
+			Policies:              body.Policies,
+			WindowMinutes:         body.WindowMinutes,
+			HistoryRetentionHours: body.RetentionHours,
+			Arr:                   body.Arr,
 		}); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			ctx.JSON(http.StatusBadRequest, configError(err))
 			return
 		}
 		ctx.JSON(http.StatusOK, gin.H{"ok": true})
 	}
 }
 
-// apiTestArrHandler tests connectivity to a single Arr instance
-func apiTestArrHandler() gin.HandlerFunc {
+// apiTestFeedHandler fetches a feed and returns its items, flagging the ones
+// matching the filters
+var apiTestFeedHandler = func(s *torrent.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var inst cfgpkg.ArrInstance
-		if err := ctx.ShouldBindJSON(&inst); err != nil {
+		var f cfgpkg.Feed
+		if err := ctx.ShouldBindJSON(&f); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if strings.TrimSpace(inst.BaseURL) == "" || strings.TrimSpace(inst.APIKey) == "" {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "base_url and api_key required"})
+		items, err := s.TestFeed(ctx.Request.Context(), &f)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		// Build status endpoint based on type
-		endpoint := "/api/v3/system/status"
-		if inst.Type == cfgpkg.ArrLidarr {
-			endpoint = "/api/v1/system/status"
+		ctx.JSON(http.StatusOK, gin.H{"items": items})
+	}
+}
+
+// apiSlowReadsHandler returns the slowest recent reads, slowest first
+var apiSlowReadsHandler = func(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"thresholdMs": metrics.SlowReadThreshold.Milliseconds(),
+		"reads":       metrics.SlowReads(limit),
+	})
+}
+
+// apiExportIndexHandler downloads a bundle of the torrent index, as a ZIP
+// archive by default. The configuration file is only included with
+// config=true, as it holds credentials.
+var apiExportIndexHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		format := ctx.DefaultQuery("format", torrent.BundleZIP)
+		if format != torrent.BundleZIP && format != torrent.BundleJSON {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "format must be zip or json"})
+			return
 		}
-		// Prepare client
-		httpc := &http.Client{Timeout: 10 * time.Second}
-		// Compose URL
-		u, err := func() (string, error) {
-			uu, e := url.Parse(inst.BaseURL)
-			if e != nil {
-				return "", e
-			}
-			uu.Path = path.Join(uu.Path, endpoint)
-			return uu.String(), nil
-		}()
+		b, err := s.ExportIndex(ctx.Query("config") == "true")
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var buf bytes.Buffer
+		if err := torrent.WriteBundle(&buf, b, format); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		name := fmt.Sprintf("distribyted-%s.%s", b.CreatedAt.Format("20060102-150405"), format)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		contentType := "application/zip"
+		if format == torrent.BundleJSON {
+			contentType = "application/json"
+		}
+		ctx.Data(http.StatusOK, contentType, buf.Bytes())
+	}
+}
+
+// apiCompactIndexHandler compacts the index database and returns its stats.
+var apiCompactIndexHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if err := s.CompactIndex(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		st, err := s.IndexStats()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, st)
+	}
+}
+
+// apiImportIndexHandler imports the bundle uploaded as "file". mode is merge
+// (default) or replace; config=true also restores the configuration file.
+var apiImportIndexHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		mode, err := torrent.ParseImportMode(ctx.Query("mode"))
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		req, err := http.NewRequest(http.MethodGet, u, nil)
+		fh, err := ctx.FormFile("file")
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("upload: %v", err)})
+			return
+		}
+		f, err := fh.Open()
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		req.Header.Set("X-Api-Key", inst.APIKey)
-		resp, err := httpc.Do(req)
+		data, err := io.ReadAll(f)
+		f.Close()
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("HTTP %d", resp.StatusCode)})
+		b, err := torrent.ReadBundle(data)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		// minimal parse for name/version
-		var obj struct {
-			Version string `json:"version"`
-			AppName string `json:"appName"`
+		res, err := s.ImportIndex(b, mode, ctx.Query("config") == "true")
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, configError(err))
+			return
 		}
-		_ = json.NewDecoder(resp.Body).Decode(&obj)
-		ctx.JSON(http.StatusOK, gin.H{"ok": true, "name": obj.AppName, "version": obj.Version})
+		ctx.JSON(http.StatusOK, res)
+	}
+}
+
+// apiWatchersHandler returns the status of the route folder watchers
+var apiWatchersHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, s.WatcherStatuses())
+	}
+}
+
+// apiHealthEventsHandler returns recent health monitor actions, newest first
+var apiHealthEventsHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, s.HealthEvents())
+	}
+}
+
+// apiTorrentHistoryHandler returns the health samples of a torrent over the
+// last hours (24 by default) and its trend over the health window
+var apiTorrentHistoryHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash := ctx.Param("torrent_hash")
+		hours, err := strconv.Atoi(ctx.DefaultQuery("hours", "24"))
+		if err != nil || hours <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid hours"})
+			return
+		}
+		samples, err := s.HealthHistory(hash, time.Now().Add(-time.Duration(hours)*time.Hour))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		window := (&cfgpkg.Health{}).Window()
+		if conf, _ := s.ConfigSnapshot(); conf != nil && conf.Health != nil {
+			window = conf.Health.Window()
+		}
+		trend, err := s.HealthTrend(hash, window)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"samples": samples, "trend": trend, "windowMinutes": int(window.Minutes())})
+	}
+}
+
+// apiArrStatusHandler returns the outcome of the latest requests per Arr instance
+var apiArrStatusHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, s.ArrStatuses())
+	}
+}
+
+// apiArrWebhookHandler receives Arr webhook notifications. The optional
+// route query parameter restricts removals to that route.
+var apiArrWebhookHandler = func(s *torrent.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var p torrent.ArrWebhook
+		if err := ctx.ShouldBindJSON(&p); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res, err := s.HandleArrWebhook(ctx.Query("route"), &p)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, res)
+	}
+}
+
+// apiTestArrHandler tests connectivity to a single Arr instance
+func apiTestArrHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var inst cfgpkg.ArrInstance
+		if err := ctx.ShouldBindJSON(&inst); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(inst.BaseURL) == "" || strings.TrimSpace(inst.APIKey) == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "base_url and api_key required"})
+			return
+		}
+		st, err := torrent.ProbeArr(&inst)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"ok": true, "name": st.AppName, "version": st.Version})
 	}
 }
 
@@ -569,6 +797,16 @@ var apiGetConfigHandler = func(s *torrent.Service) gin.HandlerFunc {
 	}
 }
 
+// configError renders err, including per-setting details for validation
+// errors.
+func configError(err error) gin.H {
+	var ve *cfgpkg.ValidationError
+	if errors.As(err, &ve) {
+		return gin.H{"error": err.Error(), "errors": ve.Errors}
+	}
+	return gin.H{"error": err.Error()}
+}
+
 var apiSetConfigHandler = func(s *torrent.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var body struct {
@@ -582,55 +820,6 @@ var apiSetConfigHandler = func(s *torrent.Service) gin.HandlerFunc {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		// Basic validation
-		if body.HTTP != nil {
-			if body.HTTP.Port < 0 || body.HTTP.Port > 65535 {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid HTTP port"})
-				return
-			}
-			if body.HTTP.IP != "" && net.ParseIP(body.HTTP.IP) == nil {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid HTTP IP"})
-				return
-			}
-		}
-		if body.WebDAV != nil {
-			if body.WebDAV.Port < 0 || body.WebDAV.Port > 65535 {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid WebDAV port"})
-				return
-			}
-		}
-		if body.Torrent != nil {
-			if body.Torrent.AddTimeout < 0 || body.Torrent.ReadTimeout < 0 {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": "timeouts must be >= 0"})
-				return
-			}
-			if body.Torrent.IP != "" && net.ParseIP(body.Torrent.IP) == nil {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid Public IP"})
-				return
-			}
-			if body.Torrent.ListenPort < 0 || body.Torrent.ListenPort > 65535 {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid listen port"})
-				return
-			}
-			if body.Torrent.GlobalCacheSize < 0 {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": "cache size must be >= 0"})
-				return
-			}
-			if body.Torrent.ReaderPoolSize < 1 {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": "reader pool size must be >= 1"})
-				return
-			}
-			if body.Torrent.ReadaheadMB < 0 {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": "readahead must be >= 0"})
-				return
-			}
-		}
-		if body.Fuse != nil {
-			if strings.TrimSpace(body.Fuse.Path) == "" {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": "FUSE path required"})
-				return
-			}
-		}
 		if err := s.SaveConfig(func(conf *cfgpkg.Root) {
 			if body.HTTP != nil {
 				conf.HTTPGlobal = body.HTTP
@@ -640,8 +829,6 @@ var apiSetConfigHandler = func(s *torrent.Service) gin.HandlerFunc {
 			}
 			if body.Torrent != nil {
 				conf.Torrent = body.Torrent
-				// also apply tuning live
-				_ = s.ApplyTorrentTuning(body.Torrent.ReaderPoolSize, body.Torrent.ReadaheadMB)
 			}
 			if body.Fuse != nil {
 				conf.Fuse = body.Fuse
@@ -650,10 +837,26 @@ var apiSetConfigHandler = func(s *torrent.Service) gin.HandlerFunc {
 				conf.Log = body.Log
 			}
 		}); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			ctx.JSON(http.StatusBadRequest, configError(err))
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{"ok": true})
+		// apply what can be applied live and report the rest
+		res, err := s.ReloadConfig()
+		if res == nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		out := gin.H{"ok": err == nil, "changes": res.Changes, "events": res.Events, "restartRequired": res.RestartRequired()}
+		if err != nil {
+			out["error"] = err.Error()
+		}
+		// missing files are not fatal, but worth telling about like `config check` does
+		if conf, _ := s.ConfigSnapshot(); conf != nil {
+			if w := cfgpkg.CheckPaths(conf); len(w) > 0 {
+				out["warnings"] = w
+			}
+		}
+		ctx.JSON(http.StatusOK, out)
 	}
 }
 
@@ -671,7 +874,7 @@ var apiSetLimitsHandler = func(s *torrent.Service) gin.HandlerFunc {
 		}
 		// persist to config
 		if err := s.SaveLimitsToConfig(body.DownloadMbit, body.UploadMbit); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			ctx.JSON(http.StatusBadRequest, configError(err))
 			return
 		}
 		ctx.JSON(http.StatusOK, gin.H{"ok": true})
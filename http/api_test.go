@@ -0,0 +1,68 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cfgpkg "github.com/jkaberg/distribyted/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiSetTorrentTags(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	r, s := newTestQbt(t)
+	r.PUT("/api/routes/:route/torrent/:torrent_hash/tags", apiSetTorrentTagsHandler(s))
+
+	put := func(route, hash, body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/routes/"+route+"/torrent/"+hash+"/tags", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(http.StatusOK, put("tv", qbtHashA, `{"tags":["kids"]}`))
+	require.Equal([]string{"kids"}, s.TorrentTags()[qbtHashA])
+
+	require.Equal(http.StatusNotFound, put("movies", qbtHashA, `{"tags":["4k"]}`))
+	require.Equal(http.StatusNotFound, put("tv", strings.Repeat("d", 40), `{"tags":["4k"]}`))
+	require.Equal(http.StatusBadRequest, put("tv", qbtHashA, `{"tags":["a/b"]}`))
+	require.Equal(http.StatusBadRequest, put("tv", qbtHashA, `nope`))
+	require.Equal([]string{"kids"}, s.TorrentTags()[qbtHashA])
+}
+
+func TestApiSetConfigWarnings(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "config.yaml")
+	missing := filepath.Join(dir, "missing")
+	require.NoError(os.WriteFile(p, []byte("routes:\n  - name: tv\n    torrent_folder: "+missing+"\n"), 0644))
+
+	r, s := newTestQbt(t)
+	s.SetConfigHandler(cfgpkg.NewHandler(p))
+	r.POST("/api/settings/config", apiSetConfigHandler(s))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/settings/config", strings.NewReader(`{"log":{"debug":true}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(http.StatusOK, w.Code)
+
+	var out struct {
+		Warnings []*cfgpkg.FieldError `json:"warnings"`
+	}
+	require.NoError(json.Unmarshal(w.Body.Bytes(), &out))
+	require.Len(out.Warnings, 1)
+	require.Equal("routes[0].torrent_folder", out.Warnings[0].Path)
+}
@@ -11,11 +11,14 @@ import (
 
 	"github.com/jkaberg/distribyted"
 	"github.com/jkaberg/distribyted/config"
+	"github.com/jkaberg/distribyted/metrics"
 	"github.com/jkaberg/distribyted/torrent"
 	"github.com/jkaberg/distribyted/torrent/watchers"
 )
 
-func New(fc *filecache.Cache, ss *torrent.Stats, s *torrent.Service, ch *config.Handler, fs http.FileSystem, logPath string, cfg *config.HTTPGlobal) error {
+// New builds the web UI and API server. The returned server is not started;
+// callers own its lifecycle and must call ListenAndServe and Shutdown.
+func New(fc *filecache.Cache, ss *torrent.Stats, s *torrent.Service, ch *config.Handler, fs http.FileSystem, logPath string, cfg *config.HTTPGlobal) (*http.Server, error) {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery())
@@ -39,7 +42,7 @@ func New(fc *filecache.Cache, ss *torrent.Stats, s *torrent.Service, ch *config.
 
 	t, err := vfstemplate.ParseGlob(http.FS(distribyted.Templates), nil, "/templates/*")
 	if err != nil {
-		return fmt.Errorf("error parsing html: %w", err)
+		return nil, fmt.Errorf("error parsing html: %w", err)
 	}
 
 	r.SetHTMLTemplate(t)
@@ -50,26 +53,32 @@ func New(fc *filecache.Cache, ss *torrent.Stats, s *torrent.Service, ch *config.
 	r.GET("/routes", indexHandler(ss))
 	r.GET("/logs", logsHandler)
 	r.GET("/settings", settingsHandler)
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 
 	api := r.Group("/api")
 	{
 		api.GET("/log", apiLogHandler(logPath))
-		api.GET("/status", apiStatusHandler(fc, ss))
+		api.GET("/reads/slow", apiSlowReadsHandler)
+		api.GET("/status", apiStatusHandler(fc, ss, s))
 		api.GET("/net", apiNetHandler(s))
 
 		api.GET("/routes", apiRoutesHandler(ss, s))
 		api.GET("/routes/:route/torrents", apiRouteTorrentsHandler(ss, s))
 		api.GET("/routes/:route/torrent/:torrent_hash", apiTorrentDetailsHandler(ss, s))
 		api.GET("/routes/:route/torrent/:torrent_hash/files", apiTorrentFilesHandler(ss, s))
+		api.GET("/routes/:route/torrent/:torrent_hash/history", apiTorrentHistoryHandler(s))
 		api.POST("/routes", apiCreateRouteHandler(s))
 		api.DELETE("/routes/:route", apiDeleteRouteHandler(s))
 		api.GET("/routes/:route/files", apiListRouteFiles(s))
+		api.GET("/routes/:route/media", apiRouteMediaHandler(s))
 		api.POST("/routes/:route/files", apiUploadTorrent(s))
 		api.DELETE("/routes/:route/files/:name", apiDeleteTorrentFile(s))
 
 		api.POST("/routes/:route/torrent", apiAddTorrentHandler(s))
 		api.DELETE("/routes/:route/torrent/:torrent_hash", apiDelTorrentHandler(s))
 		api.POST("/routes/:route/torrent/:torrent_hash/blacklist", apiBlacklistTorrentHandler(s))
+		api.PUT("/routes/:route/torrent/:torrent_hash/tags", apiSetTorrentTagsHandler(s))
+		api.GET("/tags", apiTagsHandler(s))
 
 		// watcher interval endpoints
 		api.GET("/watch_interval", func(c *gin.Context) {
@@ -87,6 +96,13 @@ func New(fc *filecache.Cache, ss *torrent.Stats, s *torrent.Service, ch *config.
 			c.JSON(http.StatusOK, gin.H{"interval": watchers.GetWatchInterval()})
 		})
 
+		api.GET("/watchers", apiWatchersHandler(s))
+
+		// index backup
+		api.GET("/index/export", apiExportIndexHandler(s))
+		api.POST("/index/import", apiImportIndexHandler(s))
+		api.POST("/index/compact", apiCompactIndexHandler(s))
+
 		// rate limit endpoints (Mbit/s)
 		api.GET("/settings/limits", apiGetLimitsHandler(s))
 		api.POST("/settings/limits", apiSetLimitsHandler(s))
@@ -99,6 +115,10 @@ func New(fc *filecache.Cache, ss *torrent.Stats, s *torrent.Service, ch *config.
 		api.GET("/settings/health", apiGetHealthHandler(s))
 		api.POST("/settings/health", apiSetHealthHandler(s))
 		api.POST("/settings/health/arr/test", apiTestArrHandler())
+		api.GET("/health/events", apiHealthEventsHandler(s))
+		api.GET("/health/arr", apiArrStatusHandler(s))
+		api.POST("/arr/webhook", apiArrWebhookHandler(s))
+		api.POST("/feeds/test", apiTestFeedHandler(s))
 
 		// General config endpoints
 		api.GET("/settings/config", apiGetConfigHandler(s))
@@ -115,11 +135,10 @@ func New(fc *filecache.Cache, ss *torrent.Stats, s *torrent.Service, ch *config.
 
 	log.Info().Str("host", fmt.Sprintf("%s:%d", cfg.IP, cfg.Port)).Msg("starting webserver")
 
-	if err := r.Run(fmt.Sprintf("%s:%d", cfg.IP, cfg.Port)); err != nil {
-		return fmt.Errorf("error initializing server: %w", err)
-	}
-
-	return nil
+	return &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.IP, cfg.Port),
+		Handler: r.Handler(),
+	}, nil
 }
 
 func Logger() gin.HandlerFunc {
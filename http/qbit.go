@@ -29,6 +29,11 @@ func registerQBittorrentAPI(rg *gin.RouterGroup, ss *torrent.Stats, s *torrent.S
 	rg.GET("/torrents/categories", qbtGuard(qbtCategoriesList(ss, s)))
 	rg.POST("/torrents/createCategory", qbtGuard(qbtCategoryCreate(s)))
 	rg.POST("/torrents/setCategory", qbtGuard(qbtCategorySet(s)))
+
+	// Tags (stored in the index, independent of routes)
+	rg.GET("/torrents/tags", qbtGuard(qbtTagsList(s)))
+	rg.POST("/torrents/addTags", qbtGuard(qbtTagsAdd(ss, s)))
+	rg.POST("/torrents/removeTags", qbtGuard(qbtTagsRemove(ss, s)))
 }
 
 func qbtAuthLogin() gin.HandlerFunc {
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jkaberg/distribyted/torrent"
+)
+
+// tags list returns every tag in use
+func qbtTagsList(s *torrent.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, s.Tags())
+	}
+}
+
+func qbtTagsAdd(ss *torrent.Stats, s *torrent.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hashes := qbtResolveHashes(ss, c.PostForm("hashes"))
+		tags := strings.Split(c.PostForm("tags"), ",")
+		if len(hashes) == 0 {
+			c.String(http.StatusBadRequest, "hashes required")
+			return
+		}
+		if err := s.AddTags(hashes, tags); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "Ok.")
+	}
+}
+
+// removeTags removes every tag of the torrents when tags is empty
+func qbtTagsRemove(ss *torrent.Stats, s *torrent.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hashes := qbtResolveHashes(ss, c.PostForm("hashes"))
+		tags := strings.Split(c.PostForm("tags"), ",")
+		if len(hashes) == 0 {
+			c.String(http.StatusBadRequest, "hashes required")
+			return
+		}
+		if err := s.RemoveTags(hashes, tags); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "Ok.")
+	}
+}
+
+// qbtResolveHashes splits a hashes parameter, expanding "all" to every
+// loaded torrent.
+func qbtResolveHashes(ss *torrent.Stats, v string) []string {
+	if v != "all" {
+		return splitCSV(v)
+	}
+	var out []string
+	for _, rs := range ss.RoutesStats() {
+		for _, it := range rs.TorrentStats {
+			out = append(out, it.Hash)
+		}
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jkaberg/distribyted/torrent"
+	"github.com/jkaberg/distribyted/torrent/loader"
+)
+
+const (
+	qbtHashA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	qbtHashB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	qbtHashC = "cccccccccccccccccccccccccccccccccccccccc"
+)
+
+// newTestQbt returns the qBittorrent API over a service holding three
+// torrents without metadata in the tv route.
+func newTestQbt(t *testing.T) (*gin.Engine, *torrent.Service) {
+	c, err := atorrent.NewClient(atorrent.TestingConfig(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	db, err := loader.NewDB(filepath.Join(t.TempDir(), "magnetdb"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	ss := torrent.NewStats()
+	s := torrent.NewService(nil, torrent.NewIndexFromLoader(db), ss, c, 1, 1, false, t.TempDir())
+	ss.AddRoute("tv")
+	for _, h := range []string{qbtHashA, qbtHashB, qbtHashC} {
+		tr, _ := c.AddTorrentInfoHash(metainfo.NewHashFromHex(h))
+		ss.Add("tv", tr)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerQBittorrentAPI(r.Group("/api/v2"), ss, s)
+	return r, s
+}
+
+func qbtPost(r http.Handler, p string, form url.Values) int {
+	req := httptest.NewRequest(http.MethodPost, p, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+// qbtInfoHashes returns the sorted hashes listed by torrents/info with the
+// given query.
+func qbtInfoHashes(t *testing.T, r http.Handler, query string) []string {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/torrents/info?"+query, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var infos []qbtTorrentInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &infos))
+	out := []string{}
+	for _, ti := range infos {
+		out = append(out, ti.Hash)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestQbtTags(t *testing.T) {
+	SetQbtEnabled(true)
+
+	require := require.New(t)
+
+	r, s := newTestQbt(t)
+
+	require.Equal(http.StatusBadRequest, qbtPost(r, "/api/v2/torrents/addTags", url.Values{"tags": {"kids"}}))
+	require.Equal(http.StatusBadRequest, qbtPost(r, "/api/v2/torrents/addTags", url.Values{"hashes": {qbtHashA}, "tags": {"a/b"}}))
+
+	require.Equal(http.StatusOK, qbtPost(r, "/api/v2/torrents/addTags", url.Values{"hashes": {"all"}, "tags": {"4k"}}))
+	require.Equal(http.StatusOK, qbtPost(r, "/api/v2/torrents/addTags", url.Values{"hashes": {qbtHashA + "|" + qbtHashB}, "tags": {"kids,keep"}}))
+	require.Equal([]string{"4k", "keep", "kids"}, s.TorrentTags()[qbtHashA])
+	require.Equal([]string{"4k"}, s.TorrentTags()[qbtHashC])
+
+	require.Equal([]string{qbtHashA, qbtHashB}, qbtInfoHashes(t, r, "tag=kids"))
+	require.Equal([]string{qbtHashA, qbtHashB}, qbtInfoHashes(t, r, "category=tv&tag=keep"))
+	require.Empty(qbtInfoHashes(t, r, "tag="))
+
+	require.Equal(http.StatusOK, qbtPost(r, "/api/v2/torrents/removeTags", url.Values{"hashes": {qbtHashB}, "tags": {"keep"}}))
+	require.Equal([]string{"4k", "kids"}, s.TorrentTags()[qbtHashB])
+
+	// no tags clears every tag of the torrents
+	require.Equal(http.StatusOK, qbtPost(r, "/api/v2/torrents/removeTags", url.Values{"hashes": {qbtHashC}}))
+	require.NotContains(s.TorrentTags(), qbtHashC)
+	// an empty tag filter selects the untagged torrents
+	require.Equal([]string{qbtHashC}, qbtInfoHashes(t, r, "tag="))
+	require.Equal([]string{qbtHashC}, qbtInfoHashes(t, r, "category=tv&tag="))
+	require.Equal([]string{qbtHashA, qbtHashB, qbtHashC}, qbtInfoHashes(t, r, ""))
+
+	require.Equal(http.StatusOK, qbtPost(r, "/api/v2/torrents/removeTags", url.Values{"hashes": {"all"}}))
+	require.Empty(s.TorrentTags())
+	require.Equal([]string{qbtHashA, qbtHashB, qbtHashC}, qbtInfoHashes(t, r, "tag="))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -22,6 +23,10 @@ type qbtTorrentInfo struct {
 	UpSpeed  int64   `json:"upspeed"`
 	AddedOn  int64   `json:"added_on"`
 	SavePath string  `json:"save_path"`
+	// Availability is the number of distributed copies
+	Availability float64 `json:"availability"`
+	// Tags is the comma-separated list of tags
+	Tags string `json:"tags"`
 }
 
 func qbtTorrentsAdd(s *torrent.Service) gin.HandlerFunc {
@@ -79,6 +84,8 @@ func qbtTorrentsAdd(s *torrent.Service) gin.HandlerFunc {
 func qbtTorrentsInfo(ss *torrent.Stats, s *torrent.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		category := c.Query("category")
+		tag, tagged := c.GetQuery("tag")
+		tags := s.TorrentTags()
 		hashesQ := c.Query("hashes")
 		filterByHashes := map[string]struct{}{}
 		if hashesQ != "" {
@@ -97,7 +104,10 @@ func qbtTorrentsInfo(ss *torrent.Stats, s *torrent.Service) gin.HandlerFunc {
 						continue
 					}
 				}
-				out = append(out, mapTorrentInfoWithBase(s, category, it))
+				if tagged && !qbtHasTag(tags[it.Hash], tag) {
+					continue
+				}
+				out = append(out, mapTorrentInfoWithBase(s, category, it, tags[it.Hash]))
 			}
 		} else {
 			for _, rs := range ss.RoutesStats() {
@@ -107,7 +117,10 @@ func qbtTorrentsInfo(ss *torrent.Stats, s *torrent.Service) gin.HandlerFunc {
 							continue
 						}
 					}
-					out = append(out, mapTorrentInfoWithBase(s, rs.Name, it))
+					if tagged && !qbtHasTag(tags[it.Hash], tag) {
+						continue
+					}
+					out = append(out, mapTorrentInfoWithBase(s, rs.Name, it, tags[it.Hash]))
 				}
 			}
 		}
@@ -164,10 +177,12 @@ func mapTorrentInfo(route string, ts *torrent.TorrentStats) qbtTorrentInfo {
 		UpSpeed:  ts.UploadedBytes,
 		AddedOn:  time.Now().Unix(),
 		SavePath: filepath.Join("/", route),
+
+		Availability: ts.Availability,
 	}
 }
 
-func mapTorrentInfoWithBase(s *torrent.Service, route string, ts *torrent.TorrentStats) qbtTorrentInfo {
+func mapTorrentInfoWithBase(s *torrent.Service, route string, ts *torrent.TorrentStats, tags []string) qbtTorrentInfo {
 	base := "/"
 	if conf, err := s.ConfigSnapshot(); err == nil && conf != nil {
 		if conf.Fuse != nil && conf.Fuse.Path != "" {
@@ -176,5 +191,20 @@ func mapTorrentInfoWithBase(s *torrent.Service, route string, ts *torrent.Torren
 	}
 	ti := mapTorrentInfo(route, ts)
 	ti.SavePath = filepath.Join(base, route)
+	ti.Tags = strings.Join(tags, ", ")
 	return ti
 }
+
+// qbtHasTag matches the tag filter of torrents/info, where an empty tag
+// selects untagged torrents.
+func qbtHasTag(tags []string, tag string) bool {
+	if tag == "" {
+		return len(tags) == 0
+	}
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
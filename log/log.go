@@ -27,8 +27,13 @@ func Load(config *config.Log) {
 	log.Logger = log.Output(mw)
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
+	SetDebug(config.Debug)
+}
+
+// SetDebug switches the global log level between debug and info.
+func SetDebug(debug bool) {
 	l := zerolog.InfoLevel
-	if config.Debug {
+	if debug {
 		l = zerolog.DebugLevel
 	}
 
@@ -0,0 +1,135 @@
+// Package metrics exposes distribyted metrics in the Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/anacrolix/missinggo/v2/filecache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "distribyted"
+
+// Registry holds every distribyted metric, plus Go runtime and process
+// metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	readLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "read_duration_seconds",
+		Help:      "Latency of file reads by frontend.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"frontend"})
+
+	readBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "read_bytes_total",
+		Help:      "Bytes returned by file reads by frontend.",
+	}, []string{"frontend"})
+
+	readTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "read_timeouts_total",
+		Help:      "Torrent reads cancelled after the read timeout.",
+	})
+
+	healthActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "health_actions_total",
+		Help:      "Health actions on unhealthy torrents by action and result.",
+	}, []string{"action", "result"})
+
+	arrErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "arr_errors_total",
+		Help:      "Failed Arr API requests by instance.",
+	}, []string{"instance", "type"})
+)
+
+// Frontends observed by ObserveRead.
+const (
+	FrontendFuse   = "fuse"
+	FrontendWebDAV = "webdav"
+)
+
+// Health action results counted by HealthAction.
+const (
+	ResultOK     = "ok"
+	ResultError  = "error"
+	ResultDryRun = "dry_run"
+)
+
+func init() {
+	register(Registry)
+}
+
+// register adds the distribyted metrics and the Go runtime and process
+// metrics to r.
+func register(r prometheus.Registerer) {
+	r.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		readLatency, readBytes, readTimeouts, healthActions, arrErrors,
+	)
+}
+
+// Handler serves the metrics of Registry, in the OpenMetrics format when
+// the scraper asks for it.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+// ObserveRead records a read of n bytes served by frontend since start.
+func ObserveRead(frontend string, start time.Time, n int) {
+	readLatency.WithLabelValues(frontend).Observe(time.Since(start).Seconds())
+	if n > 0 {
+		readBytes.WithLabelValues(frontend).Add(float64(n))
+	}
+}
+
+// ReadTimeout counts a torrent read cancelled by the read timeout.
+func ReadTimeout() { readTimeouts.Inc() }
+
+// HealthAction counts a health action taken on an unhealthy torrent.
+func HealthAction(action, result string) {
+	healthActions.WithLabelValues(action, result).Inc()
+}
+
+// ArrError counts a failed request to an Arr instance.
+func ArrError(instance, typ string) {
+	arrErrors.WithLabelValues(instance, typ).Inc()
+}
+
+// RegisterCache exposes the capacity and fill of the piece cache.
+func RegisterCache(fc *filecache.Cache) error {
+	return registerCache(Registry, fc)
+}
+
+func registerCache(r prometheus.Registerer, fc *filecache.Cache) error {
+	for _, c := range []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "cache_capacity_bytes",
+			Help:      "Configured piece cache capacity.",
+		}, func() float64 { return float64(fc.Info().Capacity) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "cache_filled_bytes",
+			Help:      "Bytes used in the piece cache.",
+		}, func() float64 { return float64(fc.Info().Filled) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "cache_items",
+			Help:      "Items in the piece cache.",
+		}, func() float64 { return float64(fc.Info().NumItems) }),
+	} {
+		if err := r.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anacrolix/missinggo/v2/filecache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	r := prometheus.NewRegistry()
+	register(r)
+	fc, err := filecache.NewCache(t.TempDir())
+	require.NoError(err)
+	require.NoError(registerCache(r, fc))
+	// the same cache metrics cannot be exposed twice
+	require.Error(registerCache(r, fc))
+
+	// vectors are only gathered once they have a child
+	ObserveRead(FrontendWebDAV, time.Now(), 10)
+	ReadTimeout()
+	HealthAction("reannounce", ResultOK)
+	ArrError("sonarr", "sonarr")
+
+	mfs, err := r.Gather()
+	require.NoError(err)
+	names := make(map[string]bool, len(mfs))
+	for _, mf := range mfs {
+		names[mf.GetName()] = true
+	}
+	for _, n := range []string{
+		"distribyted_read_duration_seconds",
+		"distribyted_read_bytes_total",
+		"distribyted_read_timeouts_total",
+		"distribyted_health_actions_total",
+		"distribyted_arr_errors_total",
+		"distribyted_cache_capacity_bytes",
+		"distribyted_cache_filled_bytes",
+		"distribyted_cache_items",
+		"go_goroutines",
+	} {
+		require.True(names[n], n)
+	}
+}
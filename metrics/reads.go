@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Read layers traced by TraceRead.
+const (
+	LayerTorrent = "torrent"
+	LayerArchive = "archive"
+	LayerFuse    = "fuse"
+)
+
+// SlowReadThreshold is the duration above which a read is kept in the slow
+// reads buffer.
+const SlowReadThreshold = 250 * time.Millisecond
+
+// slowReadsSize is the number of slow reads kept.
+const slowReadsSize = 200
+
+// maxBlockingPieces caps the piece indices recorded for a single read.
+const maxBlockingPieces = 64
+
+// ReadTrace describes a single read on the read path.
+type ReadTrace struct {
+	Time     int64  `json:"time"`
+	Layer    string `json:"layer"`
+	Path     string `json:"path,omitempty"`
+	Offset   int64  `json:"offset"`
+	Size     int    `json:"size"`
+	Bytes    int    `json:"bytes"`
+	Duration int64  `json:"durationMs"`
+	// Complete is set when all the pieces of the range were verified once
+	// the read became slower than SlowReadThreshold. Only torrent reads know
+	// about pieces.
+	Complete *bool `json:"complete,omitempty"`
+	// BlockingPieces are the pieces of the range not complete at that time
+	BlockingPieces []int  `json:"blockingPieces,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// readTraces is a ring buffer of the latest slow reads.
+type readTraces struct {
+	mu   sync.Mutex
+	buf  []*ReadTrace
+	next int
+}
+
+var slowReads = &readTraces{buf: make([]*ReadTrace, 0, slowReadsSize)}
+
+func (rt *readTraces) add(t *ReadTrace) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if len(rt.buf) < cap(rt.buf) {
+		rt.buf = append(rt.buf, t)
+		return
+	}
+	rt.buf[rt.next] = t
+	rt.next = (rt.next + 1) % len(rt.buf)
+}
+
+func (rt *readTraces) list() []*ReadTrace {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	out := make([]*ReadTrace, len(rt.buf))
+	copy(out, rt.buf)
+	return out
+}
+
+// TraceRead finishes t with the outcome of a read that started at start. It
+// is kept when slower than SlowReadThreshold.
+func TraceRead(t *ReadTrace, start time.Time, n int, err error) {
+	d := time.Since(start)
+	if d < SlowReadThreshold {
+		return
+	}
+	t.Time = start.Unix()
+	t.Duration = d.Milliseconds()
+	t.Bytes = n
+	if err != nil {
+		t.Error = err.Error()
+	}
+	if len(t.BlockingPieces) > maxBlockingPieces {
+		t.BlockingPieces = t.BlockingPieces[:maxBlockingPieces]
+	}
+	slowReads.add(t)
+}
+
+// SlowReads returns up to limit of the slow reads kept, slowest first. A
+// limit of zero or less returns them all.
+func SlowReads(limit int) []*ReadTrace {
+	out := slowReads.list()
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Duration > out[j].Duration })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTracesRing(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	rt := &readTraces{buf: make([]*ReadTrace, 0, 3)}
+	for i := int64(0); i < 5; i++ {
+		rt.add(&ReadTrace{Offset: i})
+	}
+	var offsets []int64
+	for _, tr := range rt.list() {
+		offsets = append(offsets, tr.Offset)
+	}
+	// the oldest reads are overwritten in place
+	require.Equal([]int64{3, 4, 2}, offsets)
+}
+
+func TestTraceRead(t *testing.T) {
+	require := require.New(t)
+
+	slowReads = &readTraces{buf: make([]*ReadTrace, 0, slowReadsSize)}
+
+	TraceRead(&ReadTrace{Layer: LayerFuse, Path: "fast"}, time.Now(), 10, nil)
+	require.Empty(SlowReads(0))
+
+	pieces := make([]int, 100)
+	for i, d := range []time.Duration{time.Second, 3 * time.Second, 2 * time.Second} {
+		TraceRead(&ReadTrace{Layer: LayerTorrent, Offset: int64(i), BlockingPieces: pieces}, time.Now().Add(-d), 0, errors.New("timeout"))
+	}
+
+	reads := SlowReads(0)
+	require.Len(reads, 3)
+	var offsets []int64
+	for _, tr := range reads {
+		offsets = append(offsets, tr.Offset)
+		require.Len(tr.BlockingPieces, maxBlockingPieces)
+		require.Equal("timeout", tr.Error)
+	}
+	// slowest first
+	require.Equal([]int64{1, 2, 0}, offsets)
+
+	reads = SlowReads(2)
+	require.Len(reads, 2)
+	require.EqualValues(1, reads[0].Offset)
+	require.GreaterOrEqual(reads[0].Duration, int64(3000))
+}
@@ -1,7 +1,11 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	stdhttp "net/http"
+	"sync"
 
 	"github.com/anacrolix/missinggo/v2/filecache"
 
@@ -13,14 +17,129 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// StartServers starts Web UI (HTTP) and WebDAV (if configured).
-// Returns when the HTTP server exits (it is blocking by design).
-func StartServers(fc *filecache.Cache, cfs fs.Filesystem, httpConf *config.HTTPGlobal, webdavConf *config.WebDAVGlobal, stats *torrent.Stats, svc *torrent.Service, ch *config.Handler, httpfs stdhttp.FileSystem, logPath string) error {
+// Servers owns the Web UI (HTTP) and WebDAV listeners so they can be stopped
+// gracefully and restarted with new settings without touching FUSE mounts.
+type Servers struct {
+	fc      *filecache.Cache
+	cfs     fs.Filesystem
+	stats   *torrent.Stats
+	svc     *torrent.Service
+	ch      *config.Handler
+	httpfs  stdhttp.FileSystem
+	logPath string
+
+	mu        sync.Mutex
+	httpSrv   *stdhttp.Server
+	webdavSrv *stdhttp.Server
+
+	// davCreds is shared with the WebDAV server so credentials can change
+	// without a restart
+	davCreds *webdav.Credentials
+
+	// errc receives unexpected listener failures
+	errc chan error
+}
+
+func NewServers(fc *filecache.Cache, cfs fs.Filesystem, stats *torrent.Stats, svc *torrent.Service, ch *config.Handler, httpfs stdhttp.FileSystem, logPath string) *Servers {
+	return &Servers{
+		fc:       fc,
+		cfs:      cfs,
+		stats:    stats,
+		svc:      svc,
+		ch:       ch,
+		httpfs:   httpfs,
+		logPath:  logPath,
+		davCreds: webdav.NewCredentials("", ""),
+		errc:     make(chan error, 2),
+	}
+}
+
+// Errors returns a channel reporting listeners that stopped unexpectedly.
+func (s *Servers) Errors() <-chan error {
+	return s.errc
+}
+
+// Start starts Web UI (HTTP) and WebDAV (if configured) in background.
+func (s *Servers) Start(httpConf *config.HTTPGlobal, webdavConf *config.WebDAVGlobal) error {
 	log.Info().Msg("starting servers")
-	// WebDAV in background if configured
+
+	hs, err := apphttp.New(s.fc, s.stats, s.svc, s.ch, s.httpfs, s.logPath, httpConf)
+	if err != nil {
+		return err
+	}
+
+	var ws *stdhttp.Server
 	if webdavConf != nil {
-		go func() { _ = webdav.NewWebDAVServer(cfs, webdavConf.Port, webdavConf.User, webdavConf.Pass) }()
+		s.davCreds.Set(webdavConf.User, webdavConf.Pass)
+		ws = webdav.NewWebDAVServer(s.cfs, webdavConf.Port, s.davCreds)
+	}
+
+	s.mu.Lock()
+	s.httpSrv = hs
+	s.webdavSrv = ws
+	s.mu.Unlock()
+
+	s.serve("http", hs)
+	s.serve("webdav", ws)
+
+	return nil
+}
+
+func (s *Servers) serve(name string, srv *stdhttp.Server) {
+	if srv == nil {
+		return
+	}
+	go func() {
+		err := srv.ListenAndServe()
+		if err == nil || errors.Is(err, stdhttp.ErrServerClosed) {
+			return
+		}
+		select {
+		case s.errc <- fmt.Errorf("error serving %s: %w", name, err):
+		default:
+			log.Error().Err(err).Str("server", name).Msg("server stopped")
+		}
+	}()
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests,
+// including WebDAV and HTTPFS transfers, until ctx expires.
+func (s *Servers) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	hs, ws := s.httpSrv, s.webdavSrv
+	s.httpSrv, s.webdavSrv = nil, nil
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, srv := range []*stdhttp.Server{hs, ws} {
+		if srv == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, srv *stdhttp.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				errs[i] = err
+				_ = srv.Close()
+			}
+		}(i, srv)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// SetWebDAVCredentials updates the WebDAV user and password in place.
+func (s *Servers) SetWebDAVCredentials(user, pass string) {
+	s.davCreds.Set(user, pass)
+}
+
+// Restart gracefully stops the current listeners and starts new ones using
+// the provided settings.
+func (s *Servers) Restart(ctx context.Context, httpConf *config.HTTPGlobal, webdavConf *config.WebDAVGlobal) error {
+	if err := s.Shutdown(ctx); err != nil {
+		log.Warn().Err(err).Msg("servers did not stop cleanly before restart")
 	}
-	// Start HTTP server (blocking)
-	return apphttp.New(fc, stats, svc, ch, httpfs, logPath, httpConf)
+	return s.Start(httpConf, webdavConf)
 }
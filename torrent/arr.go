@@ -1,74 +1,200 @@
 package torrent
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	cfgpkg "github.com/jkaberg/distribyted/config"
+	"github.com/jkaberg/distribyted/metrics"
 )
 
-type arrClient struct {
-	inst  *cfgpkg.ArrInstance
-	httpc *http.Client
+const (
+	// arrQueuePageSize is the number of queue records requested per page
+	arrQueuePageSize = 200
+	// arrMaxPages bounds queue walks on misbehaving servers
+	arrMaxPages = 100
+	// arrRetries is the number of attempts for idempotent requests
+	arrRetries = 3
+)
+
+// arrRetryBackoff is the delay before the first retry; it doubles on each
+// following attempt.
+var arrRetryBackoff = 500 * time.Millisecond
+
+var errQueueItemNotFound = errors.New("queue item not found for hash")
+
+// arrRelease identifies the release a replacement is needed for.
+type arrRelease struct {
+	Hash string
+	Name string
+}
+
+// arrClient talks to a single Arr application.
+type arrClient interface {
+	instance() *cfgpkg.ArrInstance
+	// categories returns the set of download client categories configured in Arr
+	categories() (map[string]struct{}, error)
+	// systemStatus returns the application name and version
+	systemStatus() (*ArrSystemStatus, error)
+	// replace blocklists the release and requests another one
+	replace(r *arrRelease) error
+}
+
+// newArrClient returns the client implementation for the instance type.
+func newArrClient(inst *cfgpkg.ArrInstance, httpc *http.Client, status *arrStatuses) (arrClient, error) {
+	var app queueApp
+	switch inst.Type {
+	case cfgpkg.ArrRadarr:
+		app = radarrApp{}
+	case cfgpkg.ArrSonarr:
+		app = sonarrApp{}
+	case cfgpkg.ArrLidarr:
+		app = lidarrApp{}
+	case cfgpkg.ArrReadarr:
+		app = readarrApp{}
+	case cfgpkg.ArrWhisparr:
+		app = whisparrApp{}
+	case cfgpkg.ArrProwlarr:
+		return &prowlarrClient{arrConn: arrConn{inst: inst, httpc: httpc, status: status, version: "/api/v1"}}, nil
+	default:
+		return nil, fmt.Errorf("unknown arr type %q", inst.Type)
+	}
+	return &queueClient{
+		arrConn: arrConn{inst: inst, httpc: httpc, status: status, version: app.apiVersion()},
+		app:     app,
+	}, nil
 }
 
-func newArrClient(inst *cfgpkg.ArrInstance, httpc *http.Client) *arrClient {
-	return &arrClient{inst: inst, httpc: httpc}
+// arrConn holds the HTTP plumbing shared by every Arr application.
+type arrConn struct {
+	inst    *cfgpkg.ArrInstance
+	httpc   *http.Client
+	status  *arrStatuses
+	version string
 }
 
-func (c *arrClient) base(prefix string) (string, error) {
+func (c *arrConn) instance() *cfgpkg.ArrInstance { return c.inst }
+
+func (c *arrConn) base(prefix string) (string, error) {
 	u, err := url.Parse(c.inst.BaseURL)
 	if err != nil {
 		return "", err
 	}
-	// ensure path join
-	u.Path = path.Join(u.Path, prefix)
+	// ensure path join, keeping any query string from prefix
+	p, q, _ := strings.Cut(prefix, "?")
+	u.Path = path.Join(u.Path, p)
+	u.RawQuery = q
 	return u.String(), nil
 }
 
-func (c *arrClient) doJSON(method, urlStr string, body any, out any) error {
-	var req *http.Request
-	var err error
+// api returns the URL of endpoint below the application API root.
+func (c *arrConn) api(endpoint string) (string, error) {
+	return c.base(c.version + endpoint)
+}
+
+// arrHTTPError is a non-2xx response from Arr.
+type arrHTTPError struct {
+	Method string
+	Status int
+}
+
+func (e *arrHTTPError) Error() string {
+	return fmt.Sprintf("arr http %s: %d", e.Method, e.Status)
+}
+
+// retryable reports whether the request may succeed when repeated.
+func (e *arrHTTPError) retryable() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// doJSON performs a request, retrying GET requests with backoff on network
+// errors, throttling and server errors. The outcome is recorded in the
+// instance status.
+func (c *arrConn) doJSON(method, urlStr string, body any, out any) error {
+	var payload []byte
 	if body != nil {
-		b, e := json.Marshal(body)
-		if e != nil {
-			return e
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
 		}
-		req, err = http.NewRequest(method, urlStr, strings.NewReader(string(b)))
-		if err == nil {
-			req.Header.Set("Content-Type", "application/json")
+		payload = b
+	}
+
+	attempts := 1
+	if method == http.MethodGet {
+		attempts = arrRetries
+	}
+
+	var err error
+	backoff := arrRetryBackoff
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var retry bool
+		retry, err = c.do(method, urlStr, payload, out)
+		if err == nil || !retry {
+			break
 		}
-	} else {
-		req, err = http.NewRequest(method, urlStr, nil)
 	}
+
+	c.status.record(c.inst, err)
+	return err
+}
+
+func (c *arrConn) do(method, urlStr string, payload []byte, out any) (bool, error) {
+	var rd io.Reader
+	if payload != nil {
+		rd = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, urlStr, rd)
 	if err != nil {
-		return err
+		return false, err
 	}
-	req.Header.Set("X-Api-Key", c.inst.APIKey)
-	if c.inst.Insecure {
-		// caller should provide httpc with Insecure transport if needed; we keep simple
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
+	req.Header.Set("X-Api-Key", c.inst.APIKey)
 	resp, err := c.httpc.Do(req)
 	if err != nil {
-		return err
+		return true, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("arr http %s: %d", method, resp.StatusCode)
+		he := &arrHTTPError{Method: method, Status: resp.StatusCode}
+		return he.retryable(), he
 	}
 	if out != nil {
-		return json.NewDecoder(resp.Body).Decode(out)
+		return false, json.NewDecoder(resp.Body).Decode(out)
 	}
-	return nil
+	return false, nil
+}
+
+// arrCategoryFields are the download client settings holding the category
+// of each application. The imported categories, e.g. tvImportedCategory, are
+// left out as torrents are moved there once Arr is done with them.
+var arrCategoryFields = map[cfgpkg.ArrType][]string{
+	cfgpkg.ArrRadarr: {"movieCategory"},
+	cfgpkg.ArrSonarr: {"tvCategory"},
+	cfgpkg.ArrLidarr: {"musicCategory"},
+	// Readarr names the field musicCategory on some versions
+	cfgpkg.ArrReadarr:  {"bookCategory", "musicCategory"},
+	cfgpkg.ArrWhisparr: {"tvCategory", "movieCategory"},
+	cfgpkg.ArrProwlarr: {"category"},
 }
 
-// categories returns the set of download client categories configured in Arr
-func (c *arrClient) categories() (map[string]struct{}, error) {
+func (c *arrConn) categories() (map[string]struct{}, error) {
 	type field struct {
 		Name  string `json:"name"`
 		Value any    `json:"value"`
@@ -76,16 +202,7 @@ func (c *arrClient) categories() (map[string]struct{}, error) {
 	type dlc struct {
 		Fields []field `json:"fields"`
 	}
-	var endpoint string
-	switch c.inst.Type {
-	case cfgpkg.ArrRadarr, cfgpkg.ArrSonarr:
-		endpoint = "/api/v3/downloadclient"
-	case cfgpkg.ArrLidarr:
-		endpoint = "/api/v1/downloadclient"
-	default:
-		return nil, fmt.Errorf("unknown arr type")
-	}
-	u, err := c.base(endpoint)
+	u, err := c.api("/downloadclient")
 	if err != nil {
 		return nil, err
 	}
@@ -93,177 +210,365 @@ func (c *arrClient) categories() (map[string]struct{}, error) {
 	if err := c.doJSON(http.MethodGet, u, nil, &items); err != nil {
 		return nil, err
 	}
+	fields := map[string]bool{}
+	for _, name := range arrCategoryFields[c.inst.Type] {
+		fields[name] = true
+	}
 	out := map[string]struct{}{}
 	for _, it := range items {
 		for _, f := range it.Fields {
-			if strings.EqualFold(f.Name, "category") {
-				switch v := f.Value.(type) {
-				case string:
-					if v != "" {
-						out[v] = struct{}{}
-					}
-				}
+			if !fields[f.Name] {
+				continue
+			}
+			if v, ok := f.Value.(string); ok && v != "" {
+				out[v] = struct{}{}
 			}
 		}
 	}
 	return out, nil
 }
 
-// queue item structures (subset)
-type radarrQueueItem struct {
-	ID         int    `json:"id"`
-	DownloadID string `json:"downloadId"`
-	Movie      *struct {
-		ID int `json:"id"`
-	} `json:"movie"`
+// ArrSystemStatus is the subset of /system/status shared by every Arr.
+type ArrSystemStatus struct {
+	AppName string `json:"appName"`
+	Version string `json:"version"`
+}
+
+func (c *arrConn) systemStatus() (*ArrSystemStatus, error) {
+	u, err := c.api("/system/status")
+	if err != nil {
+		return nil, err
+	}
+	var st ArrSystemStatus
+	if err := c.doJSON(http.MethodGet, u, nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// arrRef is a nested object reference as returned by older Arr versions
+type arrRef struct {
+	ID int `json:"id"`
 }
 
-type sonarrQueueItem struct {
-	ID         int    `json:"id"`
-	DownloadID string `json:"downloadId"`
-	Series     *struct {
-		ID int `json:"id"`
-	} `json:"series"`
-	Episode *struct {
-		ID int `json:"id"`
-	} `json:"episode"`
+// arrQueueRecord is the subset of a queue record used across applications.
+// Only the media ids of the owning application are set.
+type arrQueueRecord struct {
+	ID         int     `json:"id"`
+	DownloadID string  `json:"downloadId"`
+	MovieID    int     `json:"movieId"`
+	SeriesID   int     `json:"seriesId"`
+	ArtistID   int     `json:"artistId"`
+	AuthorID   int     `json:"authorId"`
+	BookID     int     `json:"bookId"`
+	Movie      *arrRef `json:"movie"`
+	Series     *arrRef `json:"series"`
+	Artist     *arrRef `json:"artist"`
+	Author     *arrRef `json:"author"`
+	Book       *arrRef `json:"book"`
 }
 
-type lidarrQueueItem struct {
-	ID         int    `json:"id"`
-	DownloadID string `json:"downloadId"`
-	Artist     *struct {
-		ID int `json:"id"`
-	} `json:"artist"`
+// refID returns id, falling back to the nested reference of older versions.
+func refID(id int, ref *arrRef) int {
+	if id == 0 && ref != nil {
+		return ref.ID
+	}
+	return id
 }
 
-// findQueueByHash finds a queue item whose downloadId matches the torrent hash
-func (c *arrClient) findQueueByHash(hash string) (id int, entity string, entityID int, err error) {
-	// normalize hash to upper
-	H := strings.ToUpper(hash)
-	var endpoint string
-	switch c.inst.Type {
-	case cfgpkg.ArrRadarr:
-		endpoint = "/api/v3/queue?page=1&pageSize=100&includeUnknownSeriesItems=true&includeMovie=true"
-		u, e := c.base(endpoint)
-		if e != nil {
-			return 0, "", 0, e
-		}
-		var items []radarrQueueItem
-		if e = c.doJSON(http.MethodGet, u, nil, &items); e != nil {
-			return 0, "", 0, e
-		}
-		for _, it := range items {
-			if strings.EqualFold(it.DownloadID, H) {
-				if it.Movie != nil {
-					return it.ID, "movie", it.Movie.ID, nil
-				}
-			}
-		}
-	case cfgpkg.ArrSonarr:
-		endpoint = "/api/v3/queue?page=1&pageSize=100&includeUnknownSeriesItems=true"
-		u, e := c.base(endpoint)
-		if e != nil {
-			return 0, "", 0, e
+// arrPage is the paged envelope returned by Arr list endpoints
+type arrPage[T any] struct {
+	Page         int `json:"page"`
+	PageSize     int `json:"pageSize"`
+	TotalRecords int `json:"totalRecords"`
+	Records      []T `json:"records"`
+}
+
+// queueApp holds the endpoints and commands that differ between the Arr
+// applications managing a download queue.
+type queueApp interface {
+	apiVersion() string
+	// queueParams adds the application specific queue query parameters
+	queueParams(q url.Values)
+	// blocklistQuery is the query string removing and blocklisting a queue item
+	blocklistQuery() string
+	// searchCommand returns the command searching for a replacement of r
+	searchCommand(r *arrQueueRecord) (map[string]any, error)
+}
+
+type radarrApp struct{}
+
+func (radarrApp) apiVersion() string { return "/api/v3" }
+
+func (radarrApp) queueParams(q url.Values) {
+	q.Set("includeUnknownMovieItems", "true")
+	q.Set("includeMovie", "true")
+}
+
+func (radarrApp) blocklistQuery() string { return "blacklist=true" }
+
+func (radarrApp) searchCommand(r *arrQueueRecord) (map[string]any, error) {
+	id := refID(r.MovieID, r.Movie)
+	if id == 0 {
+		return nil, fmt.Errorf("queue item %d has no movie", r.ID)
+	}
+	return map[string]any{"name": "MoviesSearch", "movieIds": []int{id}}, nil
+}
+
+type sonarrApp struct{}
+
+func (sonarrApp) apiVersion() string { return "/api/v3" }
+
+func (sonarrApp) queueParams(q url.Values) {
+	q.Set("includeUnknownSeriesItems", "true")
+	q.Set("includeSeries", "true")
+}
+
+func (sonarrApp) blocklistQuery() string { return "removeFromClient=false&blocklist=true" }
+
+func (sonarrApp) searchCommand(r *arrQueueRecord) (map[string]any, error) {
+	id := refID(r.SeriesID, r.Series)
+	if id == 0 {
+		return nil, fmt.Errorf("queue item %d has no series", r.ID)
+	}
+	// Prefer series search for simplicity
+	return map[string]any{"name": "SeriesSearch", "seriesId": id}, nil
+}
+
+// whisparrApp targets Whisparr v2, which shares the Sonarr API.
+type whisparrApp struct{ sonarrApp }
+
+type lidarrApp struct{}
+
+func (lidarrApp) apiVersion() string { return "/api/v1" }
+
+func (lidarrApp) queueParams(q url.Values) {
+	q.Set("includeUnknownArtistItems", "true")
+	q.Set("includeArtist", "true")
+}
+
+func (lidarrApp) blocklistQuery() string { return "blacklist=true" }
+
+func (lidarrApp) searchCommand(r *arrQueueRecord) (map[string]any, error) {
+	id := refID(r.ArtistID, r.Artist)
+	if id == 0 {
+		return nil, fmt.Errorf("queue item %d has no artist", r.ID)
+	}
+	return map[string]any{"name": "ArtistSearch", "artistIds": []int{id}}, nil
+}
+
+type readarrApp struct{}
+
+func (readarrApp) apiVersion() string { return "/api/v1" }
+
+func (readarrApp) queueParams(q url.Values) {
+	q.Set("includeUnknownAuthorItems", "true")
+	q.Set("includeAuthor", "true")
+	q.Set("includeBook", "true")
+}
+
+func (readarrApp) blocklistQuery() string { return "removeFromClient=false&blocklist=true" }
+
+func (readarrApp) searchCommand(r *arrQueueRecord) (map[string]any, error) {
+	if id := refID(r.BookID, r.Book); id != 0 {
+		return map[string]any{"name": "BookSearch", "bookIds": []int{id}}, nil
+	}
+	if id := refID(r.AuthorID, r.Author); id != 0 {
+		return map[string]any{"name": "AuthorSearch", "authorId": id}, nil
+	}
+	return nil, fmt.Errorf("queue item %d has no book or author", r.ID)
+}
+
+// queueClient handles the applications downloading through a queue: the
+// release is found in the queue by info hash, blocklisted, and a search for
+// the media item is triggered.
+type queueClient struct {
+	arrConn
+	app queueApp
+
+	// queue is the snapshot of the download queue, fetched once per client.
+	// Clients live for a single health cycle.
+	queueOnce sync.Once
+	queue     []*arrQueueRecord
+	queueErr  error
+}
+
+func (c *queueClient) queuePageURL(page int) (string, error) {
+	q := url.Values{}
+	q.Set("page", fmt.Sprint(page))
+	q.Set("pageSize", fmt.Sprint(arrQueuePageSize))
+	c.app.queueParams(q)
+	return c.api("/queue?" + q.Encode())
+}
+
+// fetchQueue walks every page of the download queue.
+func (c *queueClient) fetchQueue() ([]*arrQueueRecord, error) {
+	var out []*arrQueueRecord
+	for page := 1; page <= arrMaxPages; page++ {
+		u, err := c.queuePageURL(page)
+		if err != nil {
+			return nil, err
 		}
-		var items []sonarrQueueItem
-		if e = c.doJSON(http.MethodGet, u, nil, &items); e != nil {
-			return 0, "", 0, e
+		var raw json.RawMessage
+		if err := c.doJSON(http.MethodGet, u, nil, &raw); err != nil {
+			return nil, err
 		}
-		for _, it := range items {
-			if strings.EqualFold(it.DownloadID, H) {
-				if it.Series != nil {
-					return it.ID, "series", it.Series.ID, nil
-				}
+
+		// very old versions return a bare array without paging
+		if t := bytes.TrimSpace(raw); len(t) > 0 && t[0] == '[' {
+			var items []*arrQueueRecord
+			if err := json.Unmarshal(t, &items); err != nil {
+				return nil, err
 			}
+			return items, nil
 		}
-	case cfgpkg.ArrLidarr:
-		endpoint = "/api/v1/queue?page=1&pageSize=100"
-		u, e := c.base(endpoint)
-		if e != nil {
-			return 0, "", 0, e
-		}
-		var items []lidarrQueueItem
-		if e = c.doJSON(http.MethodGet, u, nil, &items); e != nil {
-			return 0, "", 0, e
+
+		var p arrPage[*arrQueueRecord]
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, err
 		}
-		for _, it := range items {
-			if strings.EqualFold(it.DownloadID, H) {
-				if it.Artist != nil {
-					return it.ID, "artist", it.Artist.ID, nil
-				}
-			}
+		out = append(out, p.Records...)
+		if len(p.Records) == 0 || len(out) >= p.TotalRecords {
+			return out, nil
 		}
 	}
-	return 0, "", 0, fmt.Errorf("queue item not found for hash")
+	return out, nil
 }
 
-func (c *arrClient) blacklistQueueItem(id int) error {
-	switch c.inst.Type {
-	case cfgpkg.ArrRadarr:
-		u, e := c.base(fmt.Sprintf("/api/v3/queue/%d?blacklist=true", id))
-		if e != nil {
-			return e
-		}
-		return c.doJSON(http.MethodDelete, u, nil, nil)
-	case cfgpkg.ArrSonarr:
-		u, e := c.base(fmt.Sprintf("/api/v3/queue/%d?removeFromClient=false&blocklist=true", id))
-		if e != nil {
-			return e
-		}
-		return c.doJSON(http.MethodDelete, u, nil, nil)
-	case cfgpkg.ArrLidarr:
-		u, e := c.base(fmt.Sprintf("/api/v1/queue/%d?blacklist=true", id))
-		if e != nil {
-			return e
+// queueSnapshot returns the download queue, fetched once per client.
+func (c *queueClient) queueSnapshot() ([]*arrQueueRecord, error) {
+	c.queueOnce.Do(func() {
+		c.queue, c.queueErr = c.fetchQueue()
+	})
+	return c.queue, c.queueErr
+}
+
+// findQueueByHash finds a queue item whose downloadId matches the torrent hash
+func (c *queueClient) findQueueByHash(hash string) (*arrQueueRecord, error) {
+	items, err := c.queueSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range items {
+		if strings.EqualFold(it.DownloadID, hash) {
+			return it, nil
 		}
-		return c.doJSON(http.MethodDelete, u, nil, nil)
 	}
-	return nil
+	return nil, errQueueItemNotFound
 }
 
-func (c *arrClient) triggerSearch(entity string, id int) error {
-	payload := map[string]any{}
-	switch c.inst.Type {
-	case cfgpkg.ArrRadarr:
-		payload["name"] = "MoviesSearch"
-		payload["movieIds"] = []int{id}
-		u, e := c.base("/api/v3/command")
-		if e != nil {
-			return e
-		}
-		return c.doJSON(http.MethodPost, u, payload, nil)
-	case cfgpkg.ArrSonarr:
-		// Prefer series search for simplicity
-		payload["name"] = "SeriesSearch"
-		payload["seriesId"] = id
-		u, e := c.base("/api/v3/command")
-		if e != nil {
-			return e
+func (c *queueClient) replace(r *arrRelease) error {
+	it, err := c.findQueueByHash(r.Hash)
+	if err != nil {
+		return err
+	}
+	cmd, err := c.app.searchCommand(it)
+	if err != nil {
+		return err
+	}
+	u, err := c.api(fmt.Sprintf("/queue/%d?%s", it.ID, c.app.blocklistQuery()))
+	if err != nil {
+		return err
+	}
+	if err := c.doJSON(http.MethodDelete, u, nil, nil); err != nil {
+		return err
+	}
+	sleepShort()
+	if u, err = c.api("/command"); err != nil {
+		return err
+	}
+	return c.doJSON(http.MethodPost, u, cmd, nil)
+}
+
+// prowlarrRelease is a search result from Prowlarr.
+type prowlarrRelease struct {
+	GUID      string `json:"guid"`
+	IndexerID int    `json:"indexerId"`
+	Title     string `json:"title"`
+	Protocol  string `json:"protocol"`
+	InfoHash  string `json:"infoHash"`
+	Seeders   int    `json:"seeders"`
+}
+
+// prowlarrClient pulls replacement releases from the indexers managed by
+// Prowlarr. Prowlarr has no queue, so the release is searched by name and
+// the best seeded torrent other than the unhealthy one is sent to the
+// Prowlarr download client.
+type prowlarrClient struct {
+	arrConn
+}
+
+func (c *prowlarrClient) replace(r *arrRelease) error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("release name required to search Prowlarr")
+	}
+	q := url.Values{}
+	q.Set("query", r.Name)
+	q.Set("type", "search")
+	u, err := c.api("/search?" + q.Encode())
+	if err != nil {
+		return err
+	}
+	var releases []*prowlarrRelease
+	if err := c.doJSON(http.MethodGet, u, nil, &releases); err != nil {
+		return err
+	}
+
+	var best *prowlarrRelease
+	for _, rel := range releases {
+		if !strings.EqualFold(rel.Protocol, "torrent") || strings.EqualFold(rel.InfoHash, r.Hash) {
+			continue
 		}
-		return c.doJSON(http.MethodPost, u, payload, nil)
-	case cfgpkg.ArrLidarr:
-		payload["name"] = "ArtistSearch"
-		payload["artistIds"] = []int{id}
-		u, e := c.base("/api/v1/command")
-		if e != nil {
-			return e
+		if best == nil || rel.Seeders > best.Seeders {
+			best = rel
 		}
-		return c.doJSON(http.MethodPost, u, payload, nil)
 	}
-	return nil
+	if best == nil || best.Seeders <= 0 {
+		return fmt.Errorf("no seeded replacement found for %q", r.Name)
+	}
+
+	if u, err = c.api("/search"); err != nil {
+		return err
+	}
+	return c.doJSON(http.MethodPost, u, map[string]any{"guid": best.GUID, "indexerId": best.IndexerID}, nil)
+}
+
+// ProbeArr checks connectivity to an Arr instance and returns its status.
+func ProbeArr(inst *cfgpkg.ArrInstance) (*ArrSystemStatus, error) {
+	httpc, err := NewArrHTTPClient(inst)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newArrClient(inst, httpc, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.systemStatus()
 }
 
-// resolveArrManagedRoutes fetches categories for each instance and returns category->clients map
-func resolveArrManagedRoutes(instances []*cfgpkg.ArrInstance, httpc *http.Client) map[string][]*arrClient {
-	out := map[string][]*arrClient{}
+// arrClientsByRoute fetches categories for each instance and returns
+// category->clients. Clients share their queue snapshot, so a new set should
+// be resolved for every health cycle.
+func (s *Service) arrClientsByRoute(instances []*cfgpkg.ArrInstance) map[string][]arrClient {
+	out := map[string][]arrClient{}
 	for _, inst := range instances {
 		if inst == nil || inst.BaseURL == "" || inst.APIKey == "" {
 			continue
 		}
-		c := newArrClient(inst, httpc)
+		httpc, err := s.arrHTTP.get(inst)
+		if err != nil {
+			s.arr.record(inst, err)
+			s.log.Warn().Err(err).Str("arr", inst.Name).Msg("error configuring Arr HTTP client")
+			continue
+		}
+		c, err := newArrClient(inst, httpc, s.arr)
+		if err != nil {
+			s.log.Warn().Err(err).Str("arr", inst.Name).Msg("skipping Arr instance")
+			continue
+		}
 		cats, err := c.categories()
 		if err != nil {
+			s.log.Warn().Err(err).Str("arr", inst.Name).Str("url", inst.BaseURL).Msg("error fetching Arr download client categories")
 			continue
 		}
 		for cat := range cats {
@@ -273,5 +578,63 @@ func resolveArrManagedRoutes(instances []*cfgpkg.ArrInstance, httpc *http.Client
 	return out
 }
 
+// ArrStatus reports the outcome of the latest requests to an Arr instance.
+type ArrStatus struct {
+	Name        string         `json:"name"`
+	Type        cfgpkg.ArrType `json:"type"`
+	BaseURL     string         `json:"baseUrl"`
+	LastSuccess int64          `json:"lastSuccess,omitempty"`
+	LastError   string         `json:"lastError,omitempty"`
+	LastErrorAt int64          `json:"lastErrorAt,omitempty"`
+	Errors      int            `json:"errors"`
+}
+
+type arrStatuses struct {
+	mu sync.Mutex
+	m  map[string]*ArrStatus
+}
+
+func newArrStatuses() *arrStatuses {
+	return &arrStatuses{m: make(map[string]*ArrStatus)}
+}
+
+func (as *arrStatuses) record(inst *cfgpkg.ArrInstance, err error) {
+	if err != nil {
+		metrics.ArrError(inst.Name, string(inst.Type))
+	}
+	if as == nil {
+		return
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	st, ok := as.m[inst.BaseURL]
+	if !ok {
+		st = &ArrStatus{}
+		as.m[inst.BaseURL] = st
+	}
+	st.Name, st.Type, st.BaseURL = inst.Name, inst.Type, inst.BaseURL
+	now := time.Now().Unix()
+	if err != nil {
+		st.LastError = err.Error()
+		st.LastErrorAt = now
+		st.Errors++
+		return
+	}
+	st.LastSuccess = now
+}
+
+// ArrStatuses returns the request outcome of every Arr instance contacted.
+func (s *Service) ArrStatuses() []*ArrStatus {
+	s.arr.mu.Lock()
+	defer s.arr.mu.Unlock()
+	out := make([]*ArrStatus, 0, len(s.arr.m))
+	for _, st := range s.arr.m {
+		c := *st
+		out = append(out, &c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
 // backoff helper for Arr requests if needed
 func sleepShort() { time.Sleep(500 * time.Millisecond) }
@@ -0,0 +1,172 @@
+package torrent
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	cfgpkg "github.com/jkaberg/distribyted/config"
+)
+
+// newTestArr returns a client of the given type talking to a test server
+// serving h.
+func newTestArr(t *testing.T, typ cfgpkg.ArrType, h http.HandlerFunc) arrClient {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	inst := &cfgpkg.ArrInstance{Name: string(typ), Type: typ, BaseURL: srv.URL, APIKey: "key"}
+	c, err := newArrClient(inst, srv.Client(), newArrStatuses())
+	require.NoError(t, err)
+	return c
+}
+
+func TestArrFetchQueue(t *testing.T) {
+	arrRetryBackoff = time.Millisecond
+
+	tests := []struct {
+		name  string
+		pages map[string]string
+		want  []int
+	}{
+		{
+			name: "pages",
+			pages: map[string]string{
+				"1": `{"page":1,"pageSize":2,"totalRecords":3,"records":[{"id":1,"downloadId":"A"},{"id":2,"downloadId":"B"}]}`,
+				"2": `{"page":2,"pageSize":2,"totalRecords":3,"records":[{"id":3,"downloadId":"C"}]}`,
+			},
+			want: []int{1, 2, 3},
+		},
+		{
+			name:  "bare array",
+			pages: map[string]string{"1": `[{"id":4,"downloadId":"D"},{"id":5,"downloadId":"E"}]`},
+			want:  []int{4, 5},
+		},
+		{
+			name:  "empty",
+			pages: map[string]string{"1": `{"page":1,"pageSize":200,"totalRecords":0,"records":[]}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+
+			var requests atomic.Int32
+			c := newTestArr(t, cfgpkg.ArrSonarr, func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				if r.URL.Path != "/api/v3/queue" || r.Header.Get("X-Api-Key") != "key" || r.URL.Query().Get("includeSeries") != "true" {
+					http.Error(w, "unexpected request", http.StatusBadRequest)
+					return
+				}
+				_, _ = w.Write([]byte(tt.pages[r.URL.Query().Get("page")]))
+			})
+			items, err := c.(*queueClient).fetchQueue()
+			require.NoError(err)
+			var ids []int
+			for _, it := range items {
+				ids = append(ids, it.ID)
+			}
+			require.Equal(tt.want, ids)
+			require.EqualValues(len(tt.pages), requests.Load())
+		})
+	}
+}
+
+func TestArrDoJSON(t *testing.T) {
+	arrRetryBackoff = time.Millisecond
+
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int
+		wantErr  int
+		wantReqs int32
+	}{
+		{name: "ok", method: http.MethodGet, statuses: []int{200}, wantReqs: 1},
+		{name: "retryable 503", method: http.MethodGet, statuses: []int{503, 503, 200}, wantReqs: 3},
+		{name: "retries exhausted", method: http.MethodGet, statuses: []int{503, 429, 503}, wantErr: 503, wantReqs: arrRetries},
+		{name: "not retryable 4xx", method: http.MethodGet, statuses: []int{401, 200}, wantErr: 401, wantReqs: 1},
+		{name: "post not retried", method: http.MethodPost, statuses: []int{503, 200}, wantErr: 503, wantReqs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+
+			var requests atomic.Int32
+			c := newTestArr(t, cfgpkg.ArrRadarr, func(w http.ResponseWriter, r *http.Request) {
+				n := requests.Add(1)
+				w.WriteHeader(tt.statuses[n-1])
+				_, _ = w.Write([]byte(`{"appName":"Radarr","version":"5.0"}`))
+			})
+			conn := &c.(*queueClient).arrConn
+			u, err := conn.api("/system/status")
+			require.NoError(err)
+			var st ArrSystemStatus
+			err = conn.doJSON(tt.method, u, nil, &st)
+			require.Equal(tt.wantReqs, requests.Load())
+
+			if tt.wantErr == 0 {
+				require.NoError(err)
+				require.Equal("Radarr", st.AppName)
+				require.Empty(conn.status.m[conn.inst.BaseURL].LastError)
+				return
+			}
+			var he *arrHTTPError
+			require.True(errors.As(err, &he))
+			require.Equal(tt.wantErr, he.Status)
+			require.Equal(1, conn.status.m[conn.inst.BaseURL].Errors)
+		})
+	}
+}
+
+// sonarrDownloadClients is a /api/v3/downloadclient response of Sonarr v4
+// with a qBittorrent client.
+const sonarrDownloadClients = `[{
+  "enable": true, "protocol": "torrent", "priority": 1, "removeCompletedDownloads": true,
+  "name": "qBittorrent", "implementation": "QBittorrent", "configContract": "QBittorrentSettings",
+  "fields": [
+    {"order": 0, "name": "host", "label": "Host", "value": "distribyted", "type": "textbox"},
+    {"order": 1, "name": "port", "label": "Port", "value": 4444, "type": "textbox"},
+    {"order": 2, "name": "useSsl", "label": "Use SSL", "value": false, "type": "checkbox"},
+    {"order": 3, "name": "urlBase", "label": "URL Base", "type": "textbox"},
+    {"order": 4, "name": "username", "label": "Username", "value": "admin", "type": "textbox"},
+    {"order": 5, "name": "password", "label": "Password", "value": "********", "type": "password"},
+    {"order": 6, "name": "tvCategory", "label": "Category", "value": "tv-sonarr", "type": "textbox"},
+    {"order": 7, "name": "tvImportedCategory", "label": "Post-Import Category", "value": "tv-imported", "type": "textbox"},
+    {"order": 8, "name": "recentTvPriority", "label": "Recent Priority", "value": 0, "type": "select"},
+    {"order": 9, "name": "olderTvPriority", "label": "Older Priority", "value": 0, "type": "select"},
+    {"order": 10, "name": "initialState", "label": "Initial State", "value": 0, "type": "select"},
+    {"order": 11, "name": "sequentialOrder", "label": "Sequential Order", "value": false, "type": "checkbox"},
+    {"order": 12, "name": "firstAndLast", "label": "First and Last First", "value": false, "type": "checkbox"}
+  ],
+  "id": 1
+}, {
+  "enable": true, "protocol": "torrent", "name": "Transmission", "implementation": "Transmission",
+  "fields": [
+    {"order": 0, "name": "host", "value": "transmission"},
+    {"order": 5, "name": "tvCategory", "value": "tv-transmission"},
+    {"order": 6, "name": "tvImportedCategory", "value": ""},
+    {"order": 7, "name": "tvDirectory", "value": "/downloads/tv"}
+  ],
+  "id": 2
+}]`
+
+func TestArrCategories(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	c := newTestArr(t, cfgpkg.ArrSonarr, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/downloadclient" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(sonarrDownloadClients))
+	})
+	cats, err := c.categories()
+	require.NoError(err)
+	require.Equal(map[string]struct{}{"tv-sonarr": {}, "tv-transmission": {}}, cats)
+}
@@ -0,0 +1,107 @@
+package torrent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	cfgpkg "github.com/jkaberg/distribyted/config"
+)
+
+// defaultArrTimeout applies to Arr instances without timeout_seconds.
+const defaultArrTimeout = 15 * time.Second
+
+// NewArrHTTPClient returns an HTTP client honouring the TLS and timeout
+// settings of inst.
+func NewArrHTTPClient(inst *cfgpkg.ArrInstance) (*http.Client, error) {
+	tc := &tls.Config{InsecureSkipVerify: inst.Insecure}
+
+	if inst.CAFile != "" {
+		pem, err := os.ReadFile(inst.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA bundle " + inst.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+
+	if inst.ClientCert != "" || inst.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(inst.ClientCert, inst.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tc
+
+	timeout := defaultArrTimeout
+	if inst.TimeoutSeconds > 0 {
+		timeout = time.Duration(inst.TimeoutSeconds) * time.Second
+	}
+	return &http.Client{Transport: tr, Timeout: timeout}, nil
+}
+
+// arrTransport is the part of an Arr instance affecting its HTTP client.
+type arrTransport struct {
+	insecure   bool
+	caFile     string
+	clientCert string
+	clientKey  string
+	timeout    int
+}
+
+type arrHTTPClient struct {
+	transport arrTransport
+	client    *http.Client
+}
+
+// arrHTTPClients keeps one HTTP client per Arr instance so connections are
+// reused across health cycles. A client is rebuilt when its settings change.
+type arrHTTPClients struct {
+	mu sync.Mutex
+	m  map[string]*arrHTTPClient
+}
+
+func newArrHTTPClients() *arrHTTPClients {
+	return &arrHTTPClients{m: make(map[string]*arrHTTPClient)}
+}
+
+func (ac *arrHTTPClients) get(inst *cfgpkg.ArrInstance) (*http.Client, error) {
+	key := inst.Name + "|" + inst.BaseURL
+	t := arrTransport{
+		insecure:   inst.Insecure,
+		caFile:     inst.CAFile,
+		clientCert: inst.ClientCert,
+		clientKey:  inst.ClientKey,
+		timeout:    inst.TimeoutSeconds,
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if c, ok := ac.m[key]; ok {
+		if c.transport == t {
+			return c.client, nil
+		}
+		c.client.CloseIdleConnections()
+		delete(ac.m, key)
+	}
+	httpc, err := NewArrHTTPClient(inst)
+	if err != nil {
+		return nil, err
+	}
+	ac.m[key] = &arrHTTPClient{transport: t, client: httpc}
+	return httpc, nil
+}
@@ -0,0 +1,625 @@
+package torrent
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/jkaberg/distribyted/torrent/loader"
+)
+
+// bundleVersion is the format version of the bundles written by ExportIndex.
+const bundleVersion = 1
+
+// Names of the entries of a ZIP bundle. Route files are stored under
+// routes/<route>/<path>.
+const (
+	bundleIndexEntry  = "index.json"
+	bundleConfigEntry = "config.yaml"
+	bundleRoutesDir   = "routes"
+)
+
+// Bundle formats.
+const (
+	BundleJSON = "json"
+	BundleZIP  = "zip"
+)
+
+// Bundle is a portable copy of the torrent index: the UI-managed routes and
+// their torrent files, the magnets and metadata of the database and
+// optionally the configuration file.
+type Bundle struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Routes are the UI-managed routes, stored as folders of the routes root
+	Routes []string `json:"routes"`
+	// Magnets holds the magnet links of the database, by route
+	Magnets map[string][]string        `json:"magnets"`
+	Files   []*BundleFile              `json:"files"`
+	Meta    map[string]json.RawMessage `json:"meta"`
+	// Tags holds the torrent tags, by hash
+	Tags map[string][]string `json:"tags,omitempty"`
+	// Config is the configuration file, with its credentials such as API
+	// keys and passwords. Only set when asked for.
+	Config string `json:"config,omitempty"`
+}
+
+// BundleFile is a torrent file of a UI-managed route.
+type BundleFile struct {
+	Route string `json:"route"`
+	// Path is slash-separated and relative to the route folder
+	Path string `json:"path"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// ImportMode tells how a bundle is imported.
+type ImportMode string
+
+const (
+	// ImportMerge adds the content of the bundle, keeping existing entries
+	ImportMerge ImportMode = "merge"
+	// ImportReplace removes the current index before importing the bundle
+	ImportReplace ImportMode = "replace"
+)
+
+// ParseImportMode returns the mode named s, merge by default.
+func ParseImportMode(s string) (ImportMode, error) {
+	switch ImportMode(s) {
+	case "", ImportMerge:
+		return ImportMerge, nil
+	case ImportReplace:
+		return ImportReplace, nil
+	}
+	return "", fmt.Errorf("unknown import mode %q, expected merge or replace", s)
+}
+
+// ImportResult counts the entries written by an import.
+type ImportResult struct {
+	Routes  int  `json:"routes"`
+	Magnets int  `json:"magnets"`
+	Files   int  `json:"files"`
+	Meta    int  `json:"meta"`
+	Tags    int  `json:"tags"`
+	Config  bool `json:"config"`
+
+	// magnets and meta hold what was written, to be loaded by a running service
+	magnets map[string][]string
+	meta    map[string][]byte
+}
+
+// ExportIndex builds a bundle from the index database and the UI-managed
+// routes under routesRoot. config is the raw configuration file, if any.
+func ExportIndex(db IndexStore, routesRoot string, config []byte) (*Bundle, error) {
+	b := &Bundle{
+		Version:   bundleVersion,
+		CreatedAt: time.Now().UTC(),
+		Routes:    []string{},
+		Files:     []*BundleFile{},
+		Config:    string(config),
+	}
+
+	ms, err := db.ListMagnets()
+	if err != nil {
+		return nil, fmt.Errorf("error listing magnets: %w", err)
+	}
+	b.Magnets = ms
+	for _, l := range b.Magnets {
+		sort.Strings(l)
+	}
+
+	metas, err := db.GetAllMeta()
+	if err != nil {
+		return nil, fmt.Errorf("error listing metadata: %w", err)
+	}
+	b.Meta = make(map[string]json.RawMessage, len(metas))
+	for h, m := range metas {
+		if json.Valid(m) {
+			b.Meta[h] = m
+		}
+	}
+
+	if b.Tags, err = db.ListTags(); err != nil {
+		return nil, fmt.Errorf("error listing tags: %w", err)
+	}
+
+	if routesRoot == "" {
+		return b, nil
+	}
+	entries, err := os.ReadDir(routesRoot)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		route := e.Name()
+		b.Routes = append(b.Routes, route)
+		folder := filepath.Join(routesRoot, route)
+		err := filepath.WalkDir(folder, func(p string, d iofs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !loader.IsTorrentFile(p) {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(folder, p)
+			if err != nil {
+				return err
+			}
+			b.Files = append(b.Files, &BundleFile{Route: route, Path: filepath.ToSlash(rel), Data: data})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading route %s: %w", route, err)
+		}
+	}
+	return b, nil
+}
+
+// WriteBundle writes b to w as a single JSON document or as a ZIP archive
+// holding the index, the torrent files and the configuration separately.
+func WriteBundle(w io.Writer, b *Bundle, format string) error {
+	switch format {
+	case BundleJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(b)
+	case BundleZIP:
+	default:
+		return fmt.Errorf("unknown bundle format %q, expected json or zip", format)
+	}
+
+	zw := zip.NewWriter(w)
+	idx := *b
+	idx.Config = ""
+	idx.Files = make([]*BundleFile, 0, len(b.Files))
+	for _, f := range b.Files {
+		idx.Files = append(idx.Files, &BundleFile{Route: f.Route, Path: f.Path})
+		fw, err := zw.Create(path.Join(bundleRoutesDir, f.Route, f.Path))
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	if b.Config != "" {
+		fw, err := zw.Create(bundleConfigEntry)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, b.Config); err != nil {
+			return err
+		}
+	}
+	fw, err := zw.Create(bundleIndexEntry)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&idx); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadBundle parses a bundle written by WriteBundle in any format.
+func ReadBundle(data []byte) (*Bundle, error) {
+	b := &Bundle{}
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		if err := json.Unmarshal(data, b); err != nil {
+			return nil, fmt.Errorf("error parsing bundle: %w", err)
+		}
+		return b, b.check()
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("error opening bundle archive: %w", err)
+	}
+	read := func(name string) ([]byte, error) {
+		f, err := zr.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	idx, err := read(bundleIndexEntry)
+	if err != nil {
+		return nil, fmt.Errorf("error reading bundle index: %w", err)
+	}
+	if err := json.Unmarshal(idx, b); err != nil {
+		return nil, fmt.Errorf("error parsing bundle index: %w", err)
+	}
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	if c, err := read(bundleConfigEntry); err == nil {
+		b.Config = string(c)
+	} else if !errors.Is(err, iofs.ErrNotExist) {
+		return nil, err
+	}
+	for _, f := range b.Files {
+		if f.Data, err = read(path.Join(bundleRoutesDir, f.Route, f.Path)); err != nil {
+			return nil, fmt.Errorf("error reading bundle file %s of route %s: %w", f.Path, f.Route, err)
+		}
+	}
+	return b, nil
+}
+
+// check rejects bundles of newer versions, file paths escaping their route
+// folder and the routes, hashes and tags that cannot be index keys.
+func (b *Bundle) check() error {
+	if b.Version < 1 || b.Version > bundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	for _, r := range b.Routes {
+		if !validRouteName(r) {
+			return fmt.Errorf("invalid route name %q in bundle", r)
+		}
+	}
+	for _, f := range b.Files {
+		if !validRouteName(f.Route) || !filepath.IsLocal(filepath.FromSlash(f.Path)) || !loader.IsTorrentFile(f.Path) {
+			return fmt.Errorf("invalid file %q of route %q in bundle", f.Path, f.Route)
+		}
+	}
+	for r := range b.Magnets {
+		if !validRouteName(r) {
+			return fmt.Errorf("invalid magnet route %q in bundle", r)
+		}
+	}
+	for h := range b.Meta {
+		if !validHash(h) {
+			return fmt.Errorf("invalid metadata hash %q in bundle", h)
+		}
+	}
+	for h, tags := range b.Tags {
+		if !validHash(h) {
+			return fmt.Errorf("invalid tagged hash %q in bundle", h)
+		}
+		if _, err := NormalizeTags(tags); err != nil {
+			return fmt.Errorf("invalid tags of %s in bundle: %w", h, err)
+		}
+	}
+	return nil
+}
+
+func validRouteName(r string) bool {
+	return r != "" && r != "." && r != ".." && !strings.ContainsAny(r, `/\`)
+}
+
+// validHash reports whether h is an info hash as stored in the index: 40
+// lower case hex characters.
+func validHash(h string) bool {
+	var ih metainfo.Hash
+	return ih.FromHexString(h) == nil && ih.HexString() == h
+}
+
+// ImportIndex writes the content of b into the index database and the
+// routes root. In replace mode the magnets, metadata, tags and file associations
+// of the database and the torrent files of the UI-managed routes are removed
+// first; route folders missing from the bundle are removed when left empty.
+// The configuration is not imported, see Service.ImportIndex.
+func ImportIndex(db IndexStore, routesRoot string, b *Bundle, mode ImportMode) (*ImportResult, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	if mode == ImportReplace {
+		if err := clearIndex(db, routesRoot, b.Routes); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &ImportResult{magnets: make(map[string][]string), meta: make(map[string][]byte)}
+
+	if routesRoot != "" {
+		routes := append([]string{}, b.Routes...)
+		for _, f := range b.Files {
+			routes = append(routes, f.Route)
+		}
+		seen := make(map[string]bool)
+		for _, r := range routes {
+			if seen[r] {
+				continue
+			}
+			seen[r] = true
+			folder := filepath.Join(routesRoot, r)
+			if _, err := os.Stat(folder); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(folder, 0744); err != nil {
+				return res, err
+			}
+			res.Routes++
+		}
+		for _, f := range b.Files {
+			p := filepath.Join(routesRoot, f.Route, filepath.FromSlash(f.Path))
+			if _, err := os.Stat(p); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(p), 0744); err != nil {
+				return res, err
+			}
+			if err := os.WriteFile(p, f.Data, 0644); err != nil {
+				return res, err
+			}
+			res.Files++
+		}
+	}
+
+	current, err := db.ListMagnets()
+	if err != nil {
+		return res, err
+	}
+	for route, ms := range b.Magnets {
+		have := make(map[string]bool)
+		for _, m := range current[route] {
+			have[m] = true
+		}
+		for _, m := range ms {
+			if have[m] {
+				continue
+			}
+			if err := db.AddMagnet(route, m); err != nil {
+				return res, fmt.Errorf("error adding magnet to route %s: %w", route, err)
+			}
+			res.magnets[route] = append(res.magnets[route], m)
+			res.Magnets++
+		}
+	}
+
+	for h, m := range b.Meta {
+		if mode == ImportMerge {
+			if _, err := db.GetMeta(h); err == nil {
+				continue
+			}
+		}
+		if err := db.SetMeta(h, m); err != nil {
+			return res, fmt.Errorf("error setting metadata of %s: %w", h, err)
+		}
+		res.meta[h] = m
+		res.Meta++
+	}
+
+	current, err = db.ListTags()
+	if err != nil {
+		return res, err
+	}
+	for h, tags := range b.Tags {
+		if mode == ImportMerge && len(current[h]) > 0 {
+			continue
+		}
+		tags, err := NormalizeTags(tags)
+		if err != nil {
+			return res, err
+		}
+		if err := db.SetTags(h, tags); err != nil {
+			return res, fmt.Errorf("error setting tags of %s: %w", h, err)
+		}
+		res.Tags++
+	}
+	return res, nil
+}
+
+// clearIndex removes the index entries replaced by an import.
+func clearIndex(db IndexStore, routesRoot string, keep []string) error {
+	var errs []error
+	ms, err := db.ListMagnetHashesByRoute()
+	if err != nil {
+		return err
+	}
+	for route, hs := range ms {
+		for _, h := range hs {
+			if _, err := db.RemoveFromHash(route, h); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	fs, err := db.ListFileHashesByRoute()
+	if err != nil {
+		return err
+	}
+	for route, hs := range fs {
+		for _, h := range hs {
+			errs = append(errs, db.RemoveTorrentFile(route, h))
+		}
+	}
+	metas, err := db.GetAllMeta()
+	if err != nil {
+		return err
+	}
+	for h := range metas {
+		errs = append(errs, db.DeleteMeta(h))
+	}
+	tags, err := db.ListTags()
+	if err != nil {
+		return err
+	}
+	for h := range tags {
+		errs = append(errs, db.SetTags(h, nil))
+	}
+
+	if routesRoot == "" {
+		return errors.Join(errs...)
+	}
+	kept := make(map[string]bool)
+	for _, r := range keep {
+		kept[r] = true
+	}
+	entries, err := os.ReadDir(routesRoot)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		folder := filepath.Join(routesRoot, e.Name())
+		errs = append(errs, filepath.WalkDir(folder, func(p string, d iofs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !loader.IsTorrentFile(p) {
+				return err
+			}
+			return os.Remove(p)
+		}))
+		if !kept[e.Name()] {
+			// fails, leaving the folder, when other files remain
+			_ = os.Remove(folder)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ExportIndex returns a bundle of the index of the service, holding the
+// configuration file when withConfig is set.
+func (s *Service) ExportIndex(withConfig bool) (*Bundle, error) {
+	var raw []byte
+	if withConfig {
+		s.mu.Lock()
+		ch := s.ch
+		s.mu.Unlock()
+		if ch != nil {
+			var err error
+			if raw, err = ch.GetRaw(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ExportIndex(s.db, s.routesRoot, raw)
+}
+
+// ImportIndex imports b into the running service. The configuration of the
+// bundle is saved and applied when withConfig is set. Imported torrents are
+// loaded in the background.
+func (s *Service) ImportIndex(b *Bundle, mode ImportMode, withConfig bool) (*ImportResult, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	ch := s.ch
+	s.mu.Unlock()
+	if withConfig && (b.Config == "" || ch == nil) {
+		return nil, errors.New("no configuration to import")
+	}
+
+	if mode == ImportReplace {
+		s.unloadIndex()
+	}
+	res, err := ImportIndex(s.db, s.routesRoot, b, mode)
+	if err != nil {
+		return res, err
+	}
+
+	if withConfig {
+		if err := ch.SaveRaw([]byte(b.Config)); err != nil {
+			return res, fmt.Errorf("error saving configuration: %w", err)
+		}
+		res.Config = true
+		if _, err := s.ReloadConfig(); err != nil {
+			s.log.Warn().Err(err).Msg("error applying imported configuration")
+		}
+	}
+
+	go s.loadImported(b, res)
+	return res, nil
+}
+
+// unloadIndex removes the torrents of the database and of the UI-managed
+// routes from the service.
+func (s *Service) unloadIndex() {
+	ms, err := s.db.ListMagnetHashesByRoute()
+	if err != nil {
+		s.log.Warn().Err(err).Msg("error listing magnets to unload")
+	}
+	for route, hs := range ms {
+		for _, h := range hs {
+			if err := s.RemoveFromHash(route, h); err != nil {
+				s.log.Warn().Err(err).Str("route", route).Str("hash", h).Msg("error unloading torrent")
+			}
+		}
+	}
+
+	if s.routesRoot == "" {
+		return
+	}
+	prefix := s.routesRoot + string(filepath.Separator)
+	s.mu.Lock()
+	var paths []string
+	for p := range s.pathToHash {
+		if strings.HasPrefix(p, prefix) {
+			paths = append(paths, p)
+		}
+	}
+	s.mu.Unlock()
+	for _, p := range paths {
+		route, _, _ := strings.Cut(strings.TrimPrefix(p, prefix), string(filepath.Separator))
+		s.MaybeRemoveByPath(route, p)
+	}
+}
+
+// loadImported loads the routes, torrent files and magnets written by an
+// import.
+func (s *Service) loadImported(b *Bundle, res *ImportResult) {
+	s.loadMeta(res.meta)
+
+	if s.routesRoot != "" {
+		routes := make(map[string]bool)
+		for _, r := range b.Routes {
+			routes[r] = true
+		}
+		for _, f := range b.Files {
+			routes[f.Route] = true
+		}
+		for r := range routes {
+			if err := s.CreateRoute(r); err != nil {
+				s.log.Warn().Err(err).Str("route", r).Msg("error creating imported route")
+				continue
+			}
+			if err := s.SyncRouteFolder(r, filepath.Join(s.routesRoot, r)); err != nil {
+				s.log.Warn().Err(err).Str("route", r).Msg("error loading imported route")
+			}
+		}
+	}
+
+	for route, ms := range res.magnets {
+		for _, m := range ms {
+			if err := s.addMagnet(route, m); err != nil {
+				s.log.Warn().Err(err).Str("route", route).Msg("error loading imported magnet")
+				continue
+			}
+			if h := magnetHash(m); h != "" {
+				s.mu.Lock()
+				if s.routeMagnet[route] == nil {
+					s.routeMagnet[route] = make(map[string]string)
+				}
+				s.routeMagnet[route][h] = m
+				s.mu.Unlock()
+			}
+		}
+	}
+	s.log.Info().Int("magnets", res.Magnets).Int("files", res.Files).Msg("imported index loaded")
+}
+
+// magnetHash returns the infohash of the magnet link m, or "".
+func magnetHash(m string) string {
+	spec, err := metainfo.ParseMagnetUri(m)
+	if err != nil {
+		return ""
+	}
+	return spec.InfoHash.HexString()
+}
@@ -0,0 +1,136 @@
+package torrent
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/jkaberg/distribyted/torrent/loader"
+)
+
+const (
+	bundleMagnet1 = "magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056&dn=Cosmos+Laundromat"
+	bundleMagnet2 = "magnet:?xt=urn:btih:dd8255ecdc7ca55fb0bbf81323d87062db1f6d1c&dn=Big+Buck+Bunny"
+)
+
+func newBundleIndex(t *testing.T) (IndexStore, string) {
+	dir := t.TempDir()
+	db, err := loader.NewDB(filepath.Join(dir, "magnetdb"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	root := filepath.Join(dir, "routes")
+	require.NoError(t, os.MkdirAll(root, 0744))
+	return NewIndexFromLoader(db), root
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	src, srcRoot := newBundleIndex(t)
+	require.NoError(src.AddMagnet("movies", bundleMagnet1))
+	require.NoError(src.SetMeta("c9e15763f722f23e98a29decdfae341b98d53056", []byte(`{"name":"Cosmos Laundromat"}`)))
+	require.NoError(src.SetTags("c9e15763f722f23e98a29decdfae341b98d53056", []string{"keep"}))
+	require.NoError(os.MkdirAll(filepath.Join(srcRoot, "tv", "show"), 0744))
+	require.NoError(os.WriteFile(filepath.Join(srcRoot, "tv", "show", "a.magnet"), []byte(bundleMagnet2), 0644))
+	require.NoError(os.WriteFile(filepath.Join(srcRoot, "tv", "notes.txt"), nil, 0644))
+
+	b, err := ExportIndex(src, srcRoot, []byte("routes: []\n"))
+	require.NoError(err)
+	require.Equal([]string{"tv"}, b.Routes)
+	require.Len(b.Files, 1)
+	require.Equal("show/a.magnet", b.Files[0].Path)
+
+	for _, format := range []string{BundleJSON, BundleZIP} {
+		var buf bytes.Buffer
+		require.NoError(WriteBundle(&buf, b, format))
+		got, err := ReadBundle(buf.Bytes())
+		require.NoError(err, format)
+		require.Equal(b.Magnets, got.Magnets, format)
+		require.Equal(b.Config, got.Config, format)
+		require.Equal(b.Files, got.Files, format)
+		require.Equal(b.Tags, got.Tags, format)
+	}
+
+	dst, dstRoot := newBundleIndex(t)
+	require.NoError(dst.AddMagnet("music", bundleMagnet2))
+	require.NoError(dst.SetMeta("c9e15763f722f23e98a29decdfae341b98d53056", []byte(`{"name":"kept"}`)))
+
+	res, err := ImportIndex(dst, dstRoot, b, ImportMerge)
+	require.NoError(err)
+	require.Equal(1, res.Routes)
+	require.Equal(1, res.Magnets)
+	require.Equal(1, res.Files)
+	require.Zero(res.Meta)
+	require.Equal(1, res.Tags)
+	ms, err := dst.ListMagnets()
+	require.NoError(err)
+	require.Len(ms, 2)
+	meta, err := dst.GetMeta("c9e15763f722f23e98a29decdfae341b98d53056")
+	require.NoError(err)
+	require.JSONEq(`{"name":"kept"}`, string(meta))
+	require.FileExists(filepath.Join(dstRoot, "tv", "show", "a.magnet"))
+
+	// merging again writes nothing
+	res, err = ImportIndex(dst, dstRoot, b, ImportMerge)
+	require.NoError(err)
+	require.Zero(res.Magnets + res.Files + res.Routes)
+
+	require.NoError(os.MkdirAll(filepath.Join(dstRoot, "old"), 0744))
+	require.NoError(os.WriteFile(filepath.Join(dstRoot, "old", "x.magnet"), []byte(bundleMagnet2), 0644))
+	res, err = ImportIndex(dst, dstRoot, b, ImportReplace)
+	require.NoError(err)
+	require.Equal(1, res.Magnets)
+	require.Equal(1, res.Meta)
+	ms, err = dst.ListMagnets()
+	require.NoError(err)
+	require.Equal(map[string][]string{"movies": {bundleMagnet1}}, ms)
+	require.NoDirExists(filepath.Join(dstRoot, "old"))
+	require.FileExists(filepath.Join(dstRoot, "tv", "show", "a.magnet"))
+
+	b.Files[0].Path = "../escape.magnet"
+	_, err = ImportIndex(dst, dstRoot, b, ImportMerge)
+	require.Error(err)
+}
+
+func TestBundleCheck(t *testing.T) {
+	t.Parallel()
+
+	const h = "c9e15763f722f23e98a29decdfae341b98d53056"
+	tests := []struct {
+		name string
+		b    *Bundle
+		ok   bool
+	}{
+		{name: "valid", ok: true, b: &Bundle{
+			Magnets: map[string][]string{"movies": {bundleMagnet1}},
+			Meta:    map[string]json.RawMessage{h: []byte(`{}`)},
+			Tags:    map[string][]string{h: {"keep"}},
+		}},
+		{name: "magnet route", b: &Bundle{Magnets: map[string][]string{"a/b": {bundleMagnet1}}}},
+		{name: "empty magnet route", b: &Bundle{Magnets: map[string][]string{"": {bundleMagnet1}}}},
+		{name: "meta hash with separator", b: &Bundle{Meta: map[string]json.RawMessage{h[:38] + "/x": []byte(`{}`)}}},
+		{name: "short meta hash", b: &Bundle{Meta: map[string]json.RawMessage{"abc": []byte(`{}`)}}},
+		{name: "upper case meta hash", b: &Bundle{Meta: map[string]json.RawMessage{strings.ToUpper(h): []byte(`{}`)}}},
+		{name: "tagged hash", b: &Bundle{Tags: map[string][]string{h + "/keep": {"x"}}}},
+		{name: "tag", b: &Bundle{Tags: map[string][]string{h: {"a/b"}}}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.b.Version = bundleVersion
+			if tt.ok {
+				require.NoError(t, tt.b.check())
+			} else {
+				require.Error(t, tt.b.check())
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	cfgpkg "github.com/jkaberg/distribyted/config"
+	"github.com/jkaberg/distribyted/torrent/loader"
+)
+
+// feedPoller polls the feeds of the routes until cancelled.
+type feedPoller struct {
+	cancel context.CancelFunc
+}
+
+// feedLoader returns the feed loader of the service, if any.
+func (s *Service) feedLoader() *loader.Feed {
+	for _, l := range s.loaders {
+		if fl, ok := l.(*loader.Feed); ok {
+			return fl
+		}
+	}
+	return nil
+}
+
+// StartFeeds starts polling the feeds of every route, replacing the pollers
+// already running.
+func (s *Service) StartFeeds() {
+	s.StopFeeds()
+	fl := s.feedLoader()
+	if fl == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	for route, feeds := range fl.Feeds() {
+		for _, f := range feeds {
+			n++
+			go s.runFeed(ctx, fl, route, f)
+		}
+	}
+	s.mu.Lock()
+	s.feeds = &feedPoller{cancel: cancel}
+	s.mu.Unlock()
+	if n > 0 {
+		s.log.Info().Int("feeds", n).Msg("feed polling started")
+	}
+}
+
+// StopFeeds stops polling feeds.
+func (s *Service) StopFeeds() {
+	s.mu.Lock()
+	fp := s.feeds
+	s.feeds = nil
+	s.mu.Unlock()
+	if fp != nil {
+		fp.cancel()
+	}
+}
+
+// TestFeed fetches f and returns its items, flagging the ones its filters
+// match. Nothing is added.
+func (s *Service) TestFeed(ctx context.Context, f *cfgpkg.Feed) ([]*loader.FeedItem, error) {
+	fl := s.feedLoader()
+	if fl == nil {
+		return nil, errors.New("feeds are not enabled")
+	}
+	return fl.Fetch(ctx, f)
+}
+
+func (s *Service) runFeed(ctx context.Context, fl *loader.Feed, route string, f *cfgpkg.Feed) {
+	t := time.NewTicker(f.Interval())
+	defer t.Stop()
+	for {
+		s.pollFeed(ctx, fl, route, f)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pollFeed adds the new matching items of f to route. Items that fail to be
+// added are retried on the next poll.
+func (s *Service) pollFeed(ctx context.Context, fl *loader.Feed, route string, f *cfgpkg.Feed) {
+	l := s.log.With().Str("route", route).Str("feed", f.URL).Logger()
+	items, err := fl.Poll(ctx, f)
+	if err != nil {
+		if ctx.Err() == nil {
+			l.Warn().Err(err).Msg("error polling feed")
+		}
+		return
+	}
+	for _, it := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		added, err := s.addFeedItem(ctx, fl, route, it)
+		if err != nil {
+			l.Warn().Err(err).Str("item", it.Title).Msg("error adding feed item")
+			continue
+		}
+		if added {
+			l.Info().Str("item", it.Title).Msg("feed item added")
+		} else {
+			l.Debug().Str("item", it.Title).Msg("feed item already loaded")
+		}
+		if err := fl.MarkSeen(f, it.GUID); err != nil {
+			l.Warn().Err(err).Str("item", it.Title).Msg("error marking feed item as seen")
+		}
+	}
+}
+
+// addFeedItem adds the torrent of it to route, unless a torrent with the
+// same infohash is already loaded.
+func (s *Service) addFeedItem(ctx context.Context, fl *loader.Feed, route string, it *loader.FeedItem) (bool, error) {
+	if it.InfoHash != "" && s.s.RouteOf(it.InfoHash) != "" {
+		return false, nil
+	}
+	if it.Magnet != "" {
+		if err := s.AddMagnet(route, it.Magnet); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	mi, err := fl.DownloadTorrent(ctx, it.TorrentURL)
+	if err != nil {
+		return false, err
+	}
+	h := mi.HashInfoBytes().HexString()
+	if s.s.RouteOf(h) != "" {
+		return false, nil
+	}
+	if s.routesRoot == "" {
+		return false, errors.New("no folder to store feed torrents")
+	}
+	dir := filepath.Join(filepath.Dir(s.routesRoot), "feeds", route)
+	if err := os.MkdirAll(dir, 0744); err != nil {
+		return false, err
+	}
+	p := filepath.Join(dir, h+".torrent")
+	out, err := os.Create(p)
+	if err != nil {
+		return false, err
+	}
+	if err := mi.Write(out); err != nil {
+		out.Close()
+		return false, fmt.Errorf("error writing %s: %w", p, err)
+	}
+	if err := out.Close(); err != nil {
+		return false, err
+	}
+
+	if _, err := s.AddTorrentPath(route, p); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	if s.routeFile[route] == nil {
+		s.routeFile[route] = make(map[string]string)
+	}
+	s.routeFile[route][h] = p
+	s.mu.Unlock()
+	return true, nil
+}
+
+// feedsChanged reports whether the feeds of any route differ.
+func feedsChanged(old, cur []*cfgpkg.Route) bool {
+	byRoute := func(rs []*cfgpkg.Route) map[string][]*cfgpkg.Feed {
+		m := make(map[string][]*cfgpkg.Feed)
+		for _, r := range rs {
+			if len(r.Feeds) > 0 {
+				m[r.Name] = r.Feeds
+			}
+		}
+		return m
+	}
+	return !reflect.DeepEqual(byRoute(old), byRoute(cur))
+}
@@ -0,0 +1,318 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	cfgpkg "github.com/jkaberg/distribyted/config"
+	"github.com/jkaberg/distribyted/metrics"
+)
+
+// maxHealthEvents bounds the health events kept in memory.
+const maxHealthEvents = 200
+
+// HealthEvent records an action taken, or that would be taken in dry-run
+// mode, on an unhealthy torrent.
+type HealthEvent struct {
+	Time     int64               `json:"time"`
+	Route    string              `json:"route"`
+	Hash     string              `json:"hash"`
+	Name     string              `json:"name"`
+	Seeders  int                 `json:"seeders"`
+	Failures int                 `json:"failures"`
+	Action   cfgpkg.HealthAction `json:"action"`
+	DryRun   bool                `json:"dryRun,omitempty"`
+	Error    string              `json:"error,omitempty"`
+}
+
+type healthState struct {
+	mu sync.Mutex
+	// failures counts consecutive unhealthy checks per torrent hash
+	failures map[string]int
+	events   []*HealthEvent
+}
+
+func newHealthState() *healthState {
+	return &healthState{failures: make(map[string]int)}
+}
+
+func (hs *healthState) fail(hash string) int {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.failures[hash]++
+	return hs.failures[hash]
+}
+
+func (hs *healthState) reset(hash string) {
+	hs.mu.Lock()
+	delete(hs.failures, hash)
+	hs.mu.Unlock()
+}
+
+// retain forgets the failures of torrents not in hashes.
+func (hs *healthState) retain(hashes map[string]bool) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	for h := range hs.failures {
+		if !hashes[h] {
+			delete(hs.failures, h)
+		}
+	}
+}
+
+func (hs *healthState) record(e *HealthEvent) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.events = append(hs.events, e)
+	if len(hs.events) > maxHealthEvents {
+		hs.events = hs.events[len(hs.events)-maxHealthEvents:]
+	}
+}
+
+// HealthEvents returns the recent health events, newest first.
+func (s *Service) HealthEvents() []*HealthEvent {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	out := make([]*HealthEvent, 0, len(s.health.events))
+	for i := len(s.health.events) - 1; i >= 0; i-- {
+		out = append(out, s.health.events[i])
+	}
+	return out
+}
+
+// unhealthyTorrent is the subject of health actions.
+type unhealthyTorrent struct {
+	Route    string
+	Hash     string
+	Name     string
+	Seeders  int
+	Failures int
+	// Clients are the Arr instances managing the route
+	Clients []arrClient
+}
+
+// healthActionFunc applies a policy action to an unhealthy torrent.
+type healthActionFunc func(s *Service, u *unhealthyTorrent) error
+
+// healthActions maps configured action names to their implementation.
+var healthActions = map[cfgpkg.HealthAction]healthActionFunc{
+	cfgpkg.HealthNotify:     notifyAction,
+	cfgpkg.HealthReannounce: reannounceAction,
+	cfgpkg.HealthTag:        tagAction,
+	cfgpkg.HealthBlacklist:  blacklistAction,
+	cfgpkg.HealthDelete:     deleteAction,
+}
+
+func notifyAction(s *Service, u *unhealthyTorrent) error {
+	s.log.Warn().Str("route", u.Route).Str("hash", u.Hash).Str("name", u.Name).
+		Int("seeders", u.Seeders).Int("failures", u.Failures).Msg("unhealthy torrent")
+	return nil
+}
+
+func reannounceAction(s *Service, u *unhealthyTorrent) error {
+	conf, err := s.ConfigSnapshot()
+	if err != nil {
+		return err
+	}
+	var trackers []string
+	if conf != nil && conf.Torrent != nil {
+		trackers = extraTrackers(conf.Torrent)
+	}
+	if len(trackers) == 0 {
+		return errors.New("no extra trackers configured")
+	}
+	t, ok := s.c.Torrent(metainfo.NewHashFromHex(u.Hash))
+	if !ok {
+		return ErrTorrentNotFound
+	}
+	t.AddTrackers([][]string{trackers})
+	return nil
+}
+
+// unhealthyTag is the torrent tag set by the tag action.
+const unhealthyTag = "unhealthy"
+
+func tagAction(s *Service, u *unhealthyTorrent) error {
+	s.s.SetUnhealthy(u.Hash, true)
+	return s.AddTags([]string{u.Hash}, []string{unhealthyTag})
+}
+
+func blacklistAction(s *Service, u *unhealthyTorrent) error {
+	if len(u.Clients) == 0 {
+		return errors.New("no Arr instance manages this route")
+	}
+	return blacklistInArr(u.Clients, &arrRelease{Hash: u.Hash, Name: u.Name})
+}
+
+func deleteAction(s *Service, u *unhealthyTorrent) error {
+	return s.removeTorrent(u.Route, u.Hash)
+}
+
+// blacklistInArr asks every client managing the release to blocklist it and
+// request a replacement.
+func blacklistInArr(clients []arrClient, r *arrRelease) error {
+	var errs []error
+	for _, c := range clients {
+		if err := c.replace(r); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.instance().Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HealthMonitor periodically evaluates torrent health and interacts with Arr
+type HealthMonitor struct {
+	s        *Service
+	stop     chan struct{}
+	interval time.Duration
+	grace    time.Duration
+	minSeed  int
+	arr      []*cfgpkg.ArrInstance
+	conf     *cfgpkg.Health
+	// lastBytes is only used by the run goroutine
+	lastBytes map[string]sampleBase
+}
+
+func (hm *HealthMonitor) run() {
+	check := time.NewTicker(hm.interval)
+	defer check.Stop()
+	sample := time.NewTicker(healthSampleInterval)
+	defer sample.Stop()
+	prune := time.NewTicker(healthPruneInterval)
+	defer prune.Stop()
+
+	hm.pruneHistory()
+	hm.sample()
+	hm.checkOnce()
+	for {
+		select {
+		case <-sample.C:
+			hm.sample()
+		case <-check.C:
+			hm.checkOnce()
+		case <-prune.C:
+			hm.pruneHistory()
+		case <-hm.stop:
+			return
+		}
+	}
+}
+
+func (hm *HealthMonitor) Stop() { close(hm.stop) }
+
+func (hm *HealthMonitor) checkOnce() {
+	// Restrict to Arr-managed routes when possible
+	catToClients := hm.s.arrClientsByRoute(hm.arr)
+	routes := hm.s.s.RoutesStats()
+	tags := hm.s.TorrentTags()
+	now := time.Now()
+	loaded := make(map[string]bool)
+	for _, rs := range routes {
+		for _, ts := range rs.TorrentStats {
+			loaded[ts.Hash] = true
+		}
+		// if arr-managed categories configured, skip routes that don't match
+		if len(catToClients) > 0 {
+			if _, ok := catToClients[rs.Name]; !ok {
+				continue
+			}
+		}
+		for _, ts := range rs.TorrentStats {
+			// the tag outlives restarts, the flag does not
+			tagged := hasTags(tags[ts.Hash], []string{unhealthyTag})
+			if tagged && !ts.Unhealthy {
+				hm.s.s.SetUnhealthy(ts.Hash, true)
+			}
+			if ts.AddedAt > 0 && now.Sub(time.Unix(ts.AddedAt, 0)) < hm.grace {
+				continue
+			}
+			if hm.unhealthy(ts) {
+				hm.handleUnhealthy(rs.Name, ts, catToClients[rs.Name])
+				continue
+			}
+			hm.s.health.reset(ts.Hash)
+			if ts.Unhealthy || tagged {
+				hm.s.s.SetUnhealthy(ts.Hash, false)
+			}
+			if tagged {
+				if err := hm.s.RemoveTags([]string{ts.Hash}, []string{unhealthyTag}); err != nil {
+					hm.s.log.Warn().Err(err).Str("hash", ts.Hash).Msg("error untagging healthy torrent")
+				}
+			}
+		}
+	}
+	// removed torrents would otherwise keep their count forever
+	hm.s.health.retain(loaded)
+}
+
+// unhealthy judges a torrent on its trend over the configured window, or on
+// the latest stats while the history is too short.
+func (hm *HealthMonitor) unhealthy(ts *TorrentStats) bool {
+	tr, err := hm.s.HealthTrend(ts.Hash, hm.conf.Window())
+	if err != nil {
+		hm.s.log.Warn().Err(err).Str("hash", ts.Hash).Msg("error reading health history")
+	} else if tr.Samples >= 2 {
+		return tr.unhealthy(hm.minSeed, hm.conf.MinAvailability)
+	}
+	if m := hm.conf.MinAvailability; m > 0 && ts.Availability >= m {
+		return false
+	}
+	// Unknown or zero seeders => unhealthy
+	return ts.Seeders <= 0 || ts.Seeders < hm.minSeed
+}
+
+func (hm *HealthMonitor) handleUnhealthy(route string, ts *TorrentStats, clients []arrClient) {
+	failures := hm.s.health.fail(ts.Hash)
+	actions, threshold := hm.conf.PolicyFor(route)
+	if failures < threshold {
+		hm.s.log.Debug().Str("route", route).Str("hash", ts.Hash).Int("failures", failures).Int("threshold", threshold).Msg("torrent unhealthy, below failure threshold")
+		return
+	}
+	hm.s.health.reset(ts.Hash)
+
+	u := &unhealthyTorrent{
+		Route:    route,
+		Hash:     ts.Hash,
+		Name:     ts.Name,
+		Seeders:  ts.Seeders,
+		Failures: failures,
+		Clients:  clients,
+	}
+	for _, a := range actions {
+		ev := &HealthEvent{
+			Time:     time.Now().Unix(),
+			Route:    route,
+			Hash:     ts.Hash,
+			Name:     ts.Name,
+			Seeders:  ts.Seeders,
+			Failures: failures,
+			Action:   a,
+			DryRun:   hm.conf.DryRun,
+		}
+		l := hm.s.log.Info().Str("route", route).Str("hash", ts.Hash).Str("action", string(a))
+		result := metrics.ResultOK
+		switch f, ok := healthActions[a]; {
+		case !ok:
+			ev.Error = fmt.Sprintf("unknown health action %q", a)
+		case hm.conf.DryRun:
+			result = metrics.ResultDryRun
+			l.Msg("dry run: would apply health action")
+		default:
+			if err := f(hm.s, u); err != nil {
+				ev.Error = err.Error()
+			} else {
+				l.Msg("health action applied")
+			}
+		}
+		if ev.Error != "" {
+			result = metrics.ResultError
+			hm.s.log.Warn().Str("route", route).Str("hash", ts.Hash).Str("action", string(a)).Str("error", ev.Error).Msg("health action failed")
+		}
+		metrics.HealthAction(string(a), result)
+		hm.s.health.record(ev)
+	}
+}
@@ -0,0 +1,311 @@
+package torrent
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	cfgpkg "github.com/jkaberg/distribyted/config"
+)
+
+// fakeIndex is an IndexStore keeping health samples and removals in memory.
+// Methods not overridden are not implemented.
+type fakeIndex struct {
+	IndexStore
+
+	mu      sync.Mutex
+	samples map[string][][]byte
+	tags    map[string][]string
+	removed []string
+}
+
+func newFakeIndex() *fakeIndex {
+	return &fakeIndex{samples: make(map[string][][]byte), tags: make(map[string][]string)}
+}
+
+func (f *fakeIndex) AddMagnet(route, magnet string) error { return nil }
+
+func (f *fakeIndex) RemoveFromHash(route, hash string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed = append(f.removed, hash)
+	return true, nil
+}
+
+func (f *fakeIndex) RemoveTorrentFile(route, hash string) error { return nil }
+func (f *fakeIndex) DeleteMeta(hash string) error               { return nil }
+func (f *fakeIndex) DeleteHealthSamples(hash string) error      { return nil }
+
+func (f *fakeIndex) SetTags(hash string, tags []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(tags) == 0 {
+		delete(f.tags, hash)
+	} else {
+		f.tags[hash] = tags
+	}
+	return nil
+}
+
+func (f *fakeIndex) ListTags() (map[string][]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make(map[string][]string, len(f.tags))
+	for h, t := range f.tags {
+		out[h] = t
+	}
+	return out, nil
+}
+
+func (f *fakeIndex) AddHealthSample(hash string, at int64, sample []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.samples[hash] = append(f.samples[hash], sample)
+	return nil
+}
+
+func (f *fakeIndex) HealthSamples(hash string, since int64) ([][]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.samples[hash], nil
+}
+
+// fakeArr is an Arr client recording the releases it is asked to replace.
+type fakeArr struct {
+	err      error
+	replaced []*arrRelease
+}
+
+func (a *fakeArr) instance() *cfgpkg.ArrInstance {
+	return &cfgpkg.ArrInstance{Name: "sonarr", Type: cfgpkg.ArrSonarr}
+}
+
+func (a *fakeArr) categories() (map[string]struct{}, error) {
+	return map[string]struct{}{"tv": {}}, nil
+}
+
+func (a *fakeArr) systemStatus() (*ArrSystemStatus, error) {
+	return &ArrSystemStatus{AppName: "Sonarr"}, nil
+}
+
+func (a *fakeArr) replace(r *arrRelease) error {
+	a.replaced = append(a.replaced, r)
+	return a.err
+}
+
+func newTestMonitor(t *testing.T, conf *cfgpkg.Health) (*HealthMonitor, *fakeIndex) {
+	s := newTestService(t, "tv", "movies")
+	idx := newFakeIndex()
+	s.db = idx
+	return &HealthMonitor{s: s, conf: conf, minSeed: conf.MinSeeders}, idx
+}
+
+func TestHandleUnhealthy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		conf    *cfgpkg.Health
+		route   string
+		checks  int
+		arrErr  error
+		events  []cfgpkg.HealthAction
+		errors  int
+		dryRun  bool
+		removed bool
+		tagged  bool
+		blocked bool
+	}{
+		{
+			name:    "default actions",
+			conf:    &cfgpkg.Health{},
+			route:   "tv",
+			checks:  1,
+			events:  []cfgpkg.HealthAction{cfgpkg.HealthBlacklist, cfgpkg.HealthDelete},
+			removed: true,
+			blocked: true,
+		},
+		{
+			name:   "below threshold",
+			conf:   &cfgpkg.Health{FailureThreshold: 3, Actions: []cfgpkg.HealthAction{cfgpkg.HealthTag}},
+			route:  "tv",
+			checks: 2,
+		},
+		{
+			name:   "threshold reached",
+			conf:   &cfgpkg.Health{FailureThreshold: 3, Actions: []cfgpkg.HealthAction{cfgpkg.HealthTag}},
+			route:  "tv",
+			checks: 3,
+			events: []cfgpkg.HealthAction{cfgpkg.HealthTag},
+			tagged: true,
+		},
+		{
+			name:   "dry run",
+			conf:   &cfgpkg.Health{DryRun: true, Actions: []cfgpkg.HealthAction{cfgpkg.HealthTag, cfgpkg.HealthBlacklist, cfgpkg.HealthDelete}},
+			route:  "tv",
+			checks: 1,
+			events: []cfgpkg.HealthAction{cfgpkg.HealthTag, cfgpkg.HealthBlacklist, cfgpkg.HealthDelete},
+			dryRun: true,
+		},
+		{
+			name: "route policy",
+			conf: &cfgpkg.Health{
+				Actions:  []cfgpkg.HealthAction{cfgpkg.HealthDelete},
+				Policies: []*cfgpkg.HealthPolicy{{Route: "tv", Actions: []cfgpkg.HealthAction{cfgpkg.HealthNotify}, FailureThreshold: 2}},
+			},
+			route:  "tv",
+			checks: 2,
+			events: []cfgpkg.HealthAction{cfgpkg.HealthNotify},
+		},
+		{
+			name: "route without policy",
+			conf: &cfgpkg.Health{
+				Actions:  []cfgpkg.HealthAction{cfgpkg.HealthDelete},
+				Policies: []*cfgpkg.HealthPolicy{{Route: "tv", Actions: []cfgpkg.HealthAction{cfgpkg.HealthNotify}, FailureThreshold: 2}},
+			},
+			route:   "movies",
+			checks:  1,
+			events:  []cfgpkg.HealthAction{cfgpkg.HealthDelete},
+			removed: true,
+		},
+		{
+			name:    "failed actions",
+			conf:    &cfgpkg.Health{Actions: []cfgpkg.HealthAction{cfgpkg.HealthBlacklist, "explode", cfgpkg.HealthReannounce}},
+			route:   "tv",
+			checks:  1,
+			arrErr:  errors.New("queue item not found"),
+			events:  []cfgpkg.HealthAction{cfgpkg.HealthBlacklist, "explode", cfgpkg.HealthReannounce},
+			errors:  3,
+			blocked: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require := require.New(t)
+
+			hm, idx := newTestMonitor(t, tt.conf)
+			addTestTorrent(t, hm.s, tt.route, hookEpisode, false)
+			arr := &fakeArr{err: tt.arrErr}
+			ts := &TorrentStats{Hash: hookEpisode, Name: "Show.S01E03", Seeders: 0}
+			for i := 0; i < tt.checks; i++ {
+				hm.handleUnhealthy(tt.route, ts, []arrClient{arr})
+			}
+
+			events := hm.s.HealthEvents()
+			var actions []cfgpkg.HealthAction
+			errs := 0
+			for _, e := range events {
+				actions = append([]cfgpkg.HealthAction{e.Action}, actions...)
+				require.Equal(tt.dryRun, e.DryRun)
+				require.Equal(tt.route, e.Route)
+				require.Equal(tt.checks, e.Failures)
+				if e.Error != "" {
+					errs++
+				}
+			}
+			require.Equal(tt.events, actions)
+			require.Equal(tt.errors, errs)
+
+			require.Equal(tt.removed, len(idx.removed) == 1)
+			require.Equal(tt.removed, hm.s.s.RouteOf(hookEpisode) == "")
+			st, err := hm.s.s.Stats(hookEpisode)
+			require.Equal(tt.tagged, err == nil && st.Unhealthy)
+			require.Equal(tt.tagged, hasTags(hm.s.TorrentTags()[hookEpisode], []string{unhealthyTag}))
+			if tt.blocked {
+				require.Equal([]*arrRelease{{Hash: hookEpisode, Name: "Show.S01E03"}}, arr.replaced)
+			} else {
+				require.Empty(arr.replaced)
+			}
+		})
+	}
+}
+
+func TestCheckOnce(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	hm, idx := newTestMonitor(t, &cfgpkg.Health{FailureThreshold: 2, Actions: []cfgpkg.HealthAction{cfgpkg.HealthTag}})
+	addTestTorrent(t, hm.s, "tv", hookEpisode, false)
+	hm.s.health.fail(hookPack)
+
+	failures := func(hash string) int {
+		hm.s.health.mu.Lock()
+		defer hm.s.health.mu.Unlock()
+		return hm.s.health.failures[hash]
+	}
+
+	// counts of torrents no longer loaded are dropped
+	hm.checkOnce()
+	require.Equal(0, failures(hookPack))
+	require.Equal(1, failures(hookEpisode))
+
+	hm.checkOnce()
+	require.Equal(0, failures(hookEpisode))
+	require.Equal([]string{unhealthyTag}, hm.s.TorrentTags()[hookEpisode])
+
+	// the persisted tag restores the flag
+	hm.s.s.SetUnhealthy(hookEpisode, false)
+	hm.checkOnce()
+	st, err := hm.s.s.Stats(hookEpisode)
+	require.NoError(err)
+	require.True(st.Unhealthy)
+
+	// recovering clears both
+	for _, ago := range []time.Duration{50 * time.Minute, 10 * time.Minute} {
+		b, err := json.Marshal(&HealthSample{Time: time.Now().Add(-ago).Unix(), Seeders: 5})
+		require.NoError(err)
+		require.NoError(idx.AddHealthSample(hookEpisode, 0, b))
+	}
+	hm.checkOnce()
+	st, err = hm.s.s.Stats(hookEpisode)
+	require.NoError(err)
+	require.False(st.Unhealthy)
+	require.Empty(hm.s.TorrentTags()[hookEpisode])
+	require.Equal(0, failures(hookEpisode))
+}
+
+func TestHealthThresholds(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	hm, idx := newTestMonitor(t, &cfgpkg.Health{MinSeeders: 3, MinAvailability: 1.5})
+	sample := func(hash string, ago time.Duration, seeders int, avail float64) {
+		b, err := json.Marshal(&HealthSample{Time: time.Now().Add(-ago).Unix(), Seeders: seeders, Availability: avail})
+		require.NoError(err)
+		require.NoError(idx.AddHealthSample(hash, 0, b))
+	}
+
+	// without history the latest stats decide
+	require.True(hm.unhealthy(&TorrentStats{Hash: "a", Seeders: 2}))
+	require.False(hm.unhealthy(&TorrentStats{Hash: "a", Seeders: 3}))
+	require.False(hm.unhealthy(&TorrentStats{Hash: "a", Seeders: 0, Availability: 2}))
+
+	// a window below the minimum without recovering
+	sample("b", 50*time.Minute, 2, 0)
+	sample("b", 10*time.Minute, 1, 0)
+	require.True(hm.unhealthy(&TorrentStats{Hash: "b", Seeders: 5}))
+
+	// seeders rising
+	sample("c", 50*time.Minute, 0, 0)
+	sample("c", 10*time.Minute, 2, 0)
+	require.False(hm.unhealthy(&TorrentStats{Hash: "c"}))
+
+	// the minimum met once in the window
+	sample("d", 50*time.Minute, 4, 0)
+	sample("d", 10*time.Minute, 0, 0)
+	require.False(hm.unhealthy(&TorrentStats{Hash: "d"}))
+
+	// enough distributed copies
+	sample("e", 50*time.Minute, 1, 1.6)
+	sample("e", 10*time.Minute, 0, 0.4)
+	require.False(hm.unhealthy(&TorrentStats{Hash: "e"}))
+}
@@ -0,0 +1,166 @@
+package torrent
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// healthSampleInterval is how often the health monitor records samples.
+const healthSampleInterval = 5 * time.Minute
+
+// healthPruneInterval is how often samples past the retention are dropped.
+const healthPruneInterval = 6 * time.Hour
+
+// HealthSample is a point of the health history of a torrent.
+type HealthSample struct {
+	Time    int64 `json:"time"`
+	Seeders int   `json:"seeders"`
+	Peers   int   `json:"peers"`
+	// DownRate is the useful download rate since the previous sample, in bytes/s
+	DownRate float64 `json:"downRate"`
+	// Availability is the number of distributed copies
+	Availability float64 `json:"availability"`
+}
+
+// HealthTrend summarises the health samples of a window.
+type HealthTrend struct {
+	Samples     int     `json:"samples"`
+	MinSeeders  int     `json:"minSeeders"`
+	MaxSeeders  int     `json:"maxSeeders"`
+	AvgSeeders  float64 `json:"avgSeeders"`
+	AvgPeers    float64 `json:"avgPeers"`
+	AvgDownRate float64 `json:"avgDownRate"`
+	// MaxAvailability is the best distributed copies seen in the window
+	MaxAvailability float64 `json:"maxAvailability"`
+	// SeedersSlope is the least squares slope of seeders, per hour
+	SeedersSlope float64 `json:"seedersSlope"`
+}
+
+// unhealthy reports whether the torrent stayed below minSeed seeders (at
+// least one) for the whole window without recovering. With minAvail set, a
+// swarm holding that many distributed copies at some point keeps the
+// torrent healthy.
+func (t *HealthTrend) unhealthy(minSeed int, minAvail float64) bool {
+	if minSeed < 1 {
+		minSeed = 1
+	}
+	if minAvail > 0 && t.MaxAvailability >= minAvail {
+		return false
+	}
+	return t.MaxSeeders < minSeed && t.SeedersSlope <= 0
+}
+
+func trendOf(samples []*HealthSample) *HealthTrend {
+	t := &HealthTrend{Samples: len(samples)}
+	if len(samples) == 0 {
+		return t
+	}
+	t.MinSeeders = samples[0].Seeders
+	var sx, sy, sxx, sxy float64
+	t0 := samples[0].Time
+	for _, s := range samples {
+		if s.Seeders < t.MinSeeders {
+			t.MinSeeders = s.Seeders
+		}
+		if s.Seeders > t.MaxSeeders {
+			t.MaxSeeders = s.Seeders
+		}
+		t.AvgSeeders += float64(s.Seeders)
+		t.AvgPeers += float64(s.Peers)
+		t.AvgDownRate += s.DownRate
+		if s.Availability > t.MaxAvailability {
+			t.MaxAvailability = s.Availability
+		}
+
+		x := float64(s.Time-t0) / 3600
+		y := float64(s.Seeders)
+		sx, sy, sxx, sxy = sx+x, sy+y, sxx+x*x, sxy+x*y
+	}
+	n := float64(len(samples))
+	t.AvgSeeders /= n
+	t.AvgPeers /= n
+	t.AvgDownRate /= n
+	if d := n*sxx - sx*sx; d != 0 {
+		t.SeedersSlope = (n*sxy - sx*sy) / d
+	}
+	return t
+}
+
+// HealthHistory returns the health samples of a torrent taken since the
+// given time, oldest first.
+func (s *Service) HealthHistory(hash string, since time.Time) ([]*HealthSample, error) {
+	raw, err := s.db.HealthSamples(hash, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*HealthSample, 0, len(raw))
+	for _, b := range raw {
+		var hs HealthSample
+		if err := json.Unmarshal(b, &hs); err != nil {
+			continue
+		}
+		out = append(out, &hs)
+	}
+	return out, nil
+}
+
+// HealthTrend summarises the health samples of a torrent over window.
+func (s *Service) HealthTrend(hash string, window time.Duration) (*HealthTrend, error) {
+	samples, err := s.HealthHistory(hash, time.Now().Add(-window))
+	if err != nil {
+		return nil, err
+	}
+	return trendOf(samples), nil
+}
+
+// sampleBase is the cumulative download counter at the previous sample.
+type sampleBase struct {
+	bytes int64
+	at    time.Time
+}
+
+// sample records a health sample for every torrent.
+func (hm *HealthMonitor) sample() {
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, rs := range hm.s.s.RoutesStats() {
+		for _, ts := range rs.TorrentStats {
+			seen[ts.Hash] = true
+			hs := &HealthSample{Time: now.Unix(), Seeders: ts.Seeders, Peers: ts.Peers, Availability: ts.Availability}
+			if t, ok := hm.s.c.Torrent(metainfo.NewHashFromHex(ts.Hash)); ok {
+				st := t.Stats()
+				b := st.BytesReadUsefulData.Int64()
+				if prev, ok := hm.lastBytes[ts.Hash]; ok && b >= prev.bytes {
+					hs.DownRate = float64(b-prev.bytes) / now.Sub(prev.at).Seconds()
+				}
+				hm.lastBytes[ts.Hash] = sampleBase{bytes: b, at: now}
+			}
+			raw, err := json.Marshal(hs)
+			if err != nil {
+				continue
+			}
+			if err := hm.s.db.AddHealthSample(ts.Hash, hs.Time, raw); err != nil {
+				hm.s.log.Warn().Err(err).Str("hash", ts.Hash).Msg("error storing health sample")
+			}
+		}
+	}
+	for h := range hm.lastBytes {
+		if !seen[h] {
+			delete(hm.lastBytes, h)
+		}
+	}
+}
+
+// pruneHistory drops samples older than the retention period.
+func (hm *HealthMonitor) pruneHistory() {
+	n, err := hm.s.db.PruneHealthSamples(time.Now().Add(-hm.conf.HistoryRetention()).Unix())
+	if err != nil {
+		hm.s.log.Warn().Err(err).Msg("error pruning health history")
+		return
+	}
+	if n > 0 {
+		hm.s.log.Debug().Int("samples", n).Msg("pruned health history")
+	}
+}
@@ -0,0 +1,51 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrendOf(t *testing.T) {
+	t.Parallel()
+
+	samples := func(seeders ...int) []*HealthSample {
+		out := make([]*HealthSample, len(seeders))
+		for i, s := range seeders {
+			out[i] = &HealthSample{Time: int64(i) * 3600, Seeders: s, Peers: 2 * s, Availability: float64(s) / 2}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		samples   []*HealthSample
+		min, max  int
+		avg       float64
+		slope     float64
+		unhealthy bool
+	}{
+		{name: "empty", unhealthy: true},
+		{name: "improving", samples: samples(0, 0, 1, 2), min: 0, max: 2, avg: 0.75, slope: 0.7},
+		{name: "degrading", samples: samples(2, 1, 0, 0), min: 0, max: 2, avg: 0.75, slope: -0.7, unhealthy: true},
+		{name: "dead", samples: samples(0, 0, 0), unhealthy: true},
+		{name: "recovering from zero", samples: samples(0, 0, 0, 1), max: 1, avg: 0.25, slope: 0.3},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require := require.New(t)
+
+			tr := trendOf(tt.samples)
+			require.Equal(len(tt.samples), tr.Samples)
+			require.Equal(tt.min, tr.MinSeeders)
+			require.Equal(tt.max, tr.MaxSeeders)
+			require.InDelta(tt.avg, tr.AvgSeeders, 1e-9)
+			require.InDelta(2*tt.avg, tr.AvgPeers, 1e-9)
+			require.InDelta(float64(tt.max)/2, tr.MaxAvailability, 1e-9)
+			require.InDelta(tt.slope, tr.SeedersSlope, 1e-9)
+			require.Equal(tt.unhealthy, tr.unhealthy(3, 0))
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package torrent
 
 import (
+	"errors"
+
 	"github.com/jkaberg/distribyted/torrent/loader"
 )
 
@@ -27,9 +29,66 @@ type IndexStore interface {
 	// Fast hash listing
 	ListMagnetHashesByRoute() (map[string][]string, error)
 	ListFileHashesByRoute() (map[string][]string, error)
+
+	// Health history
+	AddHealthSample(hash string, at int64, sample []byte) error
+	HealthSamples(hash string, since int64) ([][]byte, error)
+	PruneHealthSamples(before int64) (int, error)
+	DeleteHealthSamples(hash string) error
+
+	// Feed items already handled
+	FeedSeen(feed, guid string) (bool, error)
+	MarkFeedSeen(feed, guid string) error
+
+	// Torrent tags by hash
+	SetTags(hash string, tags []string) error
+	ListTags() (map[string][]string, error)
 }
 
 // indexFromLoader adapts the existing loader.DB to IndexStore.
 type indexFromLoader struct{ loader.LoaderAdder }
 
 func NewIndexFromLoader(l loader.LoaderAdder) IndexStore { return &indexFromLoader{LoaderAdder: l} }
+
+// indexMaintainer is implemented by index stores reporting their size and
+// supporting manual compaction.
+type indexMaintainer interface {
+	Stats() (*loader.IndexStats, error)
+	Compact() error
+}
+
+func (i *indexFromLoader) Stats() (*loader.IndexStats, error) {
+	m, ok := i.LoaderAdder.(indexMaintainer)
+	if !ok {
+		return nil, errIndexMaintenance
+	}
+	return m.Stats()
+}
+
+func (i *indexFromLoader) Compact() error {
+	m, ok := i.LoaderAdder.(indexMaintainer)
+	if !ok {
+		return errIndexMaintenance
+	}
+	return m.Compact()
+}
+
+var errIndexMaintenance = errors.New("index store does not support maintenance")
+
+// IndexStats returns the size of the index database.
+func (s *Service) IndexStats() (*loader.IndexStats, error) {
+	m, ok := s.db.(indexMaintainer)
+	if !ok {
+		return nil, errIndexMaintenance
+	}
+	return m.Stats()
+}
+
+// CompactIndex reclaims the space left by deleted entries of the index.
+func (s *Service) CompactIndex() error {
+	m, ok := s.db.(indexMaintainer)
+	if !ok {
+		return errIndexMaintenance
+	}
+	return m.Compact()
+}
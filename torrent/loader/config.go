@@ -1,11 +1,16 @@
 package loader
 
-import "github.com/jkaberg/distribyted/config"
+import (
+	"sync"
+
+	"github.com/jkaberg/distribyted/config"
+)
 
 var _ Loader = &Config{}
 
 type Config struct {
-	c []*config.Route
+	mu sync.RWMutex
+	c  []*config.Route
 }
 
 func NewConfig(r []*config.Route) *Config {
@@ -14,7 +19,17 @@ func NewConfig(r []*config.Route) *Config {
 	}
 }
 
+// SetRoutes replaces the routes used by the loader after a configuration reload.
+func (l *Config) SetRoutes(r []*config.Route) {
+	l.mu.Lock()
+	l.c = r
+	l.mu.Unlock()
+}
+
 func (l *Config) ListMagnets() (map[string][]string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	out := make(map[string][]string)
 	for _, r := range l.c {
 		for _, t := range r.Torrents {
@@ -30,6 +45,9 @@ func (l *Config) ListMagnets() (map[string][]string, error) {
 }
 
 func (l *Config) ListTorrentPaths() (map[string][]string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	out := make(map[string][]string)
 	for _, r := range l.c {
 		for _, t := range r.Torrents {
@@ -1,10 +1,18 @@
 package loader
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/dgraph-io/badger/v3"
+	"github.com/jkaberg/distribyted/config"
 	dlog "github.com/jkaberg/distribyted/log"
 	"github.com/rs/zerolog/log"
 )
@@ -14,9 +22,30 @@ var _ LoaderAdder = &DB{}
 const routeRootKey = "/route/"
 const metaRootKey = "/meta/"
 const fileRootKey = "/file/"
+const healthRootKey = "/health/"
+const feedRootKey = "/feed/"
+const tagRootKey = "/tag/"
+
+// Badger maintenance schedule: the value log is garbage collected every
+// gcInterval and the LSM tree flattened every flattenInterval.
+const (
+	gcInterval      = 10 * time.Minute
+	flattenInterval = 24 * time.Hour
+	// statsTTL bounds how often key prefixes are scanned for Stats
+	statsTTL = time.Minute
+)
 
 type DB struct {
 	db *badger.DB
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu          sync.Mutex
+	lastGC      time.Time
+	lastCompact time.Time
+	stats       *IndexStats
+	statsAt     time.Time
 }
 
 func NewDB(path string) (*DB, error) {
@@ -36,9 +65,120 @@ func NewDB(path string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{
-		db: db,
-	}, nil
+	d := &DB{
+		db:     db,
+		done:   make(chan struct{}),
+		lastGC: time.Now(),
+	}
+	d.wg.Add(1)
+	go d.maintain()
+	return d, nil
+}
+
+// maintain runs the scheduled value log GC and flattening until Close.
+func (l *DB) maintain() {
+	defer l.wg.Done()
+	gc := time.NewTicker(gcInterval)
+	defer gc.Stop()
+	flatten := time.NewTicker(flattenInterval)
+	defer flatten.Stop()
+	for {
+		select {
+		case <-gc.C:
+			if err := l.runGC(); err != nil {
+				log.Warn().Err(err).Str("component", "torrent-store").Msg("error collecting value log garbage")
+			}
+		case <-flatten.C:
+			if err := l.Compact(); err != nil {
+				log.Warn().Err(err).Str("component", "torrent-store").Msg("error compacting database")
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// runGC rewrites value log files until none is worth rewriting.
+func (l *DB) runGC() error {
+	defer func() {
+		l.mu.Lock()
+		l.lastGC = time.Now()
+		l.mu.Unlock()
+	}()
+	for {
+		select {
+		case <-l.done:
+			return nil
+		default:
+		}
+		err := l.db.RunValueLogGC(0.5)
+		if err == badger.ErrNoRewrite || err == badger.ErrRejected {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Compact flattens the LSM tree into a single level and collects value log
+// garbage.
+func (l *DB) Compact() error {
+	if err := l.db.Flatten(1); err != nil {
+		return err
+	}
+	if err := l.runGC(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.lastCompact = time.Now()
+	l.stats = nil
+	l.mu.Unlock()
+	return nil
+}
+
+// Stats returns the size of the database and of each key prefix. Prefix
+// sizes are estimates refreshed at most every minute.
+func (l *DB) Stats() (*IndexStats, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stats == nil || time.Since(l.statsAt) > statsTTL {
+		prefixes, err := l.prefixStats()
+		if err != nil {
+			return nil, err
+		}
+		l.stats, l.statsAt = &IndexStats{Backend: config.IndexBadger, Prefixes: prefixes}, time.Now()
+	}
+	lsm, vlog := l.db.Size()
+	st := *l.stats
+	st.Size, st.LSMSize, st.ValueLogSize = lsm+vlog, lsm, vlog
+	st.LastGC, st.LastCompact = l.lastGC, l.lastCompact
+	return &st, nil
+}
+
+func (l *DB) prefixStats() (map[string]*PrefixStats, error) {
+	out := make(map[string]*PrefixStats)
+	for _, p := range []string{routeRootKey, metaRootKey, fileRootKey, healthRootKey, feedRootKey, tagRootKey} {
+		out[strings.Trim(p, "/")] = &PrefixStats{}
+	}
+	err := l.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := string(it.Item().Key())
+			name, _, _ := strings.Cut(strings.TrimPrefix(key, "/"), "/")
+			ps, ok := out[name]
+			if !ok {
+				continue
+			}
+			ps.Keys++
+			ps.Bytes += it.Item().EstimatedSize()
+		}
+		return nil
+	})
+	return out, err
 }
 
 func (l *DB) AddMagnet(r, m string) error {
@@ -247,6 +387,181 @@ func (l *DB) ListFileHashesByRoute() (map[string][]string, error) {
 	return out, nil
 }
 
+// healthSampleKey orders samples of a hash by time: /health/<hash>/<unix>
+func healthSampleKey(hash string, at int64) []byte {
+	return []byte(path.Join(healthRootKey, hash, fmt.Sprintf("%020d", at)))
+}
+
+// AddHealthSample stores a JSON-encoded health sample taken at unix time at
+func (l *DB) AddHealthSample(hash string, at int64, sample []byte) error {
+	return l.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(healthSampleKey(hash, at), sample)
+	})
+}
+
+// HealthSamples returns the samples of hash taken at or after since, oldest first
+func (l *DB) HealthSamples(hash string, since int64) ([][]byte, error) {
+	tx := l.db.NewTransaction(false)
+	defer tx.Discard()
+	it := tx.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+	var out [][]byte
+	prefix := []byte(path.Join(healthRootKey, hash) + "/")
+	for it.Seek(healthSampleKey(hash, since)); it.ValidForPrefix(prefix); it.Next() {
+		b, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// PruneHealthSamples deletes every sample taken before unix time before
+func (l *DB) PruneHealthSamples(before int64) (int, error) {
+	var keys [][]byte
+	err := l.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(healthRootKey)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			_, ts := path.Split(string(key))
+			if at, err := strconv.ParseInt(ts, 10, 64); err == nil && at < before {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), l.deleteKeys(keys)
+}
+
+// DeleteHealthSamples deletes every sample of hash
+func (l *DB) DeleteHealthSamples(hash string) error {
+	var keys [][]byte
+	err := l.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(path.Join(healthRootKey, hash) + "/")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return l.deleteKeys(keys)
+}
+
+// SetTags replaces the tags of hash, removing them all when tags is empty.
+// Tags are stored as empty values under /tag/<hash>/<tag>.
+func (l *DB) SetTags(hash string, tags []string) error {
+	err := l.db.Update(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		prefix := []byte(path.Join(tagRootKey, hash) + "/")
+		var keys [][]byte
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+		for _, k := range keys {
+			if err := txn.Delete(k); err != nil {
+				return err
+			}
+		}
+		for _, t := range tags {
+			if err := txn.Set([]byte(path.Join(tagRootKey, hash, t)), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return l.db.Sync()
+}
+
+// ListTags returns the tags of every tagged torrent, by hash.
+func (l *DB) ListTags() (map[string][]string, error) {
+	out := make(map[string][]string)
+	err := l.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(tagRootKey)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			// key: /tag/<hash>/<tag>
+			key := string(it.Item().Key())
+			_, tag := path.Split(key)
+			_, hash := path.Split(path.Dir(key))
+			out[hash] = append(out[hash], tag)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// deleteKeys deletes keys in batches to stay below transaction limits
+func (l *DB) deleteKeys(keys [][]byte) error {
+	wb := l.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, k := range keys {
+		if err := wb.Delete(k); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// feedSeenIDs returns the hex SHA-1 of feed and guid, which identify seen
+// items in every store.
+func feedSeenIDs(feed, guid string) (string, string) {
+	f, g := sha1.Sum([]byte(feed)), sha1.Sum([]byte(guid))
+	return hex.EncodeToString(f[:]), hex.EncodeToString(g[:])
+}
+
+func feedSeenKey(feed, guid string) []byte {
+	f, g := feedSeenIDs(feed, guid)
+	return []byte(path.Join(feedRootKey, f, g))
+}
+
+// FeedSeen reports whether the item guid of feed was marked as seen
+func (l *DB) FeedSeen(feed, guid string) (bool, error) {
+	err := l.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(feedSeenKey(feed, guid))
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MarkFeedSeen records the item guid of feed as seen
+func (l *DB) MarkFeedSeen(feed, guid string) error {
+	return l.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(feedSeenKey(feed, guid), []byte(strconv.FormatInt(time.Now().Unix(), 10)))
+	})
+}
+
 func (l *DB) Close() error {
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+	l.wg.Wait()
 	return l.db.Close()
 }
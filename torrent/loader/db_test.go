@@ -60,3 +60,111 @@ func TestDB(t *testing.T) {
 	require.NoError(cs.Close())
 
 }
+
+func TestDBHealthSamples(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s, err := NewDB(t.TempDir())
+	require.NoError(err)
+	defer s.Close()
+
+	const h1, h2 = "c9e15763f722f23e98a29decdfae341b98d53056", "dd8255ecdc7ca55fb0bbf81323d87062db1f6d1c"
+	for _, at := range []int64{100, 200, 300} {
+		require.NoError(s.AddHealthSample(h1, at, []byte{byte(at / 100)}))
+	}
+	require.NoError(s.AddHealthSample(h2, 150, []byte{9}))
+
+	samples, err := s.HealthSamples(h1, 200)
+	require.NoError(err)
+	require.Equal([][]byte{{2}, {3}}, samples)
+
+	n, err := s.PruneHealthSamples(200)
+	require.NoError(err)
+	require.Equal(2, n)
+
+	samples, err = s.HealthSamples(h1, 0)
+	require.NoError(err)
+	require.Equal([][]byte{{2}, {3}}, samples)
+
+	require.NoError(s.DeleteHealthSamples(h1))
+	samples, err = s.HealthSamples(h1, 0)
+	require.NoError(err)
+	require.Empty(samples)
+}
+
+func TestDBFeedSeen(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s, err := NewDB(t.TempDir())
+	require.NoError(err)
+	defer s.Close()
+
+	const feed = "https://indexer.lan/rss"
+	seen, err := s.FeedSeen(feed, "item/1")
+	require.NoError(err)
+	require.False(seen)
+
+	require.NoError(s.MarkFeedSeen(feed, "item/1"))
+	seen, err = s.FeedSeen(feed, "item/1")
+	require.NoError(err)
+	require.True(seen)
+
+	seen, err = s.FeedSeen("https://other.lan/rss", "item/1")
+	require.NoError(err)
+	require.False(seen)
+}
+
+func TestDBStats(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s, err := NewDB(t.TempDir())
+	require.NoError(err)
+	defer s.Close()
+
+	require.NoError(s.AddMagnet("route1", m1))
+	require.NoError(s.AddMagnet("route2", m1))
+	require.NoError(s.SetMeta("c9e15763f722f23e98a29decdfae341b98d53056", []byte(`{}`)))
+
+	st, err := s.Stats()
+	require.NoError(err)
+	require.Equal("badger", st.Backend)
+	require.EqualValues(2, st.Prefixes["route"].Keys)
+	require.EqualValues(1, st.Prefixes["meta"].Keys)
+	require.Zero(st.Prefixes["file"].Keys)
+
+	require.NoError(s.Compact())
+	st, err = s.Stats()
+	require.NoError(err)
+	require.False(st.LastCompact.IsZero())
+}
+
+func TestDBTags(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s, err := NewDB(t.TempDir())
+	require.NoError(err)
+	defer s.Close()
+
+	const h1 = "c9e15763f722f23e98a29decdfae341b98d53056"
+	const h2 = "dd8255ecdc7ca55fb0bbf81323d87062db1f6d1c"
+	require.NoError(s.SetTags(h1, []string{"4k", "kids"}))
+	require.NoError(s.SetTags(h2, []string{"keep"}))
+
+	tags, err := s.ListTags()
+	require.NoError(err)
+	require.Equal(map[string][]string{h1: {"4k", "kids"}, h2: {"keep"}}, tags)
+
+	require.NoError(s.SetTags(h1, []string{"keep"}))
+	require.NoError(s.SetTags(h2, nil))
+	tags, err = s.ListTags()
+	require.NoError(err)
+	require.Equal(map[string][]string{h1: {"keep"}}, tags)
+}
@@ -0,0 +1,295 @@
+package loader
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/jkaberg/distribyted/config"
+)
+
+// maxTorrentFileSize caps .torrent enclosures downloaded from feeds.
+const maxTorrentFileSize = 10 << 20
+
+// FeedSeenStore persists the feed items already handled, by feed URL and
+// item GUID.
+type FeedSeenStore interface {
+	FeedSeen(feed, guid string) (bool, error)
+	MarkFeedSeen(feed, guid string) error
+}
+
+// FeedItem is a torrent announced by a feed.
+type FeedItem struct {
+	GUID       string `json:"guid"`
+	Title      string `json:"title"`
+	Size       int64  `json:"size"`
+	Magnet     string `json:"magnet,omitempty"`
+	TorrentURL string `json:"torrentUrl,omitempty"`
+	InfoHash   string `json:"infoHash,omitempty"`
+	// Matched is set when the item passes the filters of the feed
+	Matched bool `json:"matched"`
+}
+
+var _ Loader = &Feed{}
+
+// Feed reads the RSS, Atom and Torznab feeds of the routes. Feeds are
+// polled, so the Loader methods only list the routes having feeds; new
+// items are returned by Poll.
+type Feed struct {
+	mu    sync.RWMutex
+	c     []*config.Route
+	seen  FeedSeenStore
+	httpc *http.Client
+}
+
+func NewFeed(r []*config.Route, seen FeedSeenStore) *Feed {
+	return &Feed{
+		c:     r,
+		seen:  seen,
+		httpc: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetRoutes replaces the routes used by the loader after a configuration reload.
+func (f *Feed) SetRoutes(r []*config.Route) {
+	f.mu.Lock()
+	f.c = r
+	f.mu.Unlock()
+}
+
+// Feeds returns the feeds of every route, by route name.
+func (f *Feed) Feeds() map[string][]*config.Feed {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	out := make(map[string][]*config.Feed)
+	for _, r := range f.c {
+		if len(r.Feeds) > 0 {
+			out[r.Name] = append(out[r.Name], r.Feeds...)
+		}
+	}
+	return out
+}
+
+func (f *Feed) ListMagnets() (map[string][]string, error) {
+	out := make(map[string][]string)
+	for r := range f.Feeds() {
+		out[r] = nil
+	}
+	return out, nil
+}
+
+func (f *Feed) ListTorrentPaths() (map[string][]string, error) {
+	return nil, nil
+}
+
+// Fetch downloads and parses feed, flagging the items matching its filters.
+func (f *Feed) Fetch(ctx context.Context, feed *config.Feed) ([]*FeedItem, error) {
+	include, err := regexp.Compile(feed.Include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include expression: %w", err)
+	}
+	exclude, err := regexp.Compile(feed.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude expression: %w", err)
+	}
+
+	body, err := f.get(ctx, feed.URL)
+	if err != nil {
+		return nil, err
+	}
+	items, err := ParseFeed(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, it := range items {
+		it.Matched = (it.Magnet != "" || it.TorrentURL != "") &&
+			include.MatchString(it.Title) &&
+			(feed.Exclude == "" || !exclude.MatchString(it.Title)) &&
+			sizeMatches(feed, it.Size)
+	}
+	return items, nil
+}
+
+// sizeMatches reports whether size is within the bounds of feed. Items of
+// unknown size always match.
+func sizeMatches(feed *config.Feed, size int64) bool {
+	if size <= 0 {
+		return true
+	}
+	if feed.MinSizeMB > 0 && size < feed.MinSizeMB<<20 {
+		return false
+	}
+	if feed.MaxSizeMB > 0 && size > feed.MaxSizeMB<<20 {
+		return false
+	}
+	return true
+}
+
+// Poll returns the items of feed matching its filters that were not marked
+// as seen yet.
+func (f *Feed) Poll(ctx context.Context, feed *config.Feed) ([]*FeedItem, error) {
+	items, err := f.Fetch(ctx, feed)
+	if err != nil {
+		return nil, err
+	}
+	var out []*FeedItem
+	for _, it := range items {
+		if !it.Matched {
+			continue
+		}
+		seen, err := f.seen.FeedSeen(feed.URL, it.GUID)
+		if err != nil {
+			return nil, err
+		}
+		if !seen {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+// MarkSeen records that the item guid of feed was handled.
+func (f *Feed) MarkSeen(feed *config.Feed, guid string) error {
+	return f.seen.MarkFeedSeen(feed.URL, guid)
+}
+
+// DownloadTorrent fetches and parses the .torrent file at url.
+func (f *Feed) DownloadTorrent(ctx context.Context, url string) (*metainfo.MetaInfo, error) {
+	return FetchTorrent(ctx, f.httpc, url)
+}
+
+func (f *Feed) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.httpc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+type feedDoc struct {
+	Items   []*feedEntry `xml:"channel>item"`
+	Entries []*feedEntry `xml:"entry"`
+}
+
+// feedEntry is an RSS item or an Atom entry. Torznab and Newznab attributes
+// are matched whatever their namespace.
+type feedEntry struct {
+	Title      string           `xml:"title"`
+	GUID       string           `xml:"guid"`
+	ID         string           `xml:"id"`
+	Size       string           `xml:"size"`
+	Links      []*feedLink      `xml:"link"`
+	Enclosures []*feedEnclosure `xml:"enclosure"`
+	Attrs      []*feedAttr      `xml:"attr"`
+}
+
+type feedLink struct {
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type feedEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type feedAttr struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// ParseFeed parses an RSS, Atom or Torznab document.
+func ParseFeed(b []byte) ([]*FeedItem, error) {
+	var doc feedDoc
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing feed: %w", err)
+	}
+	var out []*FeedItem
+	for _, e := range append(doc.Items, doc.Entries...) {
+		out = append(out, e.item())
+	}
+	return out, nil
+}
+
+func (e *feedEntry) item() *FeedItem {
+	it := &FeedItem{Title: strings.TrimSpace(e.Title)}
+
+	candidate := func(u, typ, length string) {
+		u = strings.TrimSpace(u)
+		switch {
+		case u == "":
+			return
+		case strings.HasPrefix(u, "magnet:"):
+			if it.Magnet == "" {
+				it.Magnet = u
+			}
+		case it.TorrentURL == "" && (strings.Contains(typ, "bittorrent") || strings.HasSuffix(strings.ToLower(u), ".torrent")):
+			it.TorrentURL = u
+		default:
+			return
+		}
+		if n, err := strconv.ParseInt(length, 10, 64); err == nil && it.Size == 0 {
+			it.Size = n
+		}
+	}
+	for _, a := range e.Attrs {
+		switch strings.ToLower(a.Name) {
+		case "size":
+			if n, err := strconv.ParseInt(a.Value, 10, 64); err == nil {
+				it.Size = n
+			}
+		case "infohash":
+			it.InfoHash = strings.ToLower(a.Value)
+		case "magneturl":
+			candidate(a.Value, "", "")
+		}
+	}
+	for _, enc := range e.Enclosures {
+		candidate(enc.URL, enc.Type, enc.Length)
+	}
+	for _, l := range e.Links {
+		if l.Href != "" {
+			candidate(l.Href, l.Type, l.Length)
+		} else {
+			candidate(l.Value, "", "")
+		}
+	}
+	if n, err := strconv.ParseInt(strings.TrimSpace(e.Size), 10, 64); err == nil && it.Size == 0 {
+		it.Size = n
+	}
+
+	if it.InfoHash == "" && it.Magnet != "" {
+		if spec, err := metainfo.ParseMagnetUri(it.Magnet); err == nil {
+			it.InfoHash = spec.InfoHash.HexString()
+		}
+	}
+
+	for _, id := range []string{e.GUID, e.ID, it.InfoHash, it.Magnet, it.TorrentURL, it.Title} {
+		if id = strings.TrimSpace(id); id != "" {
+			it.GUID = id
+			break
+		}
+	}
+	return it
+}
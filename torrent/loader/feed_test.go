@@ -0,0 +1,127 @@
+package loader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jkaberg/distribyted/config"
+	"github.com/stretchr/testify/require"
+)
+
+const torznabFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+<channel>
+  <item>
+    <title>Show S01E01 1080p WEB</title>
+    <guid>item-1</guid>
+    <enclosure url="http://indexer/dl/1" length="1" type="application/x-bittorrent"/>
+    <torznab:attr name="size" value="1073741824"/>
+    <torznab:attr name="infohash" value="C9E15763F722F23E98A29DECDFAE341B98D53056"/>
+  </item>
+  <item>
+    <title>Show S01E01 720p WEB</title>
+    <guid>item-2</guid>
+    <link>magnet:?xt=urn:btih:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa</link>
+    <size>524288000</size>
+  </item>
+  <item>
+    <title>Show S01E02 1080p CAM</title>
+    <guid>item-3</guid>
+    <enclosure url="http://indexer/dl/3.torrent" length="1073741824"/>
+  </item>
+  <item>
+    <title>Show S01E03 1080p WEB</title>
+    <guid>item-4</guid>
+    <enclosure url="magnet:?xt=urn:btih:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" length="10485760"/>
+  </item>
+</channel>
+</rss>`
+
+const atomFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <entry>
+    <title>Album FLAC</title>
+    <id>urn:album:1</id>
+    <link rel="enclosure" type="application/x-bittorrent" href="http://tracker/album.torrent" length="314572800"/>
+  </entry>
+</feed>`
+
+type memSeen map[string]bool
+
+func (m memSeen) FeedSeen(feed, guid string) (bool, error) { return m[feed+"|"+guid], nil }
+func (m memSeen) MarkFeedSeen(feed, guid string) error     { m[feed+"|"+guid] = true; return nil }
+
+func TestParseFeed(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	items, err := ParseFeed([]byte(torznabFeed))
+	require.NoError(err)
+	require.Len(items, 4)
+
+	require.Equal("item-1", items[0].GUID)
+	require.Equal("http://indexer/dl/1", items[0].TorrentURL)
+	require.Equal(int64(1<<30), items[0].Size)
+	require.Equal("c9e15763f722f23e98a29decdfae341b98d53056", items[0].InfoHash)
+
+	require.Equal("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", items[1].InfoHash)
+	require.Equal(int64(500<<20), items[1].Size)
+
+	items, err = ParseFeed([]byte(atomFeed))
+	require.NoError(err)
+	require.Len(items, 1)
+	require.Equal("urn:album:1", items[0].GUID)
+	require.Equal("http://tracker/album.torrent", items[0].TorrentURL)
+	require.Equal(int64(300<<20), items[0].Size)
+}
+
+func TestFeedPoll(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		_, _ = w.Write([]byte(torznabFeed))
+	}))
+	defer srv.Close()
+
+	f := &config.Feed{URL: srv.URL, Include: "1080p", Exclude: "(?i)cam", MinSizeMB: 100, MaxSizeMB: 2048}
+	seen := memSeen{}
+	fl := NewFeed([]*config.Route{{Name: "tv", Feeds: []*config.Feed{f}}}, seen)
+
+	ms, err := fl.ListMagnets()
+	require.NoError(err)
+	require.Contains(ms, "tv")
+
+	items, err := fl.Poll(context.Background(), f)
+	require.NoError(err)
+	require.Len(items, 1)
+	require.Equal("item-1", items[0].GUID)
+
+	require.NoError(fl.MarkSeen(f, items[0].GUID))
+	items, err = fl.Poll(context.Background(), f)
+	require.NoError(err)
+	require.Empty(items)
+
+	_, err = fl.Poll(context.Background(), &config.Feed{URL: srv.URL + "/missing", Include: "("})
+	require.Error(err)
+}
+
+func TestDownloadTorrentTooLarge(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, maxTorrentFileSize+1))
+	}))
+	defer srv.Close()
+
+	// oversized files fail instead of being parsed truncated
+	_, err := NewFeed(nil, memSeen{}).DownloadTorrent(context.Background(), srv.URL)
+	require.ErrorContains(err, "too large")
+}
@@ -2,8 +2,8 @@ package loader
 
 import (
 	"io/fs"
-	"path"
 	"path/filepath"
+	"sync"
 
 	"github.com/jkaberg/distribyted/config"
 )
@@ -11,7 +11,8 @@ import (
 var _ Loader = &Folder{}
 
 type Folder struct {
-	c []*config.Route
+	mu sync.RWMutex
+	c  []*config.Route
 }
 
 func NewFolder(r []*config.Route) *Folder {
@@ -20,11 +21,21 @@ func NewFolder(r []*config.Route) *Folder {
 	}
 }
 
+// SetRoutes replaces the routes used by the loader after a configuration reload.
+func (f *Folder) SetRoutes(r []*config.Route) {
+	f.mu.Lock()
+	f.c = r
+	f.mu.Unlock()
+}
+
 func (f *Folder) ListMagnets() (map[string][]string, error) {
 	return nil, nil
 }
 
 func (f *Folder) ListTorrentPaths() (map[string][]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
 	out := make(map[string][]string)
 	for _, r := range f.c {
 		if r.TorrentFolder == "" {
@@ -39,7 +50,7 @@ func (f *Folder) ListTorrentPaths() (map[string][]string, error) {
 			if d.IsDir() {
 				return nil
 			}
-			if path.Ext(p) == ".torrent" {
+			if IsTorrentFile(p) {
 				out[r.Name] = append(out[r.Name], p)
 			}
 
@@ -0,0 +1,97 @@
+package loader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/jkaberg/distribyted/config"
+)
+
+// Index is an index store kept in the metadata folder.
+type Index interface {
+	LoaderAdder
+	Stats() (*IndexStats, error)
+	// Compact reclaims the space left by deleted and overwritten entries
+	Compact() error
+	Close() error
+}
+
+// IndexStats reports the size of an index database.
+type IndexStats struct {
+	Backend string `json:"backend"`
+	// Size is the size on disk in bytes
+	Size int64 `json:"size"`
+	// LSMSize and ValueLogSize split Size for badger
+	LSMSize      int64 `json:"lsmSize,omitempty"`
+	ValueLogSize int64 `json:"valueLogSize,omitempty"`
+	// Prefixes holds the entries by key prefix: route, meta, file, health,
+	// feed and tag
+	Prefixes    map[string]*PrefixStats `json:"prefixes"`
+	LastGC      time.Time               `json:"lastGc,omitempty"`
+	LastCompact time.Time               `json:"lastCompact,omitempty"`
+}
+
+// PrefixStats counts the entries of a key prefix and their estimated size.
+type PrefixStats struct {
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// File names of the index databases in the metadata folder.
+const (
+	badgerIndexName = "magnetdb"
+	sqliteIndexName = "index.sqlite"
+)
+
+// OpenIndex opens the index database of backend in the metadata folder. The
+// first time the SQLite backend is opened, the badger database of the folder,
+// if any, is migrated into it.
+func OpenIndex(backend, folder string) (Index, error) {
+	bp := filepath.Join(folder, badgerIndexName)
+	switch backend {
+	case "", config.IndexBadger:
+		return NewDB(bp)
+	case config.IndexSQLite:
+	default:
+		return nil, fmt.Errorf("unknown index backend %q", backend)
+	}
+
+	sp := filepath.Join(folder, sqliteIndexName)
+	_, err := os.Stat(sp)
+	fresh := os.IsNotExist(err)
+	s, err := NewSQLite(sp)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(bp); !fresh || err != nil {
+		return s, nil
+	}
+
+	if err := migrateBadger(s, bp); err != nil {
+		// removed so the migration runs again on next start
+		s.Close()
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			_ = os.Remove(sp + suffix)
+		}
+		return nil, fmt.Errorf("error migrating %s to %s: %w", bp, sp, err)
+	}
+	return s, nil
+}
+
+func migrateBadger(s *SQLite, bp string) error {
+	db, err := NewDB(bp)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	n, err := s.MigrateFrom(db)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("from", bp).Int("entries", n).Msg("index migrated from badger to sqlite")
+	return nil
+}
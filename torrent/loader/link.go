@@ -0,0 +1,91 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Extensions of the files loaded from torrent folders.
+const (
+	ExtTorrent = ".torrent"
+	// ExtMagnet files contain a magnet link
+	ExtMagnet = ".magnet"
+	// ExtURL files contain a magnet link or the URL of a .torrent file, alone
+	// or as a Windows Internet shortcut
+	ExtURL = ".url"
+)
+
+// IsTorrentFile reports whether p is a file loaded from torrent folders.
+func IsTorrentFile(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ExtTorrent, ExtMagnet, ExtURL:
+		return true
+	}
+	return false
+}
+
+// IsLinkFile reports whether p holds a link instead of torrent metadata.
+func IsLinkFile(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ExtMagnet, ExtURL:
+		return true
+	}
+	return false
+}
+
+// ReadLink returns the magnet link or URL stored in a .magnet or .url file.
+func ReadLink(p string) (string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		// Internet shortcut: [InternetShortcut] section with URL=...
+		if k, v, ok := strings.Cut(l, "="); ok && strings.EqualFold(k, "url") {
+			l = strings.TrimSpace(v)
+		}
+		if strings.HasPrefix(l, "magnet:") || strings.HasPrefix(l, "http://") || strings.HasPrefix(l, "https://") {
+			return l, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no magnet link or URL found in %s", p)
+}
+
+// FetchTorrent downloads and parses the .torrent file at url.
+func FetchTorrent(ctx context.Context, c *http.Client, url string) (*metainfo.MetaInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxTorrentFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxTorrentFileSize {
+		return nil, errors.New("torrent file too large: " + url)
+	}
+	return metainfo.Load(bytes.NewReader(b))
+}
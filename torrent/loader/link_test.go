@@ -0,0 +1,69 @@
+package loader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLink(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		require.NoError(os.WriteFile(p, []byte(content), 0644))
+		return p
+	}
+
+	require.True(IsTorrentFile("a/b.Magnet"))
+	require.True(IsLinkFile("b.url"))
+	require.False(IsLinkFile("b.torrent"))
+	require.False(IsTorrentFile("b.txt"))
+
+	l, err := ReadLink(write("a.magnet", "\n"+m1+"\n"))
+	require.NoError(err)
+	require.Equal(m1, l)
+
+	l, err = ReadLink(write("b.url", "[InternetShortcut]\r\nURL=https://tracker.lan/b.torrent\r\n"))
+	require.NoError(err)
+	require.Equal("https://tracker.lan/b.torrent", l)
+
+	_, err = ReadLink(write("c.url", "nothing here"))
+	require.Error(err)
+}
+
+func TestFetchTorrent(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	info, err := bencode.Marshal(metainfo.Info{Name: "file", PieceLength: 16384, Pieces: make([]byte, 20), Length: 1})
+	require.NoError(err)
+	mi := &metainfo.MetaInfo{InfoBytes: info}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file.torrent" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = mi.Write(w)
+	}))
+	defer srv.Close()
+
+	got, err := FetchTorrent(context.Background(), srv.Client(), srv.URL+"/file.torrent")
+	require.NoError(err)
+	require.Equal(mi.HashInfoBytes(), got.HashInfoBytes())
+
+	_, err = FetchTorrent(context.Background(), srv.Client(), srv.URL+"/missing.torrent")
+	require.Error(err)
+}
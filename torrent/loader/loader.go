@@ -22,4 +22,17 @@ type LoaderAdder interface {
 	// Efficient hash listing without parsing magnet URI or reading files
 	ListMagnetHashesByRoute() (map[string][]string, error)
 	ListFileHashesByRoute() (map[string][]string, error)
+
+	// Health history, JSON-encoded samples keyed by hash and unix time
+	AddHealthSample(hash string, at int64, sample []byte) error
+	HealthSamples(hash string, since int64) ([][]byte, error)
+	PruneHealthSamples(before int64) (int, error)
+	DeleteHealthSamples(hash string) error
+
+	// Feed items already handled
+	FeedSeenStore
+
+	// Tags of torrents by hash, independent of routes
+	SetTags(hash string, tags []string) error
+	ListTags() (map[string][]string, error)
 }
@@ -0,0 +1,412 @@
+package loader
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/rs/zerolog/log"
+	_ "modernc.org/sqlite"
+
+	"github.com/jkaberg/distribyted/config"
+)
+
+var _ LoaderAdder = &SQLite{}
+
+// sqliteMigrations are applied in order on open. The schema version stored
+// in user_version is the number of migrations applied; append new
+// migrations, never edit released ones.
+var sqliteMigrations = []string{
+	`CREATE TABLE magnets (
+		hash   TEXT NOT NULL,
+		route  TEXT NOT NULL,
+		magnet TEXT NOT NULL,
+		PRIMARY KEY (hash, route)
+	);
+	CREATE INDEX magnets_route ON magnets (route);
+
+	CREATE TABLE files (
+		hash  TEXT NOT NULL,
+		route TEXT NOT NULL,
+		path  TEXT NOT NULL,
+		PRIMARY KEY (hash, route)
+	);
+	CREATE INDEX files_route ON files (route);
+
+	CREATE TABLE meta (
+		hash TEXT PRIMARY KEY,
+		data BLOB NOT NULL
+	);
+
+	CREATE TABLE health_samples (
+		hash   TEXT NOT NULL,
+		at     INTEGER NOT NULL,
+		sample BLOB NOT NULL,
+		PRIMARY KEY (hash, at)
+	);
+	CREATE INDEX health_samples_at ON health_samples (at);
+
+	CREATE TABLE feed_seen (
+		feed    TEXT NOT NULL,
+		guid    TEXT NOT NULL,
+		seen_at INTEGER NOT NULL,
+		PRIMARY KEY (feed, guid)
+	);`,
+	`CREATE TABLE tags (
+		hash TEXT NOT NULL,
+		tag  TEXT NOT NULL,
+		PRIMARY KEY (hash, tag)
+	);
+	CREATE INDEX tags_tag ON tags (tag);`,
+}
+
+// SQLite is an index store kept in a SQLite database file.
+type SQLite struct {
+	db   *sql.DB
+	path string
+
+	mu          sync.Mutex
+	lastCompact time.Time
+	// prefixes caches the table sizes of Stats for statsTTL
+	prefixes   map[string]*PrefixStats
+	prefixesAt time.Time
+}
+
+// sqlitePrefixes maps the tables to the key prefixes of DB, for Stats.
+var sqlitePrefixes = []struct{ table, prefix, size string }{
+	{"magnets", "route", "length(hash) + length(route) + length(magnet)"},
+	{"meta", "meta", "length(hash) + length(data)"},
+	{"files", "file", "length(hash) + length(route) + length(path)"},
+	{"health_samples", "health", "length(hash) + 8 + length(sample)"},
+	{"feed_seen", "feed", "length(feed) + length(guid) + 8"},
+	{"tags", "tag", "length(hash) + length(tag)"},
+}
+
+func NewSQLite(path string) (*SQLite, error) {
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// a single connection serializes writers, avoiding SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	s := &SQLite{db: db, path: path}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// migrate applies the migrations newer than the schema version of the file.
+func (s *SQLite) migrate() error {
+	var v int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&v); err != nil {
+		return err
+	}
+	if v > len(sqliteMigrations) {
+		return fmt.Errorf("schema version %d is newer than supported version %d", v, len(sqliteMigrations))
+	}
+	for i := v; i < len(sqliteMigrations); i++ {
+		err := s.tx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		log.Info().Int("version", i+1).Msg("index database schema migrated")
+	}
+	return nil
+}
+
+func (s *SQLite) tx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// byRoute runs a query returning (route, value) rows and groups the values
+// by route. ListTags uses it with the hash as first column.
+func (s *SQLite) byRoute(query string) (map[string][]string, error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string][]string)
+	for rows.Next() {
+		var r, v string
+		if err := rows.Scan(&r, &v); err != nil {
+			return nil, err
+		}
+		out[r] = append(out[r], v)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLite) AddMagnet(r, m string) error {
+	spec, err := metainfo.ParseMagnetUri(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO magnets (hash, route, magnet) VALUES (?, ?, ?)`,
+		spec.InfoHash.HexString(), r, m)
+	return err
+}
+
+func (s *SQLite) RemoveFromHash(r, h string) (bool, error) {
+	var mh metainfo.Hash
+	if err := mh.FromHexString(h); err != nil {
+		return false, err
+	}
+	// missing entries count as deleted, as in DB, so the UI doesn't get stuck
+	_, err := s.db.Exec(`DELETE FROM magnets WHERE hash = ? AND route = ?`, h, r)
+	return err == nil, err
+}
+
+func (s *SQLite) ListMagnets() (map[string][]string, error) {
+	return s.byRoute(`SELECT route, magnet FROM magnets ORDER BY hash, route`)
+}
+
+func (s *SQLite) ListTorrentPaths() (map[string][]string, error) {
+	return s.byRoute(`SELECT route, path FROM files ORDER BY hash, route`)
+}
+
+func (s *SQLite) SetMeta(hash string, meta []byte) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO meta (hash, data) VALUES (?, ?)`, hash, meta)
+	return err
+}
+
+func (s *SQLite) GetMeta(hash string) ([]byte, error) {
+	var out []byte
+	err := s.db.QueryRow(`SELECT data FROM meta WHERE hash = ?`, hash).Scan(&out)
+	if errors.Is(err, sql.ErrNoRows) {
+		// same error as DB so callers can check for missing entries alike
+		return nil, badger.ErrKeyNotFound
+	}
+	return out, err
+}
+
+func (s *SQLite) GetAllMeta() (map[string][]byte, error) {
+	rows, err := s.db.Query(`SELECT hash, data FROM meta`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string][]byte)
+	for rows.Next() {
+		var h string
+		var b []byte
+		if err := rows.Scan(&h, &b); err != nil {
+			return nil, err
+		}
+		out[h] = b
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLite) DeleteMeta(hash string) error {
+	_, err := s.db.Exec(`DELETE FROM meta WHERE hash = ?`, hash)
+	return err
+}
+
+func (s *SQLite) AddTorrentFile(route, hash, filePath string) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO files (hash, route, path) VALUES (?, ?, ?)`, hash, route, filePath)
+	return err
+}
+
+func (s *SQLite) RemoveTorrentFile(route, hash string) error {
+	_, err := s.db.Exec(`DELETE FROM files WHERE hash = ? AND route = ?`, hash, route)
+	return err
+}
+
+func (s *SQLite) ListMagnetHashesByRoute() (map[string][]string, error) {
+	return s.byRoute(`SELECT route, hash FROM magnets ORDER BY route, hash`)
+}
+
+func (s *SQLite) ListFileHashesByRoute() (map[string][]string, error) {
+	return s.byRoute(`SELECT route, hash FROM files ORDER BY route, hash`)
+}
+
+func (s *SQLite) AddHealthSample(hash string, at int64, sample []byte) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO health_samples (hash, at, sample) VALUES (?, ?, ?)`, hash, at, sample)
+	return err
+}
+
+func (s *SQLite) HealthSamples(hash string, since int64) ([][]byte, error) {
+	rows, err := s.db.Query(`SELECT sample FROM health_samples WHERE hash = ? AND at >= ? ORDER BY at`, hash, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out [][]byte
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLite) PruneHealthSamples(before int64) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM health_samples WHERE at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *SQLite) DeleteHealthSamples(hash string) error {
+	_, err := s.db.Exec(`DELETE FROM health_samples WHERE hash = ?`, hash)
+	return err
+}
+
+func (s *SQLite) FeedSeen(feed, guid string) (bool, error) {
+	f, g := feedSeenIDs(feed, guid)
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM feed_seen WHERE feed = ? AND guid = ?`, f, g).Scan(&n)
+	return n > 0, err
+}
+
+func (s *SQLite) MarkFeedSeen(feed, guid string) error {
+	f, g := feedSeenIDs(feed, guid)
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO feed_seen (feed, guid, seen_at) VALUES (?, ?, ?)`, f, g, time.Now().Unix())
+	return err
+}
+
+func (s *SQLite) SetTags(hash string, tags []string) error {
+	return s.tx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM tags WHERE hash = ?`, hash); err != nil {
+			return err
+		}
+		for _, t := range tags {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO tags (hash, tag) VALUES (?, ?)`, hash, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLite) ListTags() (map[string][]string, error) {
+	return s.byRoute(`SELECT hash, tag FROM tags ORDER BY hash, tag`)
+}
+
+// MigrateFrom copies every entry of the badger database src, in a single
+// transaction.
+func (s *SQLite) MigrateFrom(src *DB) (int, error) {
+	n := 0
+	err := s.tx(func(tx *sql.Tx) error {
+		return src.db.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				key := string(it.Item().Key())
+				v, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if err := migrateEntry(tx, key, v); err != nil {
+					return fmt.Errorf("key %s: %w", key, err)
+				}
+				n++
+			}
+			return nil
+		})
+	})
+	return n, err
+}
+
+// migrateEntry inserts the badger entry key, v. Unknown keys are skipped.
+func migrateEntry(tx *sql.Tx, key string, v []byte) error {
+	parts := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	var err error
+	switch {
+	case len(parts) == 3 && parts[0] == "route":
+		_, err = tx.Exec(`INSERT OR REPLACE INTO magnets (hash, route, magnet) VALUES (?, ?, ?)`, parts[1], parts[2], string(v))
+	case len(parts) == 3 && parts[0] == "file":
+		_, err = tx.Exec(`INSERT OR REPLACE INTO files (hash, route, path) VALUES (?, ?, ?)`, parts[1], parts[2], string(v))
+	case len(parts) == 2 && parts[0] == "meta":
+		_, err = tx.Exec(`INSERT OR REPLACE INTO meta (hash, data) VALUES (?, ?)`, parts[1], v)
+	case len(parts) == 3 && parts[0] == "health":
+		at, perr := strconv.ParseInt(parts[2], 10, 64)
+		if perr != nil {
+			return perr
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO health_samples (hash, at, sample) VALUES (?, ?, ?)`, parts[1], at, v)
+	case len(parts) == 3 && parts[0] == "feed":
+		at, _ := strconv.ParseInt(string(v), 10, 64)
+		_, err = tx.Exec(`INSERT OR REPLACE INTO feed_seen (feed, guid, seen_at) VALUES (?, ?, ?)`, parts[1], parts[2], at)
+	case len(parts) == 3 && parts[0] == "tag":
+		_, err = tx.Exec(`INSERT OR REPLACE INTO tags (hash, tag) VALUES (?, ?)`, parts[1], parts[2])
+	}
+	return err
+}
+
+// Stats returns the size of the database file and of each table. Table
+// sizes scan every table, so they are refreshed at most every minute.
+func (s *SQLite) Stats() (*IndexStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.prefixes == nil || time.Since(s.prefixesAt) > statsTTL {
+		prefixes := make(map[string]*PrefixStats)
+		for _, p := range sqlitePrefixes {
+			ps := &PrefixStats{}
+			q := fmt.Sprintf(`SELECT COUNT(*), COALESCE(SUM(%s), 0) FROM %s`, p.size, p.table)
+			if err := s.db.QueryRow(q).Scan(&ps.Keys, &ps.Bytes); err != nil {
+				return nil, err
+			}
+			prefixes[p.prefix] = ps
+		}
+		s.prefixes, s.prefixesAt = prefixes, time.Now()
+	}
+
+	st := &IndexStats{Backend: config.IndexSQLite, Prefixes: s.prefixes, LastCompact: s.lastCompact}
+	for _, suffix := range []string{"", "-wal"} {
+		if fi, err := os.Stat(s.path + suffix); err == nil {
+			st.Size += fi.Size()
+		}
+	}
+	return st, nil
+}
+
+// Compact checkpoints the write-ahead log and rebuilds the database file.
+func (s *SQLite) Compact() error {
+	if _, err := s.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.lastCompact = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,144 @@
+package loader
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/jkaberg/distribyted/config"
+)
+
+func TestSQLite(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	p := filepath.Join(t.TempDir(), "index.sqlite")
+	s, err := NewSQLite(p)
+	require.NoError(err)
+
+	const h1 = "c9e15763f722f23e98a29decdfae341b98d53056"
+	require.Error(s.AddMagnet("route1", "WRONG MAGNET"))
+	require.NoError(s.AddMagnet("route1", m1))
+	require.NoError(s.AddMagnet("route2", m1))
+	require.NoError(s.AddTorrentFile("route3", h1, "/torrents/a.torrent"))
+
+	l, err := s.ListMagnets()
+	require.NoError(err)
+	require.Equal(map[string][]string{"route1": {m1}, "route2": {m1}}, l)
+	hs, err := s.ListFileHashesByRoute()
+	require.NoError(err)
+	require.Equal(map[string][]string{"route3": {h1}}, hs)
+
+	removed, err := s.RemoveFromHash("route1", h1)
+	require.NoError(err)
+	require.True(removed)
+	hs, err = s.ListMagnetHashesByRoute()
+	require.NoError(err)
+	require.Equal(map[string][]string{"route2": {h1}}, hs)
+
+	_, err = s.GetMeta(h1)
+	require.Error(err)
+	require.NoError(s.SetMeta(h1, []byte(`{}`)))
+	meta, err := s.GetMeta(h1)
+	require.NoError(err)
+	require.Equal([]byte(`{}`), meta)
+
+	for _, at := range []int64{100, 200, 300} {
+		require.NoError(s.AddHealthSample(h1, at, []byte{byte(at / 100)}))
+	}
+	n, err := s.PruneHealthSamples(200)
+	require.NoError(err)
+	require.Equal(1, n)
+	samples, err := s.HealthSamples(h1, 0)
+	require.NoError(err)
+	require.Equal([][]byte{{2}, {3}}, samples)
+
+	require.NoError(s.MarkFeedSeen("https://indexer.lan/rss", "item/1"))
+	seen, err := s.FeedSeen("https://indexer.lan/rss", "item/1")
+	require.NoError(err)
+	require.True(seen)
+
+	require.NoError(s.SetTags(h1, []string{"kids", "4k"}))
+	require.NoError(s.SetTags(h1, []string{"4k", "keep"}))
+	tags, err := s.ListTags()
+	require.NoError(err)
+	require.Equal(map[string][]string{h1: {"4k", "keep"}}, tags)
+
+	st, err := s.Stats()
+	require.NoError(err)
+	require.EqualValues(1, st.Prefixes["route"].Keys)
+	require.EqualValues(2, st.Prefixes["health"].Keys)
+	require.NoError(s.Compact())
+
+	// table sizes are cached, the compaction time is not
+	require.NoError(s.AddMagnet("route3", m1))
+	st, err = s.Stats()
+	require.NoError(err)
+	require.EqualValues(1, st.Prefixes["route"].Keys)
+	require.False(st.LastCompact.IsZero())
+	_, err = s.RemoveFromHash("route3", "c9e15763f722f23e98a29decdfae341b98d53056")
+	require.NoError(err)
+
+	// reopening keeps the data and the schema version
+	require.NoError(s.Close())
+	s, err = NewSQLite(p)
+	require.NoError(err)
+	defer s.Close()
+	l, err = s.ListMagnets()
+	require.NoError(err)
+	require.Len(l, 1)
+}
+
+func TestOpenIndexMigratesBadger(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	dir := t.TempDir()
+	const h1 = "c9e15763f722f23e98a29decdfae341b98d53056"
+
+	b, err := OpenIndex(config.IndexBadger, dir)
+	require.NoError(err)
+	require.NoError(b.AddMagnet("route1", m1))
+	require.NoError(b.AddTorrentFile("route2", h1, "/torrents/a.torrent"))
+	require.NoError(b.SetMeta(h1, []byte(`{"name":"a"}`)))
+	require.NoError(b.AddHealthSample(h1, 100, []byte{1}))
+	require.NoError(b.MarkFeedSeen("https://indexer.lan/rss", "item/1"))
+	require.NoError(b.SetTags(h1, []string{"kids"}))
+	require.NoError(b.Close())
+
+	s, err := OpenIndex(config.IndexSQLite, dir)
+	require.NoError(err)
+	require.IsType(&SQLite{}, s)
+
+	l, err := s.ListMagnets()
+	require.NoError(err)
+	require.Equal(map[string][]string{"route1": {m1}}, l)
+	ps, err := s.ListTorrentPaths()
+	require.NoError(err)
+	require.Equal(map[string][]string{"route2": {"/torrents/a.torrent"}}, ps)
+	meta, err := s.GetMeta(h1)
+	require.NoError(err)
+	require.Equal(`{"name":"a"}`, string(meta))
+	samples, err := s.HealthSamples(h1, 0)
+	require.NoError(err)
+	require.Equal([][]byte{{1}}, samples)
+	seen, err := s.FeedSeen("https://indexer.lan/rss", "item/1")
+	require.NoError(err)
+	require.True(seen)
+	tags, err := s.ListTags()
+	require.NoError(err)
+	require.Equal(map[string][]string{h1: {"kids"}}, tags)
+
+	// the migration runs once
+	require.NoError(s.RemoveTorrentFile("route2", h1))
+	require.NoError(s.Close())
+	s, err = OpenIndex(config.IndexSQLite, dir)
+	require.NoError(err)
+	defer s.Close()
+	ps, err = s.ListTorrentPaths()
+	require.NoError(err)
+	require.Empty(ps)
+}
@@ -0,0 +1,74 @@
+package torrent
+
+import (
+	"path"
+	"sort"
+
+	cfgpkg "github.com/jkaberg/distribyted/config"
+	"github.com/jkaberg/distribyted/fs"
+)
+
+// mediaView is the media view of a route, mounted at its name.
+type mediaView struct {
+	name string
+	fs   *fs.MediaFs
+}
+
+// MediaFile maps a file of a media view to its path in the route.
+type MediaFile struct {
+	Path     string `json:"path"`
+	Original string `json:"original"`
+}
+
+// SetMediaViews mounts the media views of routes in the container
+// filesystem, replacing the ones mounted before.
+func (s *Service) SetMediaViews(routes []*cfgpkg.Route) {
+	for _, r := range routes {
+		if r.MediaView != "" {
+			s.addRoute(r.Name)
+		}
+	}
+
+	s.mu.Lock()
+	cfs := s.cfs
+	old := s.media
+	s.media = make(map[string]*mediaView)
+	for _, r := range routes {
+		if r.MediaView == "" {
+			continue
+		}
+		if tfs, ok := s.fss[path.Join("/", r.Name)].(*fs.Torrent); ok {
+			s.media[r.Name] = &mediaView{name: r.MediaView, fs: fs.NewMediaFs(tfs)}
+		}
+	}
+	cur := s.media
+	s.mu.Unlock()
+	if cfs == nil {
+		return
+	}
+	for _, v := range old {
+		_ = cfs.RemoveFS(path.Join("/", v.name))
+	}
+	for route, v := range cur {
+		if err := cfs.AddFS(v.fs, path.Join("/", v.name)); err != nil {
+			s.log.Warn().Err(err).Str("route", route).Str("view", v.name).Msg("error mounting media view")
+		}
+	}
+}
+
+// MediaFiles returns the name of the media view of route and its files,
+// sorted by path. ok is false when the route has no media view.
+func (s *Service) MediaFiles(route string) (name string, files []*MediaFile, ok bool) {
+	s.mu.Lock()
+	v := s.media[route]
+	s.mu.Unlock()
+	if v == nil {
+		return "", nil, false
+	}
+	files = []*MediaFile{}
+	for p, orig := range v.fs.Mapping() {
+		files = append(files, &MediaFile{Path: p, Original: orig})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return v.name, files, true
+}
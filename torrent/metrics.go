@@ -0,0 +1,96 @@
+package torrent
+
+import (
+	"github.com/anacrolix/torrent"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func metricDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc("distribyted_"+name, help, labels, nil)
+}
+
+var (
+	torrentLabels = []string{"route", "hash", "name"}
+
+	torrentPeersDesc        = metricDesc("torrent_peers", "Peers known to the torrent.", torrentLabels...)
+	torrentSeedersDesc      = metricDesc("torrent_seeders", "Connected seeders.", torrentLabels...)
+	torrentDownDesc         = metricDesc("torrent_downloaded_bytes_total", "Data bytes downloaded.", torrentLabels...)
+	torrentUpDesc           = metricDesc("torrent_uploaded_bytes_total", "Data bytes uploaded.", torrentLabels...)
+	torrentPiecesDesc       = metricDesc("torrent_pieces", "Pieces in the torrent.", torrentLabels...)
+	torrentCompleteDesc     = metricDesc("torrent_pieces_complete", "Pieces downloaded and verified.", torrentLabels...)
+	torrentAvailabilityDesc = metricDesc("torrent_availability", "Distributed copies in the connected swarm.", torrentLabels...)
+
+	routeTorrentsDesc = metricDesc("route_torrents", "Torrents in the route.", "route")
+	routePeersDesc    = metricDesc("route_peers", "Peers known to the torrents of the route.", "route")
+	routeSeedersDesc  = metricDesc("route_seeders", "Connected seeders of the torrents of the route.", "route")
+	// the route sums drop when torrents leave the route, so they are gauges
+	routeDownDesc = metricDesc("route_downloaded_bytes", "Data bytes downloaded by the torrents currently in the route.", "route")
+	routeUpDesc   = metricDesc("route_uploaded_bytes", "Data bytes uploaded by the torrents currently in the route.", "route")
+)
+
+// statsCollector exports per route and per torrent metrics on scrape.
+type statsCollector struct {
+	s *Stats
+}
+
+// NewStatsCollector returns a Prometheus collector for the torrents in s.
+func NewStatsCollector(s *Stats) prometheus.Collector {
+	return &statsCollector{s: s}
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		torrentPeersDesc, torrentSeedersDesc, torrentDownDesc, torrentUpDesc,
+		torrentPiecesDesc, torrentCompleteDesc, torrentAvailabilityDesc,
+		routeTorrentsDesc, routePeersDesc, routeSeedersDesc, routeDownDesc, routeUpDesc,
+	} {
+		ch <- d
+	}
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.s.mut.Lock()
+	byRoute := make(map[string][]*torrent.Torrent, len(c.s.torrentsByRoute))
+	for r, tl := range c.s.torrentsByRoute {
+		for _, t := range tl {
+			byRoute[r] = append(byRoute[r], t)
+		}
+	}
+	c.s.mut.Unlock()
+
+	gauge := func(d *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, labels...)
+	}
+	counter := func(d *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, labels...)
+	}
+
+	for route, tl := range byRoute {
+		var peers, seeders int
+		var down, up int64
+		for _, t := range tl {
+			st := t.Stats()
+			rd, wd := st.BytesReadData.Int64(), st.BytesWrittenData.Int64()
+			peers += st.TotalPeers
+			seeders += st.ConnectedSeeders
+			down += rd
+			up += wd
+
+			labels := []string{route, t.InfoHash().HexString(), t.Name()}
+			gauge(torrentPeersDesc, float64(st.TotalPeers), labels...)
+			gauge(torrentSeedersDesc, float64(st.ConnectedSeeders), labels...)
+			counter(torrentDownDesc, float64(rd), labels...)
+			counter(torrentUpDesc, float64(wd), labels...)
+			if t.Info() != nil {
+				gauge(torrentPiecesDesc, float64(t.NumPieces()), labels...)
+				gauge(torrentCompleteDesc, float64(st.PiecesComplete), labels...)
+				gauge(torrentAvailabilityDesc, distributedCopies(t), labels...)
+			}
+		}
+		gauge(routeTorrentsDesc, float64(len(tl)), route)
+		gauge(routePeersDesc, float64(peers), route)
+		gauge(routeSeedersDesc, float64(seeders), route)
+		gauge(routeDownDesc, float64(down), route)
+		gauge(routeUpDesc, float64(up), route)
+	}
+}
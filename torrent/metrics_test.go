@@ -0,0 +1,39 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsCollector(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s := newTestService(t, "tv")
+	addTestTorrent(t, s, "tv", hookEpisode, false)
+	addTestTorrent(t, s, "tv", hookPack, false)
+
+	r := prometheus.NewRegistry()
+	require.NoError(r.Register(NewStatsCollector(s.s)))
+	mfs, err := r.Gather()
+	require.NoError(err)
+
+	counts := make(map[string]int, len(mfs))
+	types := make(map[string]dto.MetricType, len(mfs))
+	for _, mf := range mfs {
+		counts[mf.GetName()] = len(mf.GetMetric())
+		types[mf.GetName()] = mf.GetType()
+	}
+	require.Equal(2, counts["distribyted_torrent_peers"])
+	require.Equal(2, counts["distribyted_torrent_downloaded_bytes_total"])
+	require.Equal(1, counts["distribyted_route_torrents"])
+	// route sums go down when torrents are removed
+	require.Equal(dto.MetricType_GAUGE, types["distribyted_route_downloaded_bytes"])
+	require.Equal(dto.MetricType_GAUGE, types["distribyted_route_uploaded_bytes"])
+	// pieces are only known once the torrent has its info
+	require.Zero(counts["distribyted_torrent_pieces"])
+}
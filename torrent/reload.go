@@ -0,0 +1,316 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	cfgpkg "github.com/jkaberg/distribyted/config"
+	"github.com/jkaberg/distribyted/fs"
+)
+
+// routesUpdater is implemented by loaders backed by the configuration file.
+type routesUpdater interface {
+	SetRoutes(r []*cfgpkg.Route)
+}
+
+// ReloadConfig re-reads the configuration file and applies the changes.
+func (s *Service) ReloadConfig() (*cfgpkg.ReloadResult, error) {
+	s.mu.Lock()
+	ch := s.ch
+	s.mu.Unlock()
+	if ch == nil {
+		return &cfgpkg.ReloadResult{Changes: []*cfgpkg.Change{}, Events: []string{}}, nil
+	}
+	return ch.Reload()
+}
+
+// ApplyConfig applies the torrent related changes between two configurations
+// without restarting. It is meant to be registered with Handler.OnReload.
+func (s *Service) ApplyConfig(old, cur *cfgpkg.Root, changes []*cfgpkg.Change, ev cfgpkg.EventFunc) error {
+	var errs []error
+
+	if cfgpkg.Changed(changes, "routes") {
+		if err := s.applyRoutes(old.Routes, cur.Routes, ev); err != nil {
+			errs = append(errs, err)
+		}
+		if feedsChanged(old.Routes, cur.Routes) {
+			s.StartFeeds()
+			ev("feed polling restarted")
+		}
+	}
+
+	t := cur.Torrent
+	if cfgpkg.Changed(changes, "torrent.add_timeout") ||
+		cfgpkg.Changed(changes, "torrent.read_timeout") ||
+		cfgpkg.Changed(changes, "torrent.continue_when_add_timeout") {
+		s.SetTimeouts(t.AddTimeout, t.ReadTimeout, t.ContinueWhenAddTimeout)
+		ev(fmt.Sprintf("timeouts updated: add %ds, read %ds", t.AddTimeout, t.ReadTimeout))
+	}
+
+	if cfgpkg.Changed(changes, "torrent.reader_pool_size") || cfgpkg.Changed(changes, "torrent.readahead_mb") {
+		pool, ra := s.SetTorrentTuning(t.ReaderPoolSize, t.ReadaheadMB)
+		ev(fmt.Sprintf("reader tuning updated: pool size %d, readahead %d MB", pool, ra))
+	}
+
+	if cfgpkg.Changed(changes, "torrent.download_limit_mbit") || cfgpkg.Changed(changes, "torrent.upload_limit_mbit") {
+		if err := s.SetLimits(t.DownloadLimitMbit, t.UploadLimitMbit); err != nil {
+			errs = append(errs, fmt.Errorf("error applying rate limits: %w", err))
+		} else {
+			ev(fmt.Sprintf("rate limits updated: down %.1f Mbit/s, up %.1f Mbit/s", t.DownloadLimitMbit, t.UploadLimitMbit))
+		}
+	}
+
+	if cfgpkg.Changed(changes, "torrent.extra_trackers") || cfgpkg.Changed(changes, "torrent.extra_trackers_url") {
+		n := s.addTrackersToAll(extraTrackers(t))
+		ev(fmt.Sprintf("extra trackers applied to %d torrents", n))
+	}
+
+	if cfgpkg.Changed(changes, "smart_folders") {
+		s.SetSmartFolders(cur.SmartFolders)
+		ev(fmt.Sprintf("%d smart folders mounted", len(cur.SmartFolders)))
+	}
+
+	if cfgpkg.Changed(changes, "health") {
+		s.StopHealthMonitor()
+		s.StartHealthMonitor(cur.Health)
+		if cur.Health != nil && cur.Health.Enabled {
+			ev("health monitor restarted")
+		} else {
+			ev("health monitor stopped")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SetTimeouts updates add and read timeouts for new and existing torrents.
+func (s *Service) SetTimeouts(addTimeout, readTimeout int, continueWhenAddTimeout bool) {
+	s.mu.Lock()
+	s.addTimeout = addTimeout
+	s.readTimeout = readTimeout
+	s.continueWhenAddTimeout = continueWhenAddTimeout
+	for _, f := range s.fss {
+		if tf, ok := f.(*fs.Torrent); ok {
+			tf.SetReadTimeout(readTimeout)
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *Service) addTimeouts() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addTimeout, s.continueWhenAddTimeout
+}
+
+// addTrackersToAll announces the given trackers on every loaded torrent and
+// returns how many torrents were updated.
+func (s *Service) addTrackersToAll(trackers []string) int {
+	if len(trackers) == 0 {
+		return 0
+	}
+	ts := s.c.Torrents()
+	for _, t := range ts {
+		t.AddTrackers([][]string{trackers})
+	}
+	return len(ts)
+}
+
+func (s *Service) applyRoutes(old, cur []*cfgpkg.Route, ev cfgpkg.EventFunc) error {
+	for _, l := range s.loaders {
+		if u, ok := l.(routesUpdater); ok {
+			u.SetRoutes(cur)
+		}
+	}
+	s.SetNestedFolders(cur)
+
+	oldByName := make(map[string]*cfgpkg.Route)
+	for _, r := range old {
+		oldByName[r.Name] = r
+	}
+	curByName := make(map[string]*cfgpkg.Route)
+	for _, r := range cur {
+		curByName[r.Name] = r
+	}
+
+	var errs []error
+	for _, r := range cur {
+		o := oldByName[r.Name]
+		if o == nil {
+			o = &cfgpkg.Route{Name: r.Name}
+			s.addRoute(r.Name)
+			ev(fmt.Sprintf("route %s added", r.Name))
+		}
+		if err := s.applyRouteTorrents(o, r, ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, o := range old {
+		if _, ok := curByName[o.Name]; ok {
+			continue
+		}
+		// keep the route mounted, it may still hold UI-managed torrents
+		if err := s.applyRouteTorrents(o, &cfgpkg.Route{Name: o.Name}, ev); err != nil {
+			errs = append(errs, err)
+		}
+		ev(fmt.Sprintf("route %s removed from configuration", o.Name))
+	}
+	s.SetMediaViews(cur)
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) applyRouteTorrents(old, cur *cfgpkg.Route, ev cfgpkg.EventFunc) error {
+	route := cur.Name
+	oldMagnets, oldPaths := splitTorrents(old.Torrents)
+	curMagnets, curPaths := splitTorrents(cur.Torrents)
+
+	var errs []error
+	for m := range curMagnets {
+		if _, ok := oldMagnets[m]; ok {
+			continue
+		}
+		if err := s.addMagnet(route, m); err != nil {
+			errs = append(errs, fmt.Errorf("error adding magnet to route %s: %w", route, err))
+			continue
+		}
+		if spec, err := metainfo.ParseMagnetUri(m); err == nil {
+			s.mu.Lock()
+			if s.routeMagnet[route] == nil {
+				s.routeMagnet[route] = make(map[string]string)
+			}
+			s.routeMagnet[route][spec.InfoHash.HexString()] = m
+			s.mu.Unlock()
+		}
+		ev(fmt.Sprintf("magnet added to route %s", route))
+	}
+	for m := range oldMagnets {
+		if _, ok := curMagnets[m]; ok {
+			continue
+		}
+		spec, err := metainfo.ParseMagnetUri(m)
+		if err != nil {
+			continue
+		}
+		h := spec.InfoHash.HexString()
+		if err := s.RemoveFromHashLocal(route, h); err != nil {
+			errs = append(errs, fmt.Errorf("error removing magnet %s from route %s: %w", h, route, err))
+			continue
+		}
+		s.mu.Lock()
+		delete(s.routeMagnet[route], h)
+		s.mu.Unlock()
+		ev(fmt.Sprintf("magnet %s removed from route %s", h, route))
+	}
+
+	for p := range curPaths {
+		if _, ok := oldPaths[p]; ok {
+			continue
+		}
+		h, err := s.AddTorrentPath(route, p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error adding torrent %s to route %s: %w", p, route, err))
+			continue
+		}
+		s.mu.Lock()
+		if s.routeFile[route] == nil {
+			s.routeFile[route] = make(map[string]string)
+		}
+		s.routeFile[route][h] = p
+		s.mu.Unlock()
+		ev(fmt.Sprintf("torrent %s added to route %s", p, route))
+	}
+	for p := range oldPaths {
+		if _, ok := curPaths[p]; ok {
+			continue
+		}
+		if s.MaybeRemoveByPath(route, p) {
+			ev(fmt.Sprintf("torrent %s removed from route %s", p, route))
+		}
+	}
+
+	if old.TorrentFolder != cur.TorrentFolder {
+		if old.TorrentFolder != "" {
+			s.closeFolderWatcher(route)
+			s.unloadFolder(route, old.TorrentFolder)
+			ev(fmt.Sprintf("stopped watching %s for route %s", old.TorrentFolder, route))
+		}
+		if cur.TorrentFolder != "" {
+			if err := s.startFolderWatcher(route, cur.TorrentFolder); err != nil {
+				errs = append(errs, fmt.Errorf("error watching %s for route %s: %w", cur.TorrentFolder, route, err))
+			} else {
+				ev(fmt.Sprintf("watching %s for route %s", cur.TorrentFolder, route))
+			}
+		}
+	} else if old.NestedFolders != cur.NestedFolders && cur.TorrentFolder != "" {
+		s.remountFolder(route, cur.TorrentFolder)
+		ev(fmt.Sprintf("torrents of %s remounted in route %s", cur.TorrentFolder, route))
+	}
+
+	return errors.Join(errs...)
+}
+
+// unloadFolder removes the torrents that were loaded from files in folder.
+func (s *Service) unloadFolder(route, folder string) {
+	s.mu.Lock()
+	var paths []string
+	for p := range s.pathToHash {
+		if inFolder(p, folder) {
+			paths = append(paths, p)
+		}
+	}
+	s.mu.Unlock()
+	for _, p := range paths {
+		s.MaybeRemoveByPath(route, p)
+	}
+}
+
+// inFolder reports whether the file p is inside folder or its subfolders.
+func inFolder(p, folder string) bool {
+	folder = filepath.Clean(folder)
+	if !strings.HasSuffix(folder, string(filepath.Separator)) {
+		folder += string(filepath.Separator)
+	}
+	return strings.HasPrefix(filepath.Clean(p), folder)
+}
+
+// remountFolder moves the torrents loaded from files in folder to the
+// directory of the route matching their file.
+func (s *Service) remountFolder(route, folder string) {
+	s.mu.Lock()
+	tfs, _ := s.fss[path.Join("/", route)].(*fs.Torrent)
+	paths := make(map[string]string)
+	for p, h := range s.pathToHash {
+		if inFolder(p, folder) {
+			paths[p] = h
+		}
+	}
+	s.mu.Unlock()
+	if tfs == nil {
+		return
+	}
+	for p, h := range paths {
+		if t, ok := s.c.Torrent(metainfo.NewHashFromHex(h)); ok {
+			tfs.AddTorrentAt(t, s.routeDir(route, p))
+		}
+	}
+}
+
+func splitTorrents(ts []*cfgpkg.Torrent) (magnets, paths map[string]struct{}) {
+	magnets = make(map[string]struct{})
+	paths = make(map[string]struct{})
+	for _, t := range ts {
+		if t.MagnetURI != "" {
+			magnets[t.MagnetURI] = struct{}{}
+		}
+		if t.TorrentPath != "" {
+			paths[t.TorrentPath] = struct{}{}
+		}
+	}
+	return magnets, paths
+}
@@ -0,0 +1,89 @@
+package torrent
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	cfgpkg "github.com/jkaberg/distribyted/config"
+)
+
+func TestInFolder(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	root := filepath.Join(string(filepath.Separator), "data", "torrents")
+	require.True(inFolder(filepath.Join(root, "a.torrent"), root))
+	require.True(inFolder(filepath.Join(root, "4k", "a.torrent"), root+string(filepath.Separator)))
+	require.False(inFolder(filepath.Join(root+"-old", "a.torrent"), root))
+	require.False(inFolder(root, root))
+	require.True(inFolder(filepath.Join(root, "a.torrent"), string(filepath.Separator)))
+}
+
+func TestRouteDir(t *testing.T) {
+	t.Parallel()
+
+	sep := string(filepath.Separator)
+	folder := filepath.Join(sep, "data", "torrents")
+	s := NewService(nil, nil, NewStats(), nil, 1, 1, false, "")
+	s.SetNestedFolders([]*cfgpkg.Route{
+		{Name: "movies", TorrentFolder: folder + sep, NestedFolders: true},
+		{Name: "tv", TorrentFolder: folder},
+	})
+
+	tests := []struct {
+		route, path, want string
+	}{
+		{"movies", filepath.Join(folder, "a.torrent"), ""},
+		{"movies", filepath.Join(folder, "4k", "a.torrent"), "4k"},
+		{"movies", filepath.Join(folder, "movies", "4k", "hdr", "a.torrent"), "movies/4k/hdr"},
+		{"movies", folder + sep + "4k" + sep + ".." + sep + "a.torrent", ""},
+		{"movies", folder + sep + ".." + sep + "other" + sep + "a.torrent", ""},
+		{"movies", filepath.Join(folder+"-old", "4k", "a.torrent"), ""},
+		{"movies", filepath.Join(sep, "elsewhere", "a.torrent"), ""},
+		{"tv", filepath.Join(folder, "show", "a.torrent"), ""},
+		{"music", filepath.Join(folder, "album", "a.torrent"), ""},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, s.routeDir(tt.route, tt.path), tt.path)
+	}
+}
+
+func TestNestedFoldersReload(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s := newTestService(t)
+	folder := t.TempDir()
+	p := filepath.Join(folder, "4k", "a.torrent")
+	writeTestTorrent(t, p, "movie.mkv")
+
+	nested := []*cfgpkg.Route{{Name: "movies", TorrentFolder: folder, NestedFolders: true}}
+	flat := []*cfgpkg.Route{{Name: "movies", TorrentFolder: folder}}
+	s.SetNestedFolders(nested)
+	_, err := s.AddTorrentPath("movies", p)
+	require.NoError(err)
+
+	tfs := s.fss["/movies"]
+	files, err := tfs.ReadDir("/4k")
+	require.NoError(err)
+	require.Contains(files, "movie.mkv")
+
+	ev := func(string) {}
+	require.NoError(s.applyRoutes(nested, flat, ev))
+	files, err = tfs.ReadDir("/")
+	require.NoError(err)
+	require.Contains(files, "movie.mkv")
+	require.NotContains(files, "4k")
+
+	require.NoError(s.applyRoutes(flat, nested, ev))
+	files, err = tfs.ReadDir("/")
+	require.NoError(err)
+	require.NotContains(files, "movie.mkv")
+	files, err = tfs.ReadDir("/4k")
+	require.NoError(err)
+	require.Contains(files, "movie.mkv")
+}
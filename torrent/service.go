@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -51,16 +52,26 @@ type Service struct {
 	// corresponding torrent info hash for dynamic folder watching.
 	pathToHash map[string]string
 
+	// nested holds the torrent folder of the routes mirroring its subfolders,
+	// by route
+	nested map[string]string
+
 	// routesRoot is the base directory where UI-managed routes are stored as
 	// <routesRoot>/<route> containing .torrent files.
 	routesRoot string
 
 	// watchers holds active fsnotify watchers per route for UI-managed routes.
 	watchers map[string]*watchers.RouteWatcher
+	// folderWatchers holds watchers for torrent_folder of configured routes.
+	folderWatchers map[string]*watchers.RouteWatcher
 
 	// cfs is the container filesystem used by HTTPFS/WebDAV. We add mounts
 	// here so new routes appear immediately without restart.
 	cfs *fs.ContainerFs
+	// smart holds the names of the mounted smart folders
+	smart []string
+	// media holds the mounted media views, by route
+	media map[string]*mediaView
 
 	// rate limiters
 	dl *rate.Limiter
@@ -70,6 +81,17 @@ type Service struct {
 
 	// health monitor
 	hm *HealthMonitor
+	// health keeps failure counters and events across monitor restarts
+	health *healthState
+	// arr tracks request outcomes per Arr instance
+	arr *arrStatuses
+	// arrHTTP holds the HTTP client of every Arr instance
+	arrHTTP *arrHTTPClients
+	// feeds polls the route feeds
+	feeds *feedPoller
+
+	// tagsMu serializes the read-modify-write of torrent tags
+	tagsMu sync.Mutex
 
 	// network status cache
 	netMu        sync.Mutex
@@ -79,6 +101,12 @@ type Service struct {
 
 	// cached torrent state loaded from DB to avoid early network usage
 	cached map[string]*cachedState
+	// metaSeq versions the updates of cached, under mu. metaMu serializes
+	// the metadata writes to the DB, and metaStored holds the version last
+	// written by hash so an older summary never overwrites a newer one.
+	metaSeq    uint64
+	metaMu     sync.Mutex
+	metaStored map[string]uint64
 
 	// stop channel for background DB metadata persistence
 	metaPersistStop chan struct{}
@@ -104,15 +132,21 @@ func NewService(loaders []loader.Loader, db IndexStore, stats *Stats, c *torrent
 		readTimeout:            readTimeout,
 		continueWhenAddTimeout: continueWhenAddTimeout,
 		pathToHash:             make(map[string]string),
+		nested:                 make(map[string]string),
 		routesRoot:             routesRoot,
 		watchers:               make(map[string]*watchers.RouteWatcher),
+		folderWatchers:         make(map[string]*watchers.RouteWatcher),
 		readerPoolSize:         4,
 		readaheadMB:            2,
 		cached:                 make(map[string]*cachedState),
+		metaStored:             make(map[string]uint64),
 		metaPersistStop:        make(chan struct{}),
 		routeLoaded:            make(map[string]bool),
 		routeMagnet:            make(map[string]map[string]string),
 		routeFile:              make(map[string]map[string]string),
+		health:                 newHealthState(),
+		arr:                    newArrStatuses(),
+		arrHTTP:                newArrHTTPClients(),
 	}
 }
 
@@ -419,19 +453,20 @@ func (s *Service) AddMagnet(r, m string) error {
 
 // addTorrentPath is unused; use AddTorrentPath which returns hash and indexes mapping
 
-// AddTorrentPath adds a torrent from a .torrent file into the given route and
-// returns the new torrent hash. This does not persist anything into the DB.
+// AddTorrentPath adds a torrent from a .torrent, .magnet or .url file into
+// the given route and returns the new torrent hash. Only the file
+// association is persisted into the DB.
 func (s *Service) AddTorrentPath(r, p string) (string, error) {
 	// Ensure route exists
 	s.addRoute(r)
 
 	// Add to client
-	t, err := s.c.AddTorrentFromFile(p)
+	t, err := s.addTorrentFile(p)
 	if err != nil {
 		return "", err
 	}
 
-	if err := s.addTorrent(r, t); err != nil {
+	if err := s.addTorrentAt(r, s.routeDir(r, p), t); err != nil {
 		return "", err
 	}
 
@@ -447,6 +482,65 @@ func (s *Service) AddTorrentPath(r, p string) (string, error) {
 	return h, nil
 }
 
+// SetNestedFolders records the routes mirroring the subfolders of their
+// torrent folder as directories.
+func (s *Service) SetNestedFolders(routes []*cfgpkg.Route) {
+	m := make(map[string]string)
+	for _, r := range routes {
+		if r.NestedFolders && r.TorrentFolder != "" {
+			m[r.Name] = filepath.Clean(r.TorrentFolder)
+		}
+	}
+	s.mu.Lock()
+	s.nested = m
+	s.mu.Unlock()
+}
+
+// routeDir returns the directory of the route where the torrent of the file
+// p is mounted: the folder of p relative to the torrent folder for routes
+// with nested folders, the root otherwise.
+func (s *Service) routeDir(route, p string) string {
+	s.mu.Lock()
+	folder, ok := s.nested[route]
+	s.mu.Unlock()
+	if !ok {
+		return ""
+	}
+	rel, err := filepath.Rel(folder, filepath.Dir(p))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// linkFetchTimeout bounds the download of .torrent files linked by .url files.
+const linkFetchTimeout = 30 * time.Second
+
+// addTorrentFile adds the torrent of a file to the client. Link files are
+// resolved, fetching remote .torrent files.
+func (s *Service) addTorrentFile(p string) (*torrent.Torrent, error) {
+	if !loader.IsLinkFile(p) {
+		return s.c.AddTorrentFromFile(p)
+	}
+	link, err := loader.ReadLink(p)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(link, "magnet:") {
+		if aug, ok := s.augmentMagnetWithTrackers(link); ok {
+			link = aug
+		}
+		return s.c.AddMagnet(link)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), linkFetchTimeout)
+	defer cancel()
+	mi, err := loader.FetchTorrent(ctx, http.DefaultClient, link)
+	if err != nil {
+		return nil, err
+	}
+	return s.c.AddTorrent(mi)
+}
+
 func (s *Service) addMagnet(r, m string) error {
 	// Optionally augment magnet with extra trackers from config
 	if aug, ok := s.augmentMagnetWithTrackers(m); ok {
@@ -475,24 +569,7 @@ func (s *Service) augmentMagnetWithTrackers(m string) (string, bool) {
 	if err != nil || conf == nil || conf.Torrent == nil {
 		return m, false
 	}
-	extra := make([]string, 0)
-	// load from URL if present (best-effort, short timeout)
-	if conf.Torrent.ExtraTrackersURL != "" {
-		httpc := &http.Client{Timeout: 3 * time.Second}
-		if resp, err := httpc.Get(conf.Torrent.ExtraTrackersURL); err == nil {
-			if body, e := io.ReadAll(resp.Body); e == nil {
-				for _, line := range strings.Split(string(body), "\n") {
-					line = strings.TrimSpace(line)
-					if line != "" && !strings.HasPrefix(line, "#") {
-						extra = append(extra, line)
-					}
-				}
-			}
-			_ = resp.Body.Close()
-		}
-	}
-	// merge static
-	extra = append(extra, conf.Torrent.ExtraTrackers...)
+	extra := extraTrackers(conf.Torrent)
 	if len(extra) == 0 {
 		return m, false
 	}
@@ -522,6 +599,29 @@ func (s *Service) augmentMagnetWithTrackers(m string) (string, bool) {
 	return u.String(), true
 }
 
+// extraTrackers returns the trackers fetched from ExtraTrackersURL (if any)
+// followed by the statically configured ones.
+func extraTrackers(conf *cfgpkg.TorrentGlobal) []string {
+	extra := make([]string, 0)
+	// load from URL if present (best-effort, short timeout)
+	if conf.ExtraTrackersURL != "" {
+		httpc := &http.Client{Timeout: 3 * time.Second}
+		if resp, err := httpc.Get(conf.ExtraTrackersURL); err == nil {
+			if body, e := io.ReadAll(resp.Body); e == nil {
+				for _, line := range strings.Split(string(body), "\n") {
+					line = strings.TrimSpace(line)
+					if line != "" && !strings.HasPrefix(line, "#") {
+						extra = append(extra, line)
+					}
+				}
+			}
+			_ = resp.Body.Close()
+		}
+	}
+	// merge static
+	return append(extra, conf.ExtraTrackers...)
+}
+
 func (s *Service) addRoute(r string) {
 	s.s.AddRoute(r)
 
@@ -542,22 +642,29 @@ func (s *Service) addRoute(r string) {
 }
 
 func (s *Service) addTorrent(r string, t *torrent.Torrent) error {
+	return s.addTorrentAt(r, "", t)
+}
+
+// addTorrentAt adds t to the route r, with its files under the directory dir
+// of the route.
+func (s *Service) addTorrentAt(r, dir string, t *torrent.Torrent) error {
+	addTimeout, continueWhenAddTimeout := s.addTimeouts()
 	// Only block on metadata when configured to do so. Otherwise, don't delay callers.
 	if t.Info() == nil {
-		if s.continueWhenAddTimeout {
+		if continueWhenAddTimeout {
 			// Non-blocking: log when info arrives or times out
 			go func(th string) {
 				select {
 				case <-t.GotInfo():
 					s.log.Info().Str("hash", th).Msg("obtained torrent info")
-				case <-time.After(time.Duration(s.addTimeout) * time.Second):
+				case <-time.After(time.Duration(addTimeout) * time.Second):
 					s.log.Warn().Str("hash", th).Msg("timeout getting torrent info (non-blocking mode)")
 				}
 			}(t.InfoHash().String())
 		} else {
 			s.log.Info().Str("hash", t.InfoHash().String()).Msg("getting torrent info")
 			select {
-			case <-time.After(time.Duration(s.addTimeout) * time.Second):
+			case <-time.After(time.Duration(addTimeout) * time.Second):
 				s.log.Warn().Str("hash", t.InfoHash().String()).Msg("timeout getting torrent info")
 				return errors.New("timeout getting torrent info")
 			case <-t.GotInfo():
@@ -579,7 +686,7 @@ func (s *Service) addTorrent(r string, t *torrent.Torrent) error {
 		return errors.New("error adding torrent to filesystem")
 	}
 
-	tfs.AddTorrent(t)
+	tfs.AddTorrentAt(t, dir)
 	// Guard: Info may be nil in non-blocking mode; fall back to t.Name()
 	tn := t.Name()
 	if ti := t.Info(); ti != nil && ti.Name != "" {
@@ -619,10 +726,7 @@ func (s *Service) RemoveFromHash(r, h string) error {
 
 	// Cleanup DB associations and cached metadata
 	_ = s.db.RemoveTorrentFile(r, h)
-	_ = s.db.DeleteMeta(h)
-	s.mu.Lock()
-	delete(s.cached, h)
-	s.mu.Unlock()
+	s.forgetTorrent(h)
 
 	// Remove from client
 	var mh metainfo.Hash
@@ -656,10 +760,7 @@ func (s *Service) RemoveFromHashLocal(r, h string) error {
 
 	// Cleanup DB association and cached metadata for file-based torrents
 	_ = s.db.RemoveTorrentFile(r, h)
-	_ = s.db.DeleteMeta(h)
-	s.mu.Lock()
-	delete(s.cached, h)
-	s.mu.Unlock()
+	s.forgetTorrent(h)
 
 	// Remove from client
 	var mh metainfo.Hash
@@ -725,7 +826,7 @@ func (s *Service) SyncRouteFolder(route, folder string) error {
 		if d.IsDir() {
 			return nil
 		}
-		if filepath.Ext(p) == ".torrent" {
+		if loader.IsTorrentFile(p) {
 			disk[p] = struct{}{}
 		}
 		return nil
@@ -772,6 +873,78 @@ func (s *Service) SyncRouteFolder(route, folder string) error {
 	return nil
 }
 
+// SyncRouteFile reconciles a single path of a route folder with the runtime
+// state: a new torrent file is loaded, a rewritten one reloaded when its
+// torrent changed, and the torrents of a missing file, or of the files under
+// a missing directory, are unloaded.
+func (s *Service) SyncRouteFile(route, p string) error {
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		s.mu.Lock()
+		var gone []string
+		for tp := range s.pathToHash {
+			if tp == p || strings.HasPrefix(tp, p+string(filepath.Separator)) {
+				gone = append(gone, tp)
+			}
+		}
+		s.mu.Unlock()
+		for _, tp := range gone {
+			if !s.MaybeRemoveByPath(route, tp) {
+				return fmt.Errorf("error removing torrent of %s", tp)
+			}
+			s.log.Info().Str("path", tp).Str("route", route).Msg("torrent file removed")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() || !loader.IsTorrentFile(p) {
+		return nil
+	}
+
+	s.mu.Lock()
+	old, tracked := s.pathToHash[p]
+	s.mu.Unlock()
+	if tracked {
+		// Remote .torrent links are not fetched again: only local changes reload
+		if h := localInfoHash(p); h == "" || h == old {
+			return nil
+		}
+		if !s.MaybeRemoveByPath(route, p) {
+			return fmt.Errorf("error unloading changed torrent file %s", p)
+		}
+	}
+
+	h, err := s.AddTorrentPath(route, p)
+	if err != nil {
+		return err
+	}
+	s.log.Info().Str("path", p).Str("hash", h).Str("route", route).Msg("torrent file added")
+	return nil
+}
+
+// localInfoHash returns the infohash of a .torrent or magnet file without
+// network access, or "" when it cannot be read that way.
+func localInfoHash(p string) string {
+	if !loader.IsLinkFile(p) {
+		mi, err := metainfo.LoadFromFile(p)
+		if err != nil {
+			return ""
+		}
+		return mi.HashInfoBytes().HexString()
+	}
+	link, err := loader.ReadLink(p)
+	if err != nil {
+		return ""
+	}
+	m, err := metainfo.ParseMagnetUri(link)
+	if err != nil {
+		return ""
+	}
+	return m.InfoHash.HexString()
+}
+
 // MaybeRemoveByPath removes a torrent by its .torrent file path if tracked.
 func (s *Service) MaybeRemoveByPath(route, p string) bool {
 	s.mu.Lock()
@@ -828,6 +1001,123 @@ func (s *Service) StartWatcherForRoute(route string) error {
 	return nil
 }
 
+// StartRouteWatchers starts a watcher for every UI-managed route found under
+// the routes root.
+func (s *Service) StartRouteWatchers() error {
+	if s.routesRoot == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(s.routesRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var errs []error
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if err := s.StartWatcherForRoute(e.Name()); err != nil {
+			errs = append(errs, fmt.Errorf("route %s: %w", e.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WatcherStatuses returns the status of every running route watcher, sorted
+// by route and folder.
+func (s *Service) WatcherStatuses() []watchers.WatcherStatus {
+	s.mu.Lock()
+	var ws []*watchers.RouteWatcher
+	for _, m := range []map[string]*watchers.RouteWatcher{s.watchers, s.folderWatchers} {
+		for _, rw := range m {
+			ws = append(ws, rw)
+		}
+	}
+	s.mu.Unlock()
+
+	out := make([]watchers.WatcherStatus, 0, len(ws))
+	for _, rw := range ws {
+		out = append(out, rw.Status())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Route != out[j].Route {
+			return out[i].Route < out[j].Route
+		}
+		return out[i].Folder < out[j].Folder
+	})
+	return out
+}
+
+// StartFolderWatchers starts watchers for the torrent_folder of every
+// configured route.
+func (s *Service) StartFolderWatchers(routes []*cfgpkg.Route) error {
+	var errs []error
+	for _, r := range routes {
+		if r.TorrentFolder == "" {
+			continue
+		}
+		if err := s.startFolderWatcher(r.Name, r.TorrentFolder); err != nil {
+			errs = append(errs, fmt.Errorf("route %s: %w", r.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) startFolderWatcher(route, folder string) error {
+	s.mu.Lock()
+	if _, ok := s.folderWatchers[route]; ok {
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	rw, err := watchers.NewRouteWatcher(s, route, folder)
+	if err != nil {
+		return err
+	}
+	if err := rw.Start(); err != nil {
+		_ = rw.Close()
+		return err
+	}
+	s.mu.Lock()
+	s.folderWatchers[route] = rw
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Service) closeFolderWatcher(route string) {
+	s.mu.Lock()
+	rw, ok := s.folderWatchers[route]
+	delete(s.folderWatchers, route)
+	s.mu.Unlock()
+	if ok {
+		if err := rw.Close(); err != nil {
+			s.log.Warn().Err(err).Str("route", route).Msg("problem closing route watcher")
+		}
+	}
+}
+
+// CloseWatchers stops all route watchers, both UI-managed and configured
+// torrent folders.
+func (s *Service) CloseWatchers() {
+	s.mu.Lock()
+	ws := s.watchers
+	fws := s.folderWatchers
+	s.watchers = make(map[string]*watchers.RouteWatcher)
+	s.folderWatchers = make(map[string]*watchers.RouteWatcher)
+	s.mu.Unlock()
+	for _, m := range []map[string]*watchers.RouteWatcher{ws, fws} {
+		for route, rw := range m {
+			if err := rw.Close(); err != nil {
+				s.log.Warn().Err(err).Str("route", route).Msg("problem closing route watcher")
+			}
+		}
+	}
+}
+
 // CreateRoute creates a new route and starts its watcher.
 func (s *Service) CreateRoute(route string) error {
 	if route == "" {
@@ -916,6 +1206,9 @@ type summary struct {
 	// Extended snapshot for seamless UI
 	PieceChunks []*PieceChunk `json:"pieceChunks,omitempty"`
 	TotalPieces int           `json:"totalPieces,omitempty"`
+	// Arr webhook state, see webhook.go
+	ImportedAt int64    `json:"importedAt,omitempty"`
+	Media      []string `json:"media,omitempty"`
 }
 
 type fileSummary struct {
@@ -925,6 +1218,61 @@ type fileSummary struct {
 
 type cachedState struct {
 	summary
+	// seq is the version of the summary, see Service.metaSeq
+	seq uint64
+}
+
+// cacheMeta caches sm and returns its version. s.mu must be held.
+func (s *Service) cacheMeta(sm summary) uint64 {
+	s.metaSeq++
+	s.cached[sm.Hash] = &cachedState{summary: sm, seq: s.metaSeq}
+	return s.metaSeq
+}
+
+// storeMeta writes sm, cached at version seq, to the DB unless a newer
+// version of it was written or deleted already. It must not be called with
+// s.mu held.
+func (s *Service) storeMeta(sm summary, seq uint64) error {
+	b, err := json.Marshal(sm)
+	if err != nil {
+		return err
+	}
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	if s.metaStored[sm.Hash] > seq {
+		return nil
+	}
+	if err := s.db.SetMeta(sm.Hash, b); err != nil {
+		return err
+	}
+	s.metaStored[sm.Hash] = seq
+	return nil
+}
+
+// forgetTorrent clears the metadata, health history and tags of hash once
+// no route holds it anymore.
+func (s *Service) forgetTorrent(hash string) {
+	if s.s.RouteOf(hash) != "" {
+		return
+	}
+	s.dropMeta(hash)
+	_ = s.db.DeleteHealthSamples(hash)
+	_ = s.db.SetTags(hash, nil)
+}
+
+// dropMeta removes the cached and stored metadata of hash. Writes of
+// versions cached before are discarded.
+func (s *Service) dropMeta(hash string) {
+	s.mu.Lock()
+	delete(s.cached, hash)
+	s.metaSeq++
+	seq := s.metaSeq
+	s.mu.Unlock()
+
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	_ = s.db.DeleteMeta(hash)
+	s.metaStored[hash] = seq
 }
 
 // LoadMetaFromDB pre-populates minimal torrent stats from DB so UI is instant
@@ -933,6 +1281,11 @@ func (s *Service) LoadMetaFromDB() {
 	if err != nil || len(metas) == 0 {
 		return
 	}
+	s.loadMeta(metas)
+}
+
+// loadMeta caches the raw JSON metadata of metas, by hash.
+func (s *Service) loadMeta(metas map[string][]byte) {
 	s.s.mut.Lock()
 	now := time.Now()
 	for h, raw := range metas {
@@ -962,9 +1315,10 @@ func (s *Service) persistMetaFromTorrent(route string, t *torrent.Torrent) {
 		return
 	}
 	if t.Info() == nil {
+		addTimeout, _ := s.addTimeouts()
 		select {
 		case <-t.GotInfo():
-		case <-time.After(time.Duration(s.addTimeout) * time.Second):
+		case <-time.After(time.Duration(addTimeout) * time.Second):
 			return
 		}
 	}
@@ -1013,13 +1367,16 @@ func (s *Service) persistMetaFromTorrent(route string, t *torrent.Torrent) {
 		PieceChunks: pch,
 		TotalPieces: totalPieces,
 	}
-	b, err := json.Marshal(sm)
-	if err == nil {
-		_ = s.db.SetMeta(sm.Hash, b)
-		s.mu.Lock()
-		s.cached[sm.Hash] = &cachedState{summary: sm}
-		s.mu.Unlock()
+	s.mu.Lock()
+	if cs := s.cached[sm.Hash]; cs != nil {
+		sm.ImportedAt, sm.Media = cs.ImportedAt, cs.Media
+		if cs.AddedAt > 0 {
+			sm.AddedAt = cs.AddedAt
+		}
 	}
+	seq := s.cacheMeta(sm)
+	s.mu.Unlock()
+	_ = s.storeMeta(sm, seq)
 }
 
 // StartMetaPersistence periodically snapshots live stats to DB for fast startup cache
@@ -1072,6 +1429,12 @@ func (s *Service) dumpState() error {
 		addedAt  int64
 	}
 	var snaps []snap
+	s.mu.Lock()
+	cached := make(map[string]*cachedState, len(s.cached))
+	for k, v := range s.cached {
+		cached[k] = v
+	}
+	s.mu.Unlock()
 	// Build hash->route map and collect previous stats under lock
 	s.s.mut.Lock()
 	hashToRoute := make(map[string]string)
@@ -1098,6 +1461,7 @@ func (s *Service) dumpState() error {
 
 	// Build summaries including piece state snapshot
 	var out []summary
+	var seqs []uint64
 	for _, sn := range snaps {
 		var name string
 		var size int64
@@ -1135,15 +1499,14 @@ func (s *Service) dumpState() error {
 				}
 			}
 		}
-		if name == "" {
-			if cs := s.cached[sn.hash]; cs != nil {
-				name = cs.Name
-				size = cs.SizeBytes
-				piece = cs.PieceBytes
-				files = cs.Files
-			}
+		cs := cached[sn.hash]
+		if name == "" && cs != nil {
+			name = cs.Name
+			size = cs.SizeBytes
+			piece = cs.PieceBytes
+			files = cs.Files
 		}
-		out = append(out, summary{
+		sm := summary{
 			Hash:        sn.hash,
 			Route:       sn.route,
 			Name:        name,
@@ -1157,13 +1520,18 @@ func (s *Service) dumpState() error {
 			Files:       files,
 			PieceChunks: pch,
 			TotalPieces: totalPieces,
-		})
-	}
-	// persist each summary to DB
-	for _, sm := range out {
-		if b1, e := json.Marshal(sm); e == nil {
-			_ = s.db.SetMeta(sm.Hash, b1)
 		}
+		var seq uint64
+		if cs != nil {
+			sm.ImportedAt, sm.Media = cs.ImportedAt, cs.Media
+			seq = cs.seq
+		}
+		out = append(out, sm)
+		seqs = append(seqs, seq)
+	}
+	// persist each summary to DB, unless its cached state changed since
+	for i, sm := range out {
+		_ = s.storeMeta(sm, seqs[i])
 	}
 	return nil
 }
@@ -1230,7 +1598,8 @@ func (s *Service) CachedStat(hash string) *TorrentStats {
 
 // MergedRoutePage returns a paginated union of live and cached torrents for a route.
 // Live entries take precedence; cached-only entries fill gaps until torrents are loaded.
-func (s *Service) MergedRoutePage(route string, page, size int) *RoutePageStats {
+// Torrents missing any of tags are left out; every torrent gets its tags.
+func (s *Service) MergedRoutePage(route string, tags []string, page, size int) *RoutePageStats {
 	if size <= 0 {
 		size = 25
 	}
@@ -1274,6 +1643,16 @@ func (s *Service) MergedRoutePage(route string, page, size int) *RoutePageStats
 	}
 	s.mu.Unlock()
 
+	byHash := s.TorrentTags()
+	filtered := live[:0]
+	for _, ts := range live {
+		ts.Tags = byHash[ts.Hash]
+		if hasTags(ts.Tags, tags) {
+			filtered = append(filtered, ts)
+		}
+	}
+	live = filtered
+
 	sort.Sort(byName(live))
 
 	total := len(live)
@@ -1356,11 +1735,14 @@ func (s *Service) StartHealthMonitor(conf *cfgpkg.Health) {
 	}
 	hm := &HealthMonitor{
 		s:        s,
+		stop:     make(chan struct{}),
 		interval: time.Duration(conf.IntervalMinutes) * time.Minute,
 		grace:    time.Duration(conf.GraceMinutes) * time.Minute,
 		minSeed:  conf.MinSeeders,
-		httpc:    &http.Client{Timeout: 15 * time.Second},
 		arr:      conf.Arr,
+		conf:     conf,
+
+		lastBytes: make(map[string]sampleBase),
 	}
 	s.hm = hm
 	s.mu.Unlock()
@@ -1469,7 +1851,17 @@ func (s *Service) NetworkStatus() (string, bool) {
 	return pub, connectible
 }
 
-// BlacklistAndRemove blacklists the torrent in Arr (if possible) and removes it locally
+// ArrError reports Arr failures of an operation that otherwise succeeded.
+type ArrError struct {
+	Err error
+}
+
+func (e *ArrError) Error() string { return "arr: " + e.Err.Error() }
+func (e *ArrError) Unwrap() error { return e.Err }
+
+// BlacklistAndRemove blacklists the torrent in Arr (if possible) and removes
+// it locally. Arr failures do not prevent the removal and are returned as
+// *ArrError.
 func (s *Service) BlacklistAndRemove(route, hash string) error {
 	conf, _ := s.ConfigSnapshot()
 	var arr []*cfgpkg.ArrInstance
@@ -1477,16 +1869,27 @@ func (s *Service) BlacklistAndRemove(route, hash string) error {
 		arr = conf.Health.Arr
 	}
 	// Try to resolve Arr clients for the given route via categories
-	httpc := &http.Client{Timeout: 15 * time.Second}
-	catToClients := resolveArrManagedRoutes(arr, httpc)
-	for _, c := range catToClients[route] {
-		if id, entity, entityID, err := c.findQueueByHash(hash); err == nil {
-			_ = c.blacklistQueueItem(id)
-			sleepShort()
-			_ = c.triggerSearch(entity, entityID)
-		}
+	catToClients := s.arrClientsByRoute(arr)
+	rel := &arrRelease{Hash: hash}
+	if ts, err := s.s.Stats(hash); err == nil {
+		rel.Name = ts.Name
+	}
+	arrErr := blacklistInArr(catToClients[route], rel)
+	if arrErr != nil {
+		s.log.Warn().Err(arrErr).Str("route", route).Str("hash", hash).Msg("error blacklisting torrent in Arr")
 	}
 	// Remove from runtime (and DB if present)
+	if err := s.removeTorrent(route, hash); err != nil {
+		return err
+	}
+	if arrErr != nil {
+		return &ArrError{Err: arrErr}
+	}
+	return nil
+}
+
+// removeTorrent removes a torrent from its route, and from the DB if present.
+func (s *Service) removeTorrent(route, hash string) error {
 	if err := s.RemoveFromHash(route, hash); err != nil {
 		if err := s.RemoveFromHashLocal(route, hash); err != nil {
 			return err
@@ -1497,22 +1900,8 @@ func (s *Service) BlacklistAndRemove(route, hash string) error {
 
 // ApplyTorrentTuning updates runtime FS parameters and persists to config if handler is set.
 func (s *Service) ApplyTorrentTuning(poolSize, readaheadMB int) error {
-	if poolSize <= 0 {
-		poolSize = 1
-	}
-	if readaheadMB < 0 {
-		readaheadMB = 0
-	}
+	poolSize, readaheadMB = s.SetTorrentTuning(poolSize, readaheadMB)
 	s.mu.Lock()
-	s.readerPoolSize = poolSize
-	s.readaheadMB = readaheadMB
-	// update all existing FS instances
-	for _, f := range s.fss {
-		if tf, ok := f.(*fs.Torrent); ok {
-			tf.SetReaderPoolSize(poolSize)
-			tf.SetReadaheadBytes(int64(readaheadMB) * 1024 * 1024)
-		}
-	}
 	ch := s.ch
 	s.mu.Unlock()
 	if ch != nil {
@@ -1527,63 +1916,25 @@ func (s *Service) ApplyTorrentTuning(poolSize, readaheadMB int) error {
 	return nil
 }
 
-// HealthMonitor periodically evaluates torrent health and interacts with Arr
-type HealthMonitor struct {
-	s        *Service
-	stop     chan struct{}
-	interval time.Duration
-	grace    time.Duration
-	minSeed  int
-	httpc    *http.Client
-	arr      []*cfgpkg.ArrInstance
-}
-
-func (hm *HealthMonitor) run() {
-	hm.stop = make(chan struct{})
-	t := time.NewTicker(hm.interval)
-	defer t.Stop()
-	for {
-		hm.checkOnce()
-		select {
-		case <-t.C:
-			continue
-		case <-hm.stop:
-			return
-		}
+// SetTorrentTuning updates runtime FS parameters without persisting them and
+// returns the sanitized values.
+func (s *Service) SetTorrentTuning(poolSize, readaheadMB int) (int, int) {
+	if poolSize <= 0 {
+		poolSize = 1
 	}
-}
-
-func (hm *HealthMonitor) Stop() { close(hm.stop) }
-
-func (hm *HealthMonitor) checkOnce() {
-	// Restrict to Arr-managed routes when possible
-	catToClients := resolveArrManagedRoutes(hm.arr, hm.httpc)
-	routes := hm.s.s.RoutesStats()
-	now := time.Now()
-	for _, rs := range routes {
-		// if arr-managed categories configured, skip routes that don't match
-		if len(catToClients) > 0 {
-			if _, ok := catToClients[rs.Name]; !ok {
-				continue
-			}
-		}
-		for _, ts := range rs.TorrentStats {
-			if ts.AddedAt > 0 && now.Sub(time.Unix(ts.AddedAt, 0)) < hm.grace {
-				continue
-			}
-			// Unknown or zero seeders => unhealthy
-			if ts.Seeders <= 0 {
-				hm.handleUnhealthy(rs.Name, ts.Hash, catToClients[rs.Name])
-				continue
-			}
-			if ts.Seeders < hm.minSeed {
-				hm.handleUnhealthy(rs.Name, ts.Hash, catToClients[rs.Name])
-			}
+	if readaheadMB < 0 {
+		readaheadMB = 0
+	}
+	s.mu.Lock()
+	s.readerPoolSize = poolSize
+	s.readaheadMB = readaheadMB
+	// update all existing FS instances
+	for _, f := range s.fss {
+		if tf, ok := f.(*fs.Torrent); ok {
+			tf.SetReaderPoolSize(poolSize)
+			tf.SetReadaheadBytes(int64(readaheadMB) * 1024 * 1024)
 		}
 	}
-}
-
-func (hm *HealthMonitor) handleUnhealthy(route, hash string, clients []*arrClient) {
-	// Reuse shared service method to ensure consistent behavior with manual overrides
-	_ = hm.s.BlacklistAndRemove(route, hash)
+	s.mu.Unlock()
+	return poolSize, readaheadMB
 }
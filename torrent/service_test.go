@@ -0,0 +1,161 @@
+package torrent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jkaberg/distribyted/fs"
+	"github.com/jkaberg/distribyted/torrent/loader"
+)
+
+// newTestService returns a service with a local client and index, and the
+// given routes mounted.
+func newTestService(t *testing.T, routes ...string) *Service {
+	c, err := torrent.NewClient(torrent.TestingConfig(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	db, err := loader.NewDB(filepath.Join(t.TempDir(), "magnetdb"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	s := NewService(nil, NewIndexFromLoader(db), NewStats(), c, 1, 1, false, t.TempDir())
+	for _, r := range routes {
+		s.s.AddRoute(r)
+		s.fss["/"+r] = fs.NewTorrent(1)
+	}
+	return s
+}
+
+// addTestTorrent adds a torrent without metadata to route and caches its
+// imported state and media keys.
+func addTestTorrent(t *testing.T, s *Service, route, hash string, imported bool, media ...string) {
+	m := "magnet:?xt=urn:btih:" + hash
+	require.NoError(t, s.db.AddMagnet(route, m))
+	tr, _ := s.c.AddTorrentInfoHash(metainfo.NewHashFromHex(hash))
+	s.s.Add(route, tr)
+	sm := summary{Hash: hash, Route: route, Media: media}
+	if imported {
+		sm.ImportedAt = 1
+	}
+	s.mu.Lock()
+	s.cached[hash] = &cachedState{summary: sm}
+	s.mu.Unlock()
+}
+
+// writeTestTorrent writes to p the .torrent file of a single file called
+// name and returns its info hash.
+func writeTestTorrent(t *testing.T, p, name string) string {
+	data := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(data, []byte(p), 0644))
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(t, info.BuildFromFilePath(data))
+	ib, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	mi := &metainfo.MetaInfo{InfoBytes: ib}
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0744))
+	f, err := os.Create(p)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, mi.Write(f))
+	return mi.HashInfoBytes().HexString()
+}
+
+func TestSyncRouteLinkFiles(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s := newTestService(t, "tv")
+	s.continueWhenAddTimeout = true
+	folder, err := s.EnsureRouteFolder("tv")
+	require.NoError(err)
+
+	tp := filepath.Join(t.TempDir(), "remote.torrent")
+	remote := writeTestTorrent(t, tp, "remote.mkv")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, tp)
+	}))
+	defer srv.Close()
+
+	magnet := filepath.Join(folder, "show.magnet")
+	require.NoError(os.WriteFile(magnet, []byte("magnet:?xt=urn:btih:"+hookNew+"\n"), 0644))
+	url := filepath.Join(folder, "sub", "remote.url")
+	require.NoError(os.MkdirAll(filepath.Dir(url), 0744))
+	require.NoError(os.WriteFile(url, []byte("[InternetShortcut]\nURL="+srv.URL+"/remote.torrent\n"), 0644))
+
+	tracked := func(p string) string {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.pathToHash[p]
+	}
+	loaded := func(h string) bool {
+		_, ok := s.c.Torrent(metainfo.NewHashFromHex(h))
+		return ok
+	}
+
+	require.NoError(s.SyncRouteFile("tv", magnet))
+	require.Equal(hookNew, tracked(magnet))
+	require.True(loaded(hookNew))
+
+	require.NoError(s.SyncRouteFolder("tv", folder))
+	require.Equal(remote, tracked(url))
+	require.True(loaded(remote))
+
+	require.NoError(os.Remove(magnet))
+	require.NoError(s.SyncRouteFile("tv", magnet))
+	require.Empty(tracked(magnet))
+	require.False(loaded(hookNew))
+
+	require.NoError(os.RemoveAll(filepath.Dir(url)))
+	require.NoError(s.SyncRouteFolder("tv", folder))
+	require.Empty(tracked(url))
+	require.False(loaded(remote))
+}
+
+func TestStoreMetaVersions(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s := newTestService(t, "tv")
+	addTestTorrent(t, s, "tv", hookEpisode, false)
+
+	stored := func() summary {
+		raw, err := s.db.GetMeta(hookEpisode)
+		require.NoError(err)
+		var sm summary
+		require.NoError(json.Unmarshal(raw, &sm))
+		return sm
+	}
+
+	s.mu.Lock()
+	old := s.cacheMeta(summary{Hash: hookEpisode, Route: "tv", Name: "old"})
+	s.mu.Unlock()
+	require.NoError(s.updateMeta(hookEpisode, func(sm *summary) { sm.ImportedAt = 1 }))
+
+	// a summary built before the update does not overwrite it
+	require.NoError(s.storeMeta(summary{Hash: hookEpisode, Route: "tv", Name: "old"}, old))
+	require.EqualValues(1, stored().ImportedAt)
+
+	s.mu.Lock()
+	cs := s.cached[hookEpisode]
+	s.mu.Unlock()
+	require.EqualValues(1, cs.ImportedAt)
+	require.Greater(cs.seq, old)
+
+	// nor comes back once deleted
+	s.dropMeta(hookEpisode)
+	require.NoError(s.storeMeta(cs.summary, cs.seq))
+	_, err := s.db.GetMeta(hookEpisode)
+	require.Error(err)
+}
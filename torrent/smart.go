@@ -0,0 +1,74 @@
+package torrent
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	cfgpkg "github.com/jkaberg/distribyted/config"
+	"github.com/jkaberg/distribyted/fs"
+)
+
+// SetSmartFolders mounts the smart folders in the container filesystem,
+// replacing the ones mounted before.
+func (s *Service) SetSmartFolders(folders []*cfgpkg.SmartFolder) {
+	s.mu.Lock()
+	cfs := s.cfs
+	old := s.smart
+	s.smart = make([]string, 0, len(folders))
+	for _, f := range folders {
+		s.smart = append(s.smart, f.Name)
+	}
+	s.mu.Unlock()
+	if cfs == nil {
+		return
+	}
+	for _, name := range old {
+		_ = cfs.RemoveFS(path.Join("/", name))
+	}
+	for _, f := range folders {
+		sfs := fs.NewSmartFs(smartQuery(f), s.routeFilesystems, s.smartInfo)
+		if err := cfs.AddFS(sfs, path.Join("/", f.Name)); err != nil {
+			s.log.Warn().Err(err).Str("folder", f.Name).Msg("error mounting smart folder")
+		}
+	}
+}
+
+func smartQuery(f *cfgpkg.SmartFolder) *fs.SmartQuery {
+	return &fs.SmartQuery{
+		Routes:      f.Routes,
+		Tags:        f.Tags,
+		Patterns:    f.Patterns,
+		MinSize:     f.MinSizeMB * 1024 * 1024,
+		AddedWithin: time.Duration(f.AddedWithinDays) * 24 * time.Hour,
+		Video:       f.Video,
+		Flatten:     f.Flatten,
+	}
+}
+
+// routeFilesystems returns the torrent filesystem of every route, by route.
+func (s *Service) routeFilesystems() map[string]*fs.Torrent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]*fs.Torrent, len(s.fss))
+	for mount, f := range s.fss {
+		if tfs, ok := f.(*fs.Torrent); ok {
+			out[strings.TrimPrefix(mount, "/")] = tfs
+		}
+	}
+	return out
+}
+
+// smartInfo returns the tags and added time of the loaded torrents, by hash.
+func (s *Service) smartInfo() map[string]*fs.TorrentInfo {
+	out := make(map[string]*fs.TorrentInfo)
+	for h, at := range s.s.AddedTimes() {
+		out[h] = &fs.TorrentInfo{AddedAt: at}
+	}
+	for h, tags := range s.TorrentTags() {
+		if ti := out[h]; ti != nil {
+			ti.Tags = tags
+		}
+	}
+	return out
+}
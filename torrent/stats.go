@@ -39,8 +39,12 @@ type TorrentStats struct {
 	TotalPieces     int           `json:"totalPieces"`
 	PieceSize       int64         `json:"pieceSize"`
 	AddedAt         int64         `json:"addedAt,omitempty"`
-	Health          string        `json:"health,omitempty"`
-	Unhealthy       bool          `json:"unhealthy,omitempty"`
+	// Availability is the number of distributed copies in the connected
+	// swarm, like the qBittorrent availability column
+	Availability float64  `json:"availability"`
+	Health       string   `json:"health,omitempty"`
+	Unhealthy    bool     `json:"unhealthy,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
 }
 
 type byName []*TorrentStats
@@ -88,6 +92,7 @@ type stat struct {
 	uploadBytes        int64
 	peers              int
 	seeders            int
+	availability       float64
 	time               time.Time
 	createdAt          time.Time
 }
@@ -97,6 +102,8 @@ type Stats struct {
 	torrents        map[string]*torrent.Torrent
 	torrentsByRoute map[string]map[string]*torrent.Torrent
 	previousStats   map[string]*stat
+	// unhealthy holds torrents tagged by the health monitor
+	unhealthy map[string]bool
 
 	gTime time.Time
 }
@@ -107,6 +114,7 @@ func NewStats() *Stats {
 		torrents:        make(map[string]*torrent.Torrent),
 		torrentsByRoute: make(map[string]map[string]*torrent.Torrent),
 		previousStats:   make(map[string]*stat),
+		unhealthy:       make(map[string]bool),
 	}
 }
 
@@ -124,7 +132,12 @@ func (s *Stats) Add(route string, t *torrent.Torrent) {
 	h := t.InfoHash().String()
 
 	s.torrents[h] = t
-	s.previousStats[h] = &stat{createdAt: time.Now()}
+	// keep the time restored from the index for torrents added before
+	created := time.Now()
+	if p := s.previousStats[h]; p != nil && p.createdAt.Unix() > 0 {
+		created = p.createdAt
+	}
+	s.previousStats[h] = &stat{createdAt: created}
 
 	_, ok := s.torrentsByRoute[route]
 	if !ok {
@@ -134,11 +147,25 @@ func (s *Stats) Add(route string, t *torrent.Torrent) {
 	s.torrentsByRoute[route][h] = t
 }
 
+// AddedTimes returns when the loaded torrents were added, by hash.
+func (s *Stats) AddedTimes() map[string]time.Time {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	out := make(map[string]time.Time, len(s.torrents))
+	for h := range s.torrents {
+		if p := s.previousStats[h]; p != nil {
+			out[h] = p.createdAt
+		}
+	}
+	return out
+}
+
 func (s *Stats) Del(route, hash string) {
 	s.mut.Lock()
 	defer s.mut.Unlock()
 	delete(s.torrents, hash)
 	delete(s.previousStats, hash)
+	delete(s.unhealthy, hash)
 	ts, ok := s.torrentsByRoute[route]
 	if !ok {
 		return
@@ -149,6 +176,14 @@ func (s *Stats) Del(route, hash string) {
 	// but ensure no nil entries linger.
 }
 
+// InRoute reports whether the torrent hash is loaded in route.
+func (s *Stats) InRoute(route, hash string) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	_, ok := s.torrentsByRoute[route][hash]
+	return ok
+}
+
 // RouteOf returns the route name for a given torrent hash, or empty if unknown.
 func (s *Stats) RouteOf(hash string) string {
 	s.mut.Lock()
@@ -161,6 +196,17 @@ func (s *Stats) RouteOf(hash string) string {
 	return ""
 }
 
+// SetUnhealthy tags or untags a torrent as unhealthy.
+func (s *Stats) SetUnhealthy(hash string, v bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if v {
+		s.unhealthy[hash] = true
+	} else {
+		delete(s.unhealthy, hash)
+	}
+}
+
 // RemoveRoute removes the route entry and stops reporting it in route stats.
 func (s *Stats) RemoveRoute(route string) {
 	s.mut.Lock()
@@ -304,6 +350,7 @@ func (s *Stats) stats(now time.Time, t *torrent.Torrent, chunks bool) *TorrentSt
 		ts.UploadedBytes = prev.uploadBytes
 		ts.Peers = prev.peers
 		ts.Seeders = prev.seeders
+		ts.Availability = prev.availability
 	} else {
 		st := t.Stats()
 		rd := st.BytesReadData.Int64()
@@ -316,12 +363,15 @@ func (s *Stats) stats(now time.Time, t *torrent.Torrent, chunks bool) *TorrentSt
 			time:               now,
 			peers:              st.TotalPeers,
 			seeders:            st.ConnectedSeeders,
+			availability:       distributedCopies(t),
+			createdAt:          prev.createdAt,
 		}
 
 		ts.DownloadedBytes = ist.downloadBytes
 		ts.UploadedBytes = ist.uploadBytes
 		ts.Peers = ist.peers
 		ts.Seeders = ist.seeders
+		ts.Availability = ist.availability
 
 		s.previousStats[t.InfoHash().String()] = ist
 	}
@@ -358,6 +408,7 @@ func (s *Stats) stats(now time.Time, t *torrent.Torrent, chunks bool) *TorrentSt
 	ts.Name = t.Name()
 	ts.TotalPieces = totalPieces
 	ts.AddedAt = prev.createdAt.Unix()
+	ts.Unhealthy = s.unhealthy[ts.Hash]
 
 	if ti := t.Info(); ti != nil {
 		ts.PieceSize = ti.PieceLength
@@ -375,3 +426,57 @@ func (s *Stats) stats(now time.Time, t *torrent.Torrent, chunks bool) *TorrentSt
 }
 
 const gap time.Duration = 300 * time.Millisecond
+
+// distributedCopies returns the number of full copies of the torrent held by
+// connected peers: the availability of the rarest piece plus the fraction of
+// pieces available more often than that.
+func distributedCopies(t *torrent.Torrent) float64 {
+	if t.Info() == nil {
+		return 0
+	}
+	n := t.NumPieces()
+	if n == 0 {
+		return 0
+	}
+	// peers having every piece are counted once instead of per piece
+	var seeds int
+	var counts []int
+	for _, pc := range t.PeerConns() {
+		bm := pc.PeerPieces()
+		if bm.GetCardinality() >= uint64(n) {
+			seeds++
+			continue
+		}
+		if counts == nil {
+			counts = make([]int, n)
+		}
+		it := bm.Iterator()
+		for it.HasNext() {
+			if i := int(it.Next()); i < n {
+				counts[i]++
+			}
+		}
+	}
+	return copiesOf(n, seeds, counts)
+}
+
+// copiesOf returns the distributed copies of a torrent of n pieces held by
+// seeds peers having every piece and others having counts[i] copies of piece
+// i. counts is nil when there are no other peers.
+func copiesOf(n, seeds int, counts []int) float64 {
+	if counts == nil {
+		return float64(seeds)
+	}
+	least, above := counts[0], 0
+	for _, c := range counts[1:] {
+		if c < least {
+			least = c
+		}
+	}
+	for _, c := range counts {
+		if c > least {
+			above++
+		}
+	}
+	return float64(seeds+least) + float64(above)/float64(n)
+}
@@ -0,0 +1,42 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistributedCopies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		n      int
+		seeds  int
+		counts []int
+		want   float64
+	}{
+		{name: "no peers", n: 4},
+		{name: "seeds only", n: 4, seeds: 2, want: 2},
+		{name: "missing piece", n: 4, counts: []int{1, 1, 0, 1}, want: 0.75},
+		{name: "one full copy", n: 4, counts: []int{1, 1, 1, 1}, want: 1},
+		{name: "partial above the rarest", n: 4, counts: []int{2, 1, 1, 3}, want: 1.5},
+		{name: "seeds and partial peers", n: 2, seeds: 1, counts: []int{1, 0}, want: 1.5},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.InDelta(t, tt.want, copiesOf(tt.n, tt.seeds, tt.counts), 1e-9)
+		})
+	}
+}
+
+func TestDistributedCopiesWithoutInfo(t *testing.T) {
+	t.Parallel()
+
+	s := newTestService(t)
+	tr, _ := s.c.AddTorrentInfoHash(metainfo.NewHashFromHex(hookNew))
+	require.Zero(t, distributedCopies(tr))
+}
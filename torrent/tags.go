@@ -0,0 +1,152 @@
+package torrent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// NormalizeTags trims tags and drops empty and duplicated ones. Tags are
+// used as directory names, so separators are rejected.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if t == "." || t == ".." || strings.ContainsAny(t, `/\`) {
+			return nil, fmt.Errorf("invalid tag %q", t)
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// AddTags adds tags to the torrents of hashes.
+func (s *Service) AddTags(hashes, tags []string) error {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return s.updateTags(hashes, func(cur []string) []string {
+		return append(cur, tags...)
+	})
+}
+
+// RemoveTags removes tags from the torrents of hashes, or every tag when
+// tags is empty.
+func (s *Service) RemoveTags(hashes, tags []string) error {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	drop := make(map[string]bool)
+	for _, t := range tags {
+		drop[t] = true
+	}
+	return s.updateTags(hashes, func(cur []string) []string {
+		var out []string
+		for _, t := range cur {
+			if len(drop) > 0 && !drop[t] {
+				out = append(out, t)
+			}
+		}
+		return out
+	})
+}
+
+// SetTorrentTags replaces the tags of the torrent hash loaded in route. It
+// returns ErrTorrentNotFound when the torrent is not in the route.
+func (s *Service) SetTorrentTags(route, hash string, tags []string) error {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	if !s.s.InRoute(route, strings.ToLower(hash)) {
+		return ErrTorrentNotFound
+	}
+	return s.updateTags([]string{hash}, func([]string) []string { return tags })
+}
+
+func (s *Service) updateTags(hashes []string, fn func(cur []string) []string) error {
+	if s.db == nil {
+		return fmt.Errorf("no index database")
+	}
+	// hashes are parts of the index keys, only info hashes are accepted
+	keys := make([]string, len(hashes))
+	for i, h := range hashes {
+		var ih metainfo.Hash
+		if err := ih.FromHexString(h); err != nil {
+			return fmt.Errorf("invalid torrent hash %q", h)
+		}
+		keys[i] = ih.HexString()
+	}
+	s.tagsMu.Lock()
+	defer s.tagsMu.Unlock()
+	all, err := s.db.ListTags()
+	if err != nil {
+		return err
+	}
+	for _, h := range keys {
+		tags, _ := NormalizeTags(fn(all[h]))
+		if err := s.db.SetTags(h, tags); err != nil {
+			return fmt.Errorf("error setting tags of %s: %w", h, err)
+		}
+	}
+	return nil
+}
+
+// TorrentTags returns the tags of every tagged torrent, by hash.
+func (s *Service) TorrentTags() map[string][]string {
+	if s.db == nil {
+		return nil
+	}
+	tags, err := s.db.ListTags()
+	if err != nil {
+		s.log.Warn().Err(err).Msg("error listing torrent tags")
+		return nil
+	}
+	return tags
+}
+
+// Tags returns every tag in use, sorted.
+func (s *Service) Tags() []string {
+	seen := make(map[string]bool)
+	out := []string{}
+	for _, tags := range s.TorrentTags() {
+		for _, t := range tags {
+			if !seen[t] {
+				seen[t] = true
+				out = append(out, t)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// hasTags reports whether have holds every tag of want.
+func hasTags(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
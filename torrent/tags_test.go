@@ -0,0 +1,103 @@
+package torrent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	tags, err := NormalizeTags([]string{" kids", "4k", "", "kids ", "keep"})
+	require.NoError(err)
+	require.Equal([]string{"4k", "keep", "kids"}, tags)
+
+	_, err = NormalizeTags([]string{"a/b"})
+	require.Error(err)
+
+	require.True(hasTags([]string{"4k", "kids"}, []string{"kids"}))
+	require.True(hasTags([]string{"4k"}, nil))
+	require.False(hasTags([]string{"4k"}, []string{"4k", "kids"}))
+}
+
+func TestServiceTags(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s := newTestService(t, "tv")
+	const a, b = hookEpisode, hookPack
+	addTestTorrent(t, s, "tv", a, false)
+
+	require.NoError(s.AddTags([]string{a, b}, []string{"kids", " 4k"}))
+	require.NoError(s.AddTags([]string{a}, []string{"keep", "kids"}))
+	require.Equal(map[string][]string{a: {"4k", "keep", "kids"}, b: {"4k", "kids"}}, s.TorrentTags())
+	require.Equal([]string{"4k", "keep", "kids"}, s.Tags())
+
+	// hashes are stored lower case
+	require.NoError(s.RemoveTags([]string{strings.ToUpper(a)}, []string{"4k", "missing"}))
+	require.Equal([]string{"keep", "kids"}, s.TorrentTags()[a])
+	require.Equal([]string{"4k", "kids"}, s.TorrentTags()[b])
+
+	// no tags clears every tag
+	require.NoError(s.RemoveTags([]string{b}, nil))
+	require.NotContains(s.TorrentTags(), b)
+
+	require.NoError(s.SetTorrentTags("tv", strings.ToUpper(a), []string{"4k"}))
+	require.Equal([]string{"4k"}, s.TorrentTags()[a])
+	require.ErrorIs(s.SetTorrentTags("movies", a, []string{"kids"}), ErrTorrentNotFound)
+	require.ErrorIs(s.SetTorrentTags("tv", b, []string{"kids"}), ErrTorrentNotFound)
+
+	// hashes are index keys, anything but an info hash is refused
+	for _, h := range []string{"", "abc", a[:38] + "/x", a + "00", strings.Repeat("z", 40)} {
+		require.Error(s.AddTags([]string{h}, []string{"kids"}), h)
+	}
+	require.Error(s.AddTags([]string{b, "nope"}, []string{"kids"}))
+	require.NotContains(s.TorrentTags(), b)
+
+	require.Error(s.AddTags([]string{a}, []string{"a/b"}))
+	require.Error(s.RemoveTags([]string{a}, []string{".."}))
+	require.Equal([]string{"4k"}, s.TorrentTags()[a])
+
+	// tagging nothing keeps the tags
+	require.NoError(s.AddTags([]string{a}, []string{" "}))
+	require.Equal([]string{"4k"}, s.TorrentTags()[a])
+}
+
+func TestUpdateTagsWithoutIndex(t *testing.T) {
+	t.Parallel()
+
+	s := &Service{}
+	require.Error(t, s.AddTags([]string{hookEpisode}, []string{"kids"}))
+	require.Nil(t, s.TorrentTags())
+	require.Empty(t, s.Tags())
+}
+
+func TestRemoveKeepsTagsOfOtherRoutes(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s := newTestService(t, "tv", "movies")
+	addTestTorrent(t, s, "tv", hookEpisode, false)
+	addTestTorrent(t, s, "movies", hookEpisode, false)
+	require.NoError(s.AddTags([]string{hookEpisode}, []string{"keep"}))
+	require.NoError(s.db.AddHealthSample(hookEpisode, 1, []byte(`{"time":1}`)))
+
+	require.NoError(s.RemoveFromHashLocal("tv", hookEpisode))
+	require.Equal([]string{"keep"}, s.TorrentTags()[hookEpisode])
+	samples, err := s.db.HealthSamples(hookEpisode, 0)
+	require.NoError(err)
+	require.Len(samples, 1)
+
+	// the last route forgets the torrent
+	require.NoError(s.RemoveFromHashLocal("movies", hookEpisode))
+	require.NotContains(s.TorrentTags(), hookEpisode)
+	samples, err = s.db.HealthSamples(hookEpisode, 0)
+	require.NoError(err)
+	require.Empty(samples)
+}
@@ -1,8 +1,10 @@
 package watchers
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -10,14 +12,17 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/jkaberg/distribyted/config"
+	"github.com/jkaberg/distribyted/torrent/loader"
 )
 
 // ServiceFacade captures the minimal API needed by watchers from the Service.
 type ServiceFacade interface {
 	SyncRouteFolder(route, folder string) error
+	SyncRouteFile(route, path string) error
 }
 
-// global watch interval in seconds, adjustable at runtime
+// global watch interval in seconds, adjustable at runtime. File events are
+// synced once no new event was seen on their path for this long.
 var watchIntervalSec int32 = 5
 
 func GetWatchInterval() int { return int(atomic.LoadInt32(&watchIntervalSec)) }
@@ -28,13 +33,37 @@ func SetWatchInterval(interval int) {
 	atomic.StoreInt32(&watchIntervalSec, int32(interval))
 }
 
+// reconcileInterval is the period of the full folder sync catching the
+// changes missed by the event handling.
+const reconcileInterval = 10 * time.Minute
+
+// WatcherStatus reports the activity of a route watcher.
+type WatcherStatus struct {
+	Route        string    `json:"route"`
+	Folder       string    `json:"folder"`
+	LastSync     time.Time `json:"lastSync"`
+	LastFullSync time.Time `json:"lastFullSync"`
+	// Pending is the number of paths waiting for their debounce delay
+	Pending       int        `json:"pending"`
+	Events        uint64     `json:"events"`
+	Errors        uint64     `json:"errors"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
 type RouteWatcher struct {
 	route  string
 	folder string
 	w      *fsnotify.Watcher
 	s      ServiceFacade
+	done   chan struct{}
 
-	eventsCount uint64
+	// syncMu serializes the syncs of the watcher
+	syncMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+	st      WatcherStatus
 }
 
 func NewRouteWatcher(s ServiceFacade, route, folder string) (*RouteWatcher, error) {
@@ -44,10 +73,13 @@ func NewRouteWatcher(s ServiceFacade, route, folder string) (*RouteWatcher, erro
 	}
 
 	return &RouteWatcher{
-		route:  route,
-		folder: folder,
-		w:      w,
-		s:      s,
+		route:   route,
+		folder:  folder,
+		w:       w,
+		s:       s,
+		done:    make(chan struct{}),
+		pending: make(map[string]*time.Timer),
+		st:      WatcherStatus{Route: route, Folder: folder},
 	}, nil
 }
 
@@ -56,23 +88,12 @@ func (rw *RouteWatcher) Start() error {
 		return err
 	}
 
-	// Add all existing subdirectories
-	if err := filepath.Walk(rw.folder, func(p string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.Mode().IsDir() {
-			return rw.w.Add(p)
-		}
-		return nil
-	}); err != nil {
+	if err := rw.addDirs(rw.folder, false); err != nil {
 		return err
 	}
 
 	// Initial sync
-	if err := rw.s.SyncRouteFolder(rw.route, rw.folder); err != nil {
-		log.Error().Err(err).Str("route", rw.route).Str("folder", rw.folder).Msg("error syncing route folder on start")
-	}
+	rw.fullSync()
 
 	go func() {
 		for {
@@ -81,34 +102,30 @@ func (rw *RouteWatcher) Start() error {
 				if !ok {
 					return
 				}
-				// Add newly created directories to watcher
-				if event.Op&fsnotify.Create == fsnotify.Create {
-					fi, err := os.Stat(event.Name)
-					if err == nil && fi.IsDir() {
-						_ = rw.w.Add(event.Name)
-					}
-				}
-				atomic.AddUint64(&rw.eventsCount, 1)
+				rw.handle(event)
 			case err, ok := <-rw.w.Errors:
 				if !ok {
 					return
 				}
-				log.Error().Err(err).Msg("watcher error")
+				log.Error().Err(err).Str("route", rw.route).Msg("watcher error")
+				rw.recordError(err)
+				if errors.Is(err, fsnotify.ErrEventOverflow) {
+					go rw.fullSync()
+				}
 			}
 		}
 	}()
 
 	go func() {
+		t := time.NewTicker(reconcileInterval)
+		defer t.Stop()
 		for {
-			time.Sleep(time.Duration(GetWatchInterval()) * time.Second)
-			if rw.eventsCount == 0 {
-				continue
-			}
-			ec := rw.eventsCount
-			if err := rw.s.SyncRouteFolder(rw.route, rw.folder); err != nil {
-				log.Error().Err(err).Str("route", rw.route).Str("folder", rw.folder).Msg("error syncing route folder")
+			select {
+			case <-t.C:
+				rw.fullSync()
+			case <-rw.done:
+				return
 			}
-			atomic.AddUint64(&rw.eventsCount, ^uint64(ec-1))
 		}
 	}()
 
@@ -116,10 +133,140 @@ func (rw *RouteWatcher) Start() error {
 	return nil
 }
 
+// handle schedules the sync of the path of an event. Directories created
+// after start are watched and their files synced.
+func (rw *RouteWatcher) handle(event fsnotify.Event) {
+	rw.mu.Lock()
+	rw.st.Events++
+	rw.mu.Unlock()
+
+	switch {
+	case event.Has(fsnotify.Create):
+		if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+			if err := rw.addDirs(event.Name, true); err != nil {
+				rw.recordError(err)
+			}
+			return
+		}
+		if loader.IsTorrentFile(event.Name) {
+			rw.schedule(event.Name)
+		}
+	case event.Has(fsnotify.Write):
+		if loader.IsTorrentFile(event.Name) {
+			rw.schedule(event.Name)
+		}
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		// The path may be a directory: the service unloads everything under it
+		rw.schedule(event.Name)
+	}
+}
+
+// addDirs watches dir and its subdirectories. When schedule is set, the
+// torrent files found are scheduled to be synced.
+func (rw *RouteWatcher) addDirs(dir string, schedule bool) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsDir() {
+			return rw.w.Add(p)
+		}
+		if schedule && loader.IsTorrentFile(p) {
+			rw.schedule(p)
+		}
+		return nil
+	})
+}
+
+// schedule syncs p once no other event was seen on it for the watch interval.
+func (rw *RouteWatcher) schedule(p string) {
+	d := time.Duration(GetWatchInterval()) * time.Second
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if t, ok := rw.pending[p]; ok {
+		t.Reset(d)
+		return
+	}
+	rw.pending[p] = time.AfterFunc(d, func() { rw.syncFile(p) })
+}
+
+func (rw *RouteWatcher) syncFile(p string) {
+	rw.mu.Lock()
+	delete(rw.pending, p)
+	rw.mu.Unlock()
+
+	select {
+	case <-rw.done:
+		return
+	default:
+	}
+
+	rw.syncMu.Lock()
+	err := rw.s.SyncRouteFile(rw.route, p)
+	rw.syncMu.Unlock()
+	if err != nil {
+		log.Error().Err(err).Str("route", rw.route).Str("path", p).Msg("error syncing route file")
+		rw.recordError(err)
+		return
+	}
+
+	rw.mu.Lock()
+	rw.st.LastSync = time.Now()
+	rw.mu.Unlock()
+}
+
+// fullSync reconciles the whole folder with the loaded torrents.
+func (rw *RouteWatcher) fullSync() {
+	rw.syncMu.Lock()
+	err := rw.s.SyncRouteFolder(rw.route, rw.folder)
+	rw.syncMu.Unlock()
+	if err != nil {
+		log.Error().Err(err).Str("route", rw.route).Str("folder", rw.folder).Msg("error syncing route folder")
+		rw.recordError(err)
+		return
+	}
+
+	now := time.Now()
+	rw.mu.Lock()
+	rw.st.LastSync = now
+	rw.st.LastFullSync = now
+	rw.mu.Unlock()
+}
+
+func (rw *RouteWatcher) recordError(err error) {
+	rw.mu.Lock()
+	rw.st.Errors++
+	now := time.Now()
+	rw.st.LastError = err.Error()
+	rw.st.LastErrorTime = &now
+	rw.mu.Unlock()
+}
+
+// Status returns the current activity of the watcher.
+func (rw *RouteWatcher) Status() WatcherStatus {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	st := rw.st
+	st.Pending = len(rw.pending)
+	return st
+}
+
 func (rw *RouteWatcher) Close() error {
 	if rw.w == nil {
 		return nil
 	}
+	select {
+	case <-rw.done:
+	default:
+		close(rw.done)
+	}
+	rw.mu.Lock()
+	for p, t := range rw.pending {
+		t.Stop()
+		delete(rw.pending, p)
+	}
+	rw.mu.Unlock()
 	return rw.w.Close()
 }
 
@@ -142,37 +289,3 @@ func StartRouteWatchers(s ServiceFacade, routes []*config.Route) ([]*RouteWatche
 	}
 	return out, nil
 }
-
-// StartRouteWatchersFromRoot scans a metadata routes root and starts a watcher for
-// each route directory found under it. Expected layout: <root>/<route>
-func StartRouteWatchersFromRoot(s ServiceFacade, root string) ([]*RouteWatcher, error) {
-	var out []*RouteWatcher
-	// Walk only first level directories under root
-	entries, err := os.ReadDir(root)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, err
-	}
-	for _, e := range entries {
-		if !e.IsDir() {
-			continue
-		}
-		route := e.Name()
-		folder := filepath.Join(root, route)
-		// Ensure the route folder exists
-		if err := os.MkdirAll(folder, 0744); err != nil {
-			return nil, err
-		}
-		rw, err := NewRouteWatcher(s, route, folder)
-		if err != nil {
-			return nil, err
-		}
-		if err := rw.Start(); err != nil {
-			return nil, err
-		}
-		out = append(out, rw)
-	}
-	return out, nil
-}
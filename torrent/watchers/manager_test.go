@@ -0,0 +1,87 @@
+package watchers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeService struct {
+	mu    sync.Mutex
+	full  int
+	files map[string]int
+}
+
+func (f *fakeService) SyncRouteFolder(route, folder string) error {
+	f.mu.Lock()
+	f.full++
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeService) SyncRouteFile(route, p string) error {
+	f.mu.Lock()
+	f.files[p]++
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeService) synced(p string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.files[p]
+}
+
+func TestRouteWatcherDebounce(t *testing.T) {
+	require := require.New(t)
+
+	SetWatchInterval(1)
+	defer SetWatchInterval(5)
+
+	dir := t.TempDir()
+	s := &fakeService{files: make(map[string]int)}
+	rw, err := NewRouteWatcher(s, "route", dir)
+	require.NoError(err)
+	require.NoError(rw.Start())
+	defer rw.Close()
+
+	require.Equal(1, s.full)
+
+	p := filepath.Join(dir, "a.torrent")
+	for i := 0; i < 5; i++ {
+		require.NoError(os.WriteFile(p, []byte{byte(i)}, 0644))
+	}
+	require.NoError(os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644))
+
+	require.Eventually(func() bool { return s.synced(p) > 0 }, 5*time.Second, 50*time.Millisecond)
+	time.Sleep(1500 * time.Millisecond)
+	require.Equal(1, s.synced(p))
+	require.Zero(s.synced(filepath.Join(dir, "notes.txt")))
+
+	sub := filepath.Join(dir, "sub")
+	require.NoError(os.Mkdir(sub, 0744))
+	// Picked by the event of the file or by the walk of the new directory
+	require.NoError(os.WriteFile(filepath.Join(sub, "b.magnet"), nil, 0644))
+	require.Eventually(func() bool { return s.synced(filepath.Join(sub, "b.magnet")) > 0 }, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(os.RemoveAll(sub))
+	require.Eventually(func() bool { return s.synced(sub) > 0 }, 5*time.Second, 50*time.Millisecond)
+
+	st := rw.Status()
+	require.Equal("route", st.Route)
+	require.NotZero(st.Events)
+	require.Zero(st.Errors)
+	require.Nil(st.LastErrorTime)
+	require.False(st.LastFullSync.IsZero())
+
+	rw.recordError(errors.New("boom"))
+	st = rw.Status()
+	require.EqualValues(1, st.Errors)
+	require.Equal("boom", st.LastError)
+	require.NotNil(st.LastErrorTime)
+}
@@ -0,0 +1,276 @@
+package torrent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Arr webhook event types handled by HandleArrWebhook.
+const (
+	arrEventTest     = "Test"
+	arrEventGrab     = "Grab"
+	arrEventDownload = "Download"
+)
+
+// arrDeleteUpgrade is the deleteReason of files replaced by an upgrade.
+const arrDeleteUpgrade = "upgrade"
+
+type arrWebhookRef struct {
+	ID int `json:"id"`
+}
+
+// ArrWebhook is the payload of Radarr, Sonarr, Lidarr and Readarr webhook
+// notifications. Only the fields used to match torrents are decoded.
+type ArrWebhook struct {
+	EventType    string `json:"eventType"`
+	InstanceName string `json:"instanceName"`
+	DownloadID   string `json:"downloadId"`
+	IsUpgrade    bool   `json:"isUpgrade"`
+	DeleteReason string `json:"deleteReason"`
+
+	Movie    *arrWebhookRef   `json:"movie"`
+	Series   *arrWebhookRef   `json:"series"`
+	Episodes []*arrWebhookRef `json:"episodes"`
+	Artist   *arrWebhookRef   `json:"artist"`
+	Album    *arrWebhookRef   `json:"album"`
+	Albums   []*arrWebhookRef `json:"albums"`
+	Author   *arrWebhookRef   `json:"author"`
+	Book     *arrWebhookRef   `json:"book"`
+	Books    []*arrWebhookRef `json:"books"`
+}
+
+// WebhookResult reports what an Arr webhook changed.
+type WebhookResult struct {
+	Event    string   `json:"event"`
+	Imported []string `json:"imported,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Ignored  bool     `json:"ignored,omitempty"`
+}
+
+// media returns the keys of the media items the event is about, and of
+// their parents (series, artist, author). Keys are scoped by instance name
+// so ids of different Arr instances do not collide.
+func (p *ArrWebhook) media() (items, parents []string) {
+	prefix := strings.ToLower(p.InstanceName) + ":"
+	key := func(kind string, r *arrWebhookRef) string {
+		return fmt.Sprintf("%s%s:%d", prefix, kind, r.ID)
+	}
+	add := func(out []string, kind string, refs ...*arrWebhookRef) []string {
+		for _, r := range refs {
+			if r != nil && r.ID != 0 {
+				out = append(out, key(kind, r))
+			}
+		}
+		return out
+	}
+
+	switch {
+	case p.Movie != nil:
+		items = add(items, "movie", p.Movie)
+		parents = items
+	case p.Series != nil:
+		items = add(items, "episode", p.Episodes...)
+		parents = add(parents, "series", p.Series)
+	case p.Artist != nil:
+		items = add(add(items, "album", p.Album), "album", p.Albums...)
+		parents = add(parents, "artist", p.Artist)
+	case p.Author != nil:
+		items = add(add(items, "book", p.Book), "book", p.Books...)
+		parents = add(parents, "author", p.Author)
+	}
+	if len(items) == 0 {
+		items = parents
+	}
+	return items, parents
+}
+
+// HandleArrWebhook reacts to an Arr webhook notification. Grabs pre-warm the
+// torrent metadata, imports mark the torrent as imported, and upgrades or
+// deletes remove the superseded torrents. Upgrades and file deletes only
+// remove torrents whose media items are all covered by the event, so an
+// upgraded episode does not remove its season pack. When route is not empty
+// only torrents on that route are affected.
+func (s *Service) HandleArrWebhook(route string, p *ArrWebhook) (*WebhookResult, error) {
+	res := &WebhookResult{Event: p.EventType}
+	hash := strings.ToLower(p.DownloadID)
+	items, parents := p.media()
+
+	switch ev := p.EventType; {
+	case ev == arrEventTest:
+	case ev == arrEventGrab:
+		if hash == "" {
+			return nil, fmt.Errorf("grab event without downloadId")
+		}
+		go s.prewarm(hash, mergeKeys(items, parents))
+	case ev == arrEventDownload:
+		if hash == "" {
+			return nil, fmt.Errorf("download event without downloadId")
+		}
+		err := s.updateMeta(hash, func(sm *summary) {
+			sm.ImportedAt = time.Now().Unix()
+			sm.Media = mergeKeys(sm.Media, items, parents)
+		})
+		if errors.Is(err, ErrTorrentNotFound) {
+			// downloaded by another client
+			res.Ignored = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Imported = append(res.Imported, hash)
+		if p.IsUpgrade {
+			res.Removed = s.removeImported(route, mergeKeys(items, parents), hash, true)
+		}
+	case strings.HasSuffix(ev, "FileDelete"):
+		// upgrades are handled by the matching Download event
+		if p.DeleteReason == arrDeleteUpgrade {
+			res.Ignored = true
+			break
+		}
+		res.Removed = s.removeImported(route, mergeKeys(items, parents), "", true)
+	case ev == "AlbumDelete" || ev == "BookDelete":
+		res.Removed = s.removeImported(route, mergeKeys(items, parents), "", true)
+	case strings.HasSuffix(ev, "Delete"):
+		res.Removed = s.removeImported(route, parents, "", false)
+	default:
+		res.Ignored = true
+	}
+
+	s.log.Info().Str("event", p.EventType).Str("instance", p.InstanceName).Str("hash", hash).
+		Strs("removed", res.Removed).Bool("ignored", res.Ignored).Msg("Arr webhook")
+	return res, nil
+}
+
+// prewarm records the media keys of a grabbed torrent and fetches its
+// metadata once the download client added it.
+func (s *Service) prewarm(hash string, media []string) {
+	addTimeout, _ := s.addTimeouts()
+	deadline := time.Now().Add(time.Duration(addTimeout) * time.Second)
+	for {
+		if t, ok := s.c.Torrent(metainfo.NewHashFromHex(hash)); ok {
+			if route := s.s.RouteOf(hash); route != "" {
+				if err := s.updateMeta(hash, func(sm *summary) { sm.Media = mergeKeys(sm.Media, media) }); err != nil {
+					s.log.Warn().Err(err).Str("hash", hash).Msg("error storing grabbed torrent metadata")
+				}
+				s.persistMetaFromTorrent(route, t)
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			s.log.Debug().Str("hash", hash).Msg("grabbed torrent not added in time, skipping metadata pre-warm")
+			return
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// removeImported removes the imported torrents sharing a media key with
+// keys, except keep. With whole set only torrents whose media keys are all
+// in keys are removed.
+func (s *Service) removeImported(route string, keys []string, keep string, whole bool) []string {
+	if len(keys) == 0 {
+		return nil
+	}
+	want := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		want[k] = true
+	}
+
+	type target struct{ route, hash string }
+	var targets []target
+	s.mu.Lock()
+	for h, cs := range s.cached {
+		if h == keep || cs.ImportedAt == 0 || (route != "" && cs.Route != route) {
+			continue
+		}
+		if matchKeys(cs.Media, want, whole) {
+			targets = append(targets, target{route: cs.Route, hash: h})
+		}
+	}
+	s.mu.Unlock()
+
+	var removed []string
+	for _, t := range targets {
+		r := t.route
+		if live := s.s.RouteOf(t.hash); live != "" {
+			r = live
+		}
+		if err := s.removeTorrent(r, t.hash); err != nil {
+			s.log.Warn().Err(err).Str("route", r).Str("hash", t.hash).Msg("error removing superseded torrent")
+			continue
+		}
+		removed = append(removed, t.hash)
+	}
+	return removed
+}
+
+// matchKeys reports whether media shares a key with want, or with whole set
+// whether every key of media is in want.
+func matchKeys(media []string, want map[string]bool, whole bool) bool {
+	if len(media) == 0 {
+		return false
+	}
+	for _, m := range media {
+		if want[m] && !whole {
+			return true
+		}
+		if !want[m] && whole {
+			return false
+		}
+	}
+	return whole
+}
+
+// updateMeta applies fn to the cached metadata of hash and persists it. It
+// returns ErrTorrentNotFound for torrents unknown to the service.
+func (s *Service) updateMeta(hash string, fn func(sm *summary)) error {
+	s.mu.Lock()
+	_, cached := s.cached[hash]
+	s.mu.Unlock()
+	var stored []byte
+	if !cached {
+		stored, _ = s.db.GetMeta(hash)
+	}
+
+	s.mu.Lock()
+	var sm summary
+	if cs := s.cached[hash]; cs != nil {
+		sm = cs.summary
+	} else if stored != nil {
+		_ = json.Unmarshal(stored, &sm)
+	}
+	sm.Hash = hash
+	if sm.Route == "" {
+		sm.Route = s.s.RouteOf(hash)
+	}
+	if sm.Route == "" {
+		s.mu.Unlock()
+		return ErrTorrentNotFound
+	}
+	fn(&sm)
+	seq := s.cacheMeta(sm)
+	s.mu.Unlock()
+
+	return s.storeMeta(sm, seq)
+}
+
+// mergeKeys returns the union of lists, keeping the first occurrence order.
+func mergeKeys(lists ...[]string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, l := range lists {
+		for _, k := range l {
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,154 @@
+package torrent
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	hookEpisode = "1111111111111111111111111111111111111111"
+	hookPack    = "2222222222222222222222222222222222222222"
+	hookNew     = "3333333333333333333333333333333333333333"
+	hookMovie   = "4444444444444444444444444444444444444444"
+)
+
+func episodes(ids ...int) []*arrWebhookRef {
+	var out []*arrWebhookRef
+	for _, id := range ids {
+		out = append(out, &arrWebhookRef{ID: id})
+	}
+	return out
+}
+
+func TestHandleArrWebhook(t *testing.T) {
+	t.Parallel()
+
+	series := &arrWebhookRef{ID: 1}
+	// an imported single episode and season pack of the same series, a
+	// movie, and a new torrent not imported yet
+	setup := func(t *testing.T) *Service {
+		s := newTestService(t, "tv", "movies")
+		addTestTorrent(t, s, "tv", hookEpisode, true, "sonarr:episode:3", "sonarr:series:1")
+		addTestTorrent(t, s, "tv", hookPack, true, "sonarr:episode:1", "sonarr:episode:2", "sonarr:episode:3", "sonarr:series:1")
+		addTestTorrent(t, s, "tv", hookNew, false)
+		addTestTorrent(t, s, "movies", hookMovie, true, "radarr:movie:7")
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		payload *ArrWebhook
+		want    *WebhookResult
+		wantErr bool
+	}{
+		{
+			name:    "test",
+			payload: &ArrWebhook{EventType: "Test", InstanceName: "Sonarr"},
+			want:    &WebhookResult{Event: "Test"},
+		},
+		{
+			name:    "grab without download id",
+			payload: &ArrWebhook{EventType: "Grab", InstanceName: "Sonarr", Series: series, Episodes: episodes(3)},
+			wantErr: true,
+		},
+		{
+			name:    "import",
+			payload: &ArrWebhook{EventType: "Download", InstanceName: "Sonarr", DownloadID: hookNew, Series: series, Episodes: episodes(4)},
+			want:    &WebhookResult{Event: "Download", Imported: []string{hookNew}},
+		},
+		{
+			name:    "import from another client",
+			payload: &ArrWebhook{EventType: "Download", InstanceName: "Sonarr", DownloadID: "5555555555555555555555555555555555555555", Series: series, Episodes: episodes(3)},
+			want:    &WebhookResult{Event: "Download", Ignored: true},
+		},
+		{
+			name:    "upgrade single episode keeps season pack",
+			payload: &ArrWebhook{EventType: "Download", InstanceName: "Sonarr", DownloadID: hookNew, IsUpgrade: true, Series: series, Episodes: episodes(3)},
+			want:    &WebhookResult{Event: "Download", Imported: []string{hookNew}, Removed: []string{hookEpisode}},
+		},
+		{
+			name:    "upgrade season pack",
+			payload: &ArrWebhook{EventType: "Download", InstanceName: "Sonarr", DownloadID: hookNew, IsUpgrade: true, Series: series, Episodes: episodes(1, 2, 3)},
+			want:    &WebhookResult{Event: "Download", Imported: []string{hookNew}, Removed: []string{hookEpisode, hookPack}},
+		},
+		{
+			name:    "upgrade on another route",
+			payload: &ArrWebhook{EventType: "Download", InstanceName: "Radarr", DownloadID: hookNew, IsUpgrade: true, Movie: &arrWebhookRef{ID: 7}},
+			want:    &WebhookResult{Event: "Download", Imported: []string{hookNew}},
+		},
+		{
+			name:    "file deleted by upgrade",
+			payload: &ArrWebhook{EventType: "EpisodeFileDelete", InstanceName: "Sonarr", DeleteReason: "upgrade", Series: series, Episodes: episodes(3)},
+			want:    &WebhookResult{Event: "EpisodeFileDelete", Ignored: true},
+		},
+		{
+			name:    "series deleted",
+			payload: &ArrWebhook{EventType: "SeriesDelete", InstanceName: "Sonarr", Series: series},
+			want:    &WebhookResult{Event: "SeriesDelete", Removed: []string{hookEpisode, hookPack}},
+		},
+		{
+			name:    "other instance",
+			payload: &ArrWebhook{EventType: "SeriesDelete", InstanceName: "Sonarr4K", Series: series},
+			want:    &WebhookResult{Event: "SeriesDelete"},
+		},
+		{
+			name:    "unknown event",
+			payload: &ArrWebhook{EventType: "HealthIssue", InstanceName: "Sonarr"},
+			want:    &WebhookResult{Event: "HealthIssue", Ignored: true},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require := require.New(t)
+
+			s := setup(t)
+			route := ""
+			if tt.payload.Movie != nil {
+				route = "tv"
+			}
+			res, err := s.HandleArrWebhook(route, tt.payload)
+			if tt.wantErr {
+				require.Error(err)
+				return
+			}
+			require.NoError(err)
+			sort.Strings(res.Removed)
+			require.Equal(tt.want, res)
+			for _, h := range res.Removed {
+				require.Empty(s.s.RouteOf(h))
+			}
+			for _, h := range res.Imported {
+				require.NotZero(s.cached[h].ImportedAt)
+			}
+		})
+	}
+}
+
+func TestHandleArrWebhookGrab(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	s := newTestService(t, "tv")
+	addTestTorrent(t, s, "tv", hookNew, false)
+	res, err := s.HandleArrWebhook("", &ArrWebhook{
+		EventType: "Grab", InstanceName: "Sonarr", DownloadID: hookNew,
+		Series: &arrWebhookRef{ID: 1}, Episodes: episodes(3),
+	})
+	require.NoError(err)
+	require.Equal(&WebhookResult{Event: "Grab"}, res)
+	require.Eventually(func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.cached[hookNew].Media) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	s.mu.Lock()
+	require.Equal([]string{"sonarr:episode:3", "sonarr:series:1"}, s.cached[hookNew].Media)
+	s.mu.Unlock()
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/jkaberg/distribyted/fs"
 	"github.com/jkaberg/distribyted/iio"
+	"github.com/jkaberg/distribyted/metrics"
 	"golang.org/x/net/webdav"
 )
 
@@ -147,8 +148,10 @@ func (wdf *webDAVFile) Read(p []byte) (int, error) {
 	wdf.mup.Lock()
 	defer wdf.mup.Unlock()
 
+	start := time.Now()
 	n, err := wdf.Reader.ReadAt(p, wdf.pos)
 	wdf.pos += int64(n)
+	metrics.ObserveRead(metrics.FrontendWebDAV, start, n)
 
 	return n, err
 }
@@ -3,19 +3,47 @@ package webdav
 import (
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/jkaberg/distribyted/fs"
 	"github.com/rs/zerolog/log"
 )
 
-func NewWebDAVServer(fs fs.Filesystem, port int, user, pass string) error {
+// Credentials holds the basic auth user and password for the WebDAV server.
+// They can be replaced while the server is running.
+type Credentials struct {
+	mu         sync.RWMutex
+	user, pass string
+}
+
+func NewCredentials(user, pass string) *Credentials {
+	return &Credentials{user: user, pass: pass}
+}
+
+// Set replaces the credentials used by new requests.
+func (c *Credentials) Set(user, pass string) {
+	c.mu.Lock()
+	c.user, c.pass = user, pass
+	c.mu.Unlock()
+}
+
+func (c *Credentials) match(user, pass string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return user == c.user && pass == c.pass
+}
+
+// NewWebDAVServer builds the WebDAV HTTP server. Callers own its lifecycle and
+// must call ListenAndServe and Shutdown on the returned server.
+func NewWebDAVServer(fs fs.Filesystem, port int, creds *Credentials) *http.Server {
 	log.Info().Str("host", fmt.Sprintf("0.0.0.0:%d", port)).Msg("starting webDAV server")
 
 	srv := newHandler(fs)
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		username, password, _ := r.BasicAuth()
-		if username == user && password == pass {
+		if creds.match(username, password) {
 			srv.ServeHTTP(w, r)
 			return
 		}
@@ -25,5 +53,8 @@ func NewWebDAVServer(fs fs.Filesystem, port int, user, pass string) error {
 		w.Write([]byte("401 Unauthorized\n"))
 	})
 
-	return http.ListenAndServe(fmt.Sprintf("0.0.0.0:%d", port), nil)
+	return &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", port),
+		Handler: mux,
+	}
 }